@@ -0,0 +1,546 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	netmail "net/mail"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"ironsnake/core/mail"
+)
+
+// Purposes of user tokens and how long they are valid
+const (
+	tokenPurposeVerifyEmail   = "verify_email"
+	tokenPurposeResetPassword = "reset_password"
+
+	verifyEmailTokenTTL   = 48 * time.Hour
+	resetPasswordTokenTTL = time.Hour
+)
+
+// Bounds of the length of local passwords. bcrypt ignores bytes after the
+// 72nd, so longer passwords are refused.
+const (
+	minPasswordLength = 8
+	maxPasswordLength = 72
+)
+
+// usernamePattern restricts self-registered usernames, which also appear in
+// URLs and WebDAV credentials
+var usernamePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._-]{2,63}$`)
+
+// errInvalidToken is returned for user tokens that are unknown, used or
+// expired
+var errInvalidToken = errors.New("invalid or expired token")
+
+// ErrEmailNotVerified is returned when a self-registered user logs in before
+// verifying their email address
+var ErrEmailNotVerified = errors.New("email address not verified")
+
+var mailer mail.Mailer
+
+// SignUpRequest represents the request body of a self-registration
+type SignUpRequest struct {
+	Username  string `json:"username"`
+	Email     string `json:"email"`
+	Password  string `json:"password"`
+	FirstName string `json:"firstName"`
+	LastName  string `json:"lastName"`
+}
+
+// TokenRequest represents a request redeeming a token received by email
+type TokenRequest struct {
+	Token string `json:"token"`
+}
+
+// ForgotPasswordRequest represents a request for a password reset email
+type ForgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+// ResetPasswordRequest represents the request body of a password reset
+type ResetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// ChangePasswordRequest represents the request body of a password change
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"currentPassword"`
+	NewPassword     string `json:"newPassword"`
+}
+
+// isLocalAccount reports whether the password of a user is managed here,
+// rather than by LDAP or an OpenID provider
+func isLocalAccount(user *User) bool {
+	return user.AuthProvider == "local" && !user.LDAPEnabled
+}
+
+// validatePassword checks a new local password
+func validatePassword(password string) error {
+	if len(password) < minPasswordLength {
+		return fmt.Errorf("password must have at least %d characters", minPasswordLength)
+	}
+	if len(password) > maxPasswordLength {
+		return fmt.Errorf("password must have at most %d bytes", maxPasswordLength)
+	}
+	return nil
+}
+
+// sendMail sends an email in the background, so that responses neither wait
+// for the mail server nor reveal whether an email was sent
+func sendMail(msg mail.Message) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		if err := mailer.Send(ctx, msg); err != nil {
+			log.Printf("Failed to send email %q to %s: %v", msg.Subject, msg.To, err)
+		}
+	}()
+}
+
+// publicLink returns a link to a page of the frontend with a token
+func publicLink(path, token string) string {
+	return GetConfig().PublicURL + path + "?token=" + url.QueryEscape(token)
+}
+
+// issueUserToken creates a token for a user, replacing the unused ones of the
+// same purpose, and returns it
+func issueUserToken(tx *gorm.DB, userID uuid.UUID, purpose string, ttl time.Duration) (string, error) {
+	token, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+
+	if err := tx.Where("user_id = ? AND purpose = ? AND used_at IS NULL", userID, purpose).Delete(&UserToken{}).Error; err != nil {
+		return "", err
+	}
+	now := time.Now()
+	err = tx.Create(&UserToken{
+		UserID:    userID,
+		Purpose:   purpose,
+		TokenHash: hashToken(token),
+		ExpiresAt: now.Add(ttl),
+		CreatedAt: now,
+	}).Error
+	return token, err
+}
+
+// redeemUserToken marks a token as used and returns it with its user. It
+// must run in a transaction, which keeps the token locked until it ends.
+func redeemUserToken(tx *gorm.DB, token, purpose string) (*UserToken, error) {
+	var userToken UserToken
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Preload("User").
+		Where("token_hash = ? AND purpose = ?", hashToken(token), purpose).
+		First(&userToken).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errInvalidToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if userToken.UsedAt != nil || now.After(userToken.ExpiresAt) || userToken.User.Disabled {
+		return nil, errInvalidToken
+	}
+	if err := tx.Model(&userToken).Update("used_at", now).Error; err != nil {
+		return nil, err
+	}
+	return &userToken, nil
+}
+
+// writeMessage writes a JSON message response
+func writeMessage(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"message": message})
+}
+
+// registerHandler creates an unverified local account and emails a link to
+// verify its address. Registering with an address already in use answers the
+// same, and notifies the owner of the address instead.
+func registerHandler(w http.ResponseWriter, r *http.Request) {
+	if !GetConfig().SelfRegistration {
+		http.Error(w, "Self-registration is disabled", http.StatusForbidden)
+		return
+	}
+
+	var request SignUpRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	request.Username = strings.TrimSpace(request.Username)
+	request.Email = strings.TrimSpace(request.Email)
+	if !usernamePattern.MatchString(request.Username) {
+		http.Error(w, "Username must have 3 to 64 letters, digits, dots, dashes or underscores", http.StatusBadRequest)
+		return
+	}
+	address, err := netmail.ParseAddress(request.Email)
+	if err != nil || address.Address != request.Email {
+		http.Error(w, "Invalid email address", http.StatusBadRequest)
+		return
+	}
+	if domains := GetConfig().RegistrationDomains; len(domains) > 0 {
+		_, domain, _ := strings.Cut(request.Email, "@")
+		if !slices.ContainsFunc(domains, func(d string) bool { return strings.EqualFold(d, domain) }) {
+			http.Error(w, "Registration is restricted to addresses of "+strings.Join(domains, ", "), http.StatusForbidden)
+			return
+		}
+	}
+	if err := validatePassword(request.Password); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Names granting roles by configuration belong to the people they were
+	// written for, even before their account exists
+	if isListedPlatformAdmin(request.Username) {
+		http.Error(w, "This username is already taken", http.StatusConflict)
+		return
+	}
+
+	// A local account would shadow a directory account not provisioned yet
+	if _, err := ldapService.GetUserAttributes(request.Username); err == nil {
+		http.Error(w, "This username is already taken", http.StatusConflict)
+		return
+	} else if !errors.Is(err, ErrLDAPUserNotFound) {
+		log.Printf("Failed to check username %s in LDAP: %v", request.Username, err)
+		http.Error(w, "Registration is unavailable, please try again later", http.StatusServiceUnavailable)
+		return
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(request.Password), bcrypt.DefaultCost)
+	if err != nil {
+		log.Printf("Error hashing password: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	var emailOwner *User
+	var token string
+	user := User{
+		Username:     request.Username,
+		Email:        request.Email,
+		PasswordHash: string(hash),
+		FirstName:    strings.TrimSpace(request.FirstName),
+		LastName:     strings.TrimSpace(request.LastName),
+		AuthProvider: "local",
+		Unverified:   true,
+	}
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		var existing []User
+		if err := tx.Where("LOWER(username) = LOWER(?) OR LOWER(email) = LOWER(?)", user.Username, user.Email).Find(&existing).Error; err != nil {
+			return err
+		}
+		for i := range existing {
+			if strings.EqualFold(existing[i].Username, user.Username) {
+				return gorm.ErrDuplicatedKey
+			}
+		}
+		if len(existing) > 0 {
+			emailOwner = &existing[0]
+			return nil
+		}
+
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		token, err = issueUserToken(tx, user.ID, tokenPurposeVerifyEmail, verifyEmailTokenTTL)
+		return err
+	})
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		http.Error(w, "This username is already taken", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("Error registering user %s: %v", request.Username, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if emailOwner != nil {
+		log.Printf("Registration of %s with the address of %s refused", request.Username, emailOwner.Username)
+		if !allowAccountMail(emailOwner.ID) {
+			writeMessage(w, http.StatusAccepted, "Check your email to activate your account")
+			return
+		}
+		sendMail(mail.Message{
+			To:      emailOwner.Email,
+			Subject: "IronSnake registration attempt",
+			Body: fmt.Sprintf("Hello,\n\nSomeone tried to register a new IronSnake account with your email address. "+
+				"You already have an account, with the username %s.\n\n"+
+				"If you forgot your password, you can reset it at %s/forgot-password\n\n"+
+				"If it was not you, you can ignore this email.\n", emailOwner.Username, GetConfig().PublicURL),
+		})
+	} else {
+		log.Printf("User %s registered, awaiting email verification", user.Username)
+		sendMail(mail.Message{
+			To:      user.Email,
+			Subject: "Verify your IronSnake email address",
+			Body: fmt.Sprintf("Hello %s,\n\nTo activate your IronSnake account, please open this link within %d hours:\n\n%s\n\n"+
+				"If you did not register, you can ignore this email.\n",
+				user.Username, int(verifyEmailTokenTTL.Hours()), publicLink("/verify-email", token)),
+		})
+	}
+
+	writeMessage(w, http.StatusAccepted, "Check your email to activate your account")
+}
+
+// verifyEmailHandler activates a self-registered account with the token
+// sent by email
+func verifyEmailHandler(w http.ResponseWriter, r *http.Request) {
+	var request TokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Token == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	var user User
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		userToken, err := redeemUserToken(tx, request.Token, tokenPurposeVerifyEmail)
+		if err != nil {
+			return err
+		}
+		user = userToken.User
+		return tx.Model(&user).Update("unverified", false).Error
+	})
+	if errors.Is(err, errInvalidToken) {
+		http.Error(w, "Invalid or expired link", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("Error verifying email: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("User %s verified their email address", user.Username)
+	writeMessage(w, http.StatusOK, "Email address verified, you can now log in")
+}
+
+// accountMailInterval is the least time between two emails that anonymous
+// requests send to the same account
+const accountMailInterval = time.Minute
+
+// allowAccountMail reports whether an anonymous request may email an account,
+// and if so records the email. The time of the last email is kept with the
+// login throttles.
+func allowAccountMail(userID uuid.UUID) bool {
+	now := time.Now()
+	result := DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "key"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{"last_attempt": now}),
+		Where: clause.Where{Exprs: []clause.Expression{
+			clause.Expr{SQL: "login_throttles.last_attempt < ?", Vars: []interface{}{now.Add(-accountMailInterval)}},
+		}},
+	}).Create(&LoginThrottle{Key: "mail:" + userID.String(), LastAttempt: now})
+	if result.Error != nil {
+		log.Printf("Failed to rate limit emails to %s: %v", userID, result.Error)
+		return false
+	}
+	return result.RowsAffected > 0
+}
+
+// forgotPasswordHandler emails a password reset link. The response is the
+// same whether the address is known or not. Resetting the password of an
+// unverified account also verifies it, which lets users whose verification
+// link expired activate their account.
+func forgotPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var request ForgotPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || strings.TrimSpace(request.Email) == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	const response = "If an account uses this address, an email with a reset link was sent to it"
+
+	var user User
+	err := DB.Where("LOWER(email) = LOWER(?)", strings.TrimSpace(request.Email)).First(&user).Error
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Printf("Error looking up user by email: %v", err)
+		}
+		writeMessage(w, http.StatusAccepted, response)
+		return
+	}
+	if user.Disabled {
+		writeMessage(w, http.StatusAccepted, response)
+		return
+	}
+
+	// Throttle emails per account
+	if !allowAccountMail(user.ID) {
+		writeMessage(w, http.StatusAccepted, response)
+		return
+	}
+
+	if !isLocalAccount(&user) {
+		sendMail(mail.Message{
+			To:      user.Email,
+			Subject: "IronSnake password",
+			Body: fmt.Sprintf("Hello %s,\n\nSomeone asked to reset your IronSnake password. Your account uses the "+
+				"login of your organization, so its password cannot be reset on IronSnake: please use the "+
+				"password recovery of your organization.\n\nIf it was not you, you can ignore this email.\n", user.Username),
+		})
+		writeMessage(w, http.StatusAccepted, response)
+		return
+	}
+
+	token, err := issueUserToken(DB, user.ID, tokenPurposeResetPassword, resetPasswordTokenTTL)
+	if err != nil {
+		log.Printf("Error issuing reset token for %s: %v", user.Username, err)
+		writeMessage(w, http.StatusAccepted, response)
+		return
+	}
+	sendMail(mail.Message{
+		To:      user.Email,
+		Subject: "Reset your IronSnake password",
+		Body: fmt.Sprintf("Hello %s,\n\nTo choose a new IronSnake password, please open this link within %d minutes:\n\n%s\n\n"+
+			"If you did not ask for it, you can ignore this email; your password is unchanged.\n",
+			user.Username, int(resetPasswordTokenTTL.Minutes()), publicLink("/reset-password", token)),
+	})
+	writeMessage(w, http.StatusAccepted, response)
+}
+
+// resetPasswordHandler sets a new password with the token sent by email and
+// logs the user out of all their sessions
+func resetPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var request ResetPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Token == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := validatePassword(request.Password); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(request.Password), bcrypt.DefaultCost)
+	if err != nil {
+		log.Printf("Error hashing password: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	var user User
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		userToken, err := redeemUserToken(tx, request.Token, tokenPurposeResetPassword)
+		if err != nil {
+			return err
+		}
+		user = userToken.User
+		if !isLocalAccount(&user) {
+			return errInvalidToken
+		}
+		return tx.Model(&user).Updates(map[string]interface{}{
+			"password_hash": string(hash),
+			"unverified":    false, // The email reached its owner
+		}).Error
+	})
+	if errors.Is(err, errInvalidToken) {
+		http.Error(w, "Invalid or expired link", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("Error resetting password: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if _, err := RevokeUserSessions(user.ID); err != nil {
+		log.Printf("Failed to revoke sessions of %s: %v", user.Username, err)
+	}
+	log.Printf("User %s reset their password", user.Username)
+	writeMessage(w, http.StatusOK, "Password changed, you can now log in")
+}
+
+// changePasswordHandler changes the password of the current local user. The
+// other sessions are revoked and the current one is replaced.
+func changePasswordHandler(w http.ResponseWriter, r *http.Request) {
+	user, err := GetUserFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if !isLocalAccount(user) {
+		http.Error(w, "The password of this account is managed by your organization", http.StatusConflict)
+		return
+	}
+
+	var request ChangePasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	// Throttle guesses of the current password like logins
+	attempt, err := beginLogin(user.Username, clientIP(r))
+	if err != nil {
+		var throttled *LoginThrottledError
+		if errors.As(err, &throttled) {
+			writeLoginThrottled(w, throttled)
+			return
+		}
+		log.Printf("Error throttling password change of %s: %v", user.Username, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(request.CurrentPassword)) != nil {
+		http.Error(w, "Current password is incorrect", http.StatusForbidden)
+		return
+	}
+	attempt.succeeded()
+	if err := validatePassword(request.NewPassword); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(request.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		log.Printf("Error hashing password: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if err := DB.Model(user).Update("password_hash", string(hash)).Error; err != nil {
+		log.Printf("Error changing password of %s: %v", user.Username, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if _, err := RevokeUserSessions(user.ID); err != nil {
+		log.Printf("Failed to revoke sessions of %s: %v", user.Username, err)
+	}
+	response, err := StartSession(w, r, user)
+	if err != nil {
+		log.Printf("Failed to start session: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("User %s changed their password", user.Username)
+	sendMail(mail.Message{
+		To:      user.Email,
+		Subject: "Your IronSnake password was changed",
+		Body: fmt.Sprintf("Hello %s,\n\nThe password of your IronSnake account was just changed, and your other "+
+			"sessions were logged out.\n\nIf it was not you, reset your password at %s/forgot-password\n",
+			user.Username, GetConfig().PublicURL),
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
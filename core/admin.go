@@ -0,0 +1,339 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultAdminUserLimit = 50
+	maxAdminUserLimit     = 500
+)
+
+// AdminCreateUserRequest represents the body of a local account creation
+type AdminCreateUserRequest struct {
+	Username  string `json:"username"`
+	Email     string `json:"email"`
+	Password  string `json:"password"`
+	FirstName string `json:"firstName"`
+	LastName  string `json:"lastName"`
+	IsAdmin   bool   `json:"isAdmin"`
+}
+
+// AdminUpdateUserRequest represents the body of a user update. Omitted
+// fields are left unchanged.
+type AdminUpdateUserRequest struct {
+	Disabled *bool `json:"disabled"`
+	IsAdmin  *bool `json:"isAdmin"`
+}
+
+// isPlatformAdmin reports whether a user administers the whole platform,
+// either promoted in the database or through an LDAP group. PLATFORM_ADMINS
+// only promotes accounts in the database, see BootstrapPlatformAdmins: a
+// listed name that has no account yet could otherwise be claimed by anyone
+// able to create one.
+func isPlatformAdmin(user *User) bool {
+	return user.IsAdmin || user.LDAPAdmin
+}
+
+// isListedPlatformAdmin reports whether a username is listed in
+// PLATFORM_ADMINS
+func isListedPlatformAdmin(username string) bool {
+	config := GetConfig()
+	return config != nil && slices.ContainsFunc(config.PlatformAdmins, func(name string) bool {
+		return strings.EqualFold(name, username)
+	})
+}
+
+// BootstrapPlatformAdmins promotes the existing users listed in
+// PLATFORM_ADMINS. Listed users provisioned later from LDAP are promoted
+// when they are created; accounts from self-registration or OpenID
+// providers never are.
+func BootstrapPlatformAdmins(config *Config) error {
+	if len(config.PlatformAdmins) == 0 {
+		return nil
+	}
+	result := DB.Model(&User{}).
+		Where("username IN ? AND is_admin = ? AND unverified = ? AND auth_provider IN ?", config.PlatformAdmins, false, false, []string{"local", "ldap"}).
+		Update("is_admin", true)
+	if result.Error != nil {
+		return fmt.Errorf("failed to promote platform administrators: %w", result.Error)
+	}
+	if result.RowsAffected > 0 {
+		log.Printf("Promoted %d platform administrator(s)", result.RowsAffected)
+	}
+	return nil
+}
+
+// RequirePlatformAdmin only calls next for platform administrators. It must
+// be wrapped in AuthMiddleware.
+func RequirePlatformAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, err := GetUserFromContext(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if !isPlatformAdmin(user) {
+			log.Printf("User %s denied platform administration", user.Username)
+			http.Error(w, "Forbidden: platform administrators only", http.StatusForbidden)
+			return
+		}
+		if !scopeAllows(GetTokenScopes(r), "admin", r.Method) {
+			writeInsufficientScope(w, r, "admin")
+			return
+		}
+		next(w, r)
+	}
+}
+
+// adminUserResponse converts a user to its administration view
+func adminUserResponse(user *User) AdminUserResponse {
+	return AdminUserResponse{
+		UserResponse: userResponse(user),
+		Disabled:     user.Disabled,
+		Unverified:   user.Unverified,
+		CreatedAt:    user.CreatedAt,
+	}
+}
+
+// queryInt parses an optional non-negative integer query parameter
+func queryInt(r *http.Request, name string, defaultValue int) (int, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return defaultValue, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid %s: %q", name, value)
+	}
+	return n, nil
+}
+
+// adminListUsersHandler lists the users of the platform. ?q= searches the
+// username, email and name; ?limit= and ?offset= page the results.
+func adminListUsersHandler(w http.ResponseWriter, r *http.Request) {
+	limit, err := queryInt(r, "limit", defaultAdminUserLimit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	offset, err := queryInt(r, "offset", 0)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if limit == 0 || limit > maxAdminUserLimit {
+		limit = maxAdminUserLimit
+	}
+
+	query := DB.Model(&User{})
+	if q := strings.TrimSpace(r.URL.Query().Get("q")); q != "" {
+		pattern := "%" + strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(q) + "%"
+		query = query.Where(
+			"username ILIKE ? OR email ILIKE ? OR first_name ILIKE ? OR last_name ILIKE ? OR CONCAT(first_name, ' ', last_name) ILIKE ?",
+			pattern, pattern, pattern, pattern, pattern,
+		)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		log.Printf("Error counting users: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	var users []User
+	if err := query.Order("username").Limit(limit).Offset(offset).Find(&users).Error; err != nil {
+		log.Printf("Error listing users: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	response := AdminUserListResponse{
+		Total: total,
+		Users: make([]AdminUserResponse, len(users)),
+	}
+	for i := range users {
+		response.Users[i] = adminUserResponse(&users[i])
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+// adminCreateUserHandler creates a local account
+func adminCreateUserHandler(w http.ResponseWriter, r *http.Request) {
+	admin, err := GetUserFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var request AdminCreateUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	request.Username = strings.TrimSpace(request.Username)
+	request.Email = strings.TrimSpace(request.Email)
+	if request.Username == "" || request.Email == "" || request.Password == "" {
+		http.Error(w, "Username, email and password are required", http.StatusBadRequest)
+		return
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(request.Password), bcrypt.DefaultCost)
+	if err != nil {
+		log.Printf("Error hashing password: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	user := User{
+		Username:     request.Username,
+		Email:        request.Email,
+		PasswordHash: string(hash),
+		FirstName:    request.FirstName,
+		LastName:     request.LastName,
+		AuthProvider: "local",
+		IsAdmin:      request.IsAdmin,
+	}
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&User{}).Where("username = ? OR email = ?", user.Username, user.Email).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return gorm.ErrDuplicatedKey
+		}
+		return tx.Create(&user).Error
+	})
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		http.Error(w, "A user with this username or email already exists", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("Error creating user %s: %v", request.Username, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Platform administrator %s created user %s", admin.Username, user.Username)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(adminUserResponse(&user)); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+// adminUpdateUserHandler disables, enables, promotes or demotes a user.
+// Administrators cannot change their own account so that they cannot lock
+// themselves out.
+func adminUpdateUserHandler(w http.ResponseWriter, r *http.Request) {
+	admin, err := GetUserFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var request AdminUpdateUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	user, err := GetUserByID(r.PathValue("userID"))
+	if err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if user.ID == admin.ID {
+		http.Error(w, "Cannot change your own account", http.StatusForbidden)
+		return
+	}
+
+	updates := map[string]interface{}{}
+	if request.Disabled != nil {
+		updates["disabled"] = *request.Disabled
+	}
+	if request.IsAdmin != nil {
+		if !*request.IsAdmin && isListedPlatformAdmin(user.Username) {
+			http.Error(w, "This user is an administrator through PLATFORM_ADMINS", http.StatusConflict)
+			return
+		}
+		updates["is_admin"] = *request.IsAdmin
+	}
+	if len(updates) > 0 {
+		if err := DB.Model(user).Updates(updates).Error; err != nil {
+			log.Printf("Error updating user %s: %v", user.Username, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		log.Printf("Platform administrator %s updated user %s: %v", admin.Username, user.Username, updates)
+	}
+	if request.Disabled != nil && *request.Disabled {
+		// Disabled users lose access right away, not when their tokens expire
+		revoked, err := RevokeUserSessions(user.ID)
+		if err != nil {
+			log.Printf("Error revoking sessions of %s: %v", user.Username, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		log.Printf("Revoked %d sessions of disabled user %s", revoked, user.Username)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(adminUserResponse(user)); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+// adminListCoursesHandler lists every course of the catalog, hidden or not,
+// with its number of enrolled students
+func adminListCoursesHandler(w http.ResponseWriter, r *http.Request) {
+	var counts []struct {
+		CourseID string
+		Count    int
+	}
+	err := DB.Model(&Enrollment{}).
+		Select("course_id, COUNT(*) AS count").
+		Group("course_id").
+		Scan(&counts).Error
+	if err != nil {
+		log.Printf("Error counting enrollments: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	enrollments := make(map[string]int, len(counts))
+	for _, c := range counts {
+		enrollments[c.CourseID] = c.Count
+	}
+
+	courses := courseCatalog.List()
+	response := make([]AdminCourseResponse, len(courses))
+	for i, course := range courses {
+		response[i] = AdminCourseResponse{
+			CourseResponse: courseResponse(course, RoleAdmin, false),
+			Hidden:         resolveCourseAccess(course, RoleNone) == CourseHidden,
+			Enrollments:    enrollments[course.CourseID],
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		log.Printf("Error encoding response: %v", err)
+	}
+}
@@ -2,10 +2,14 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
+	"sync"
 
 	"golang.org/x/crypto/bcrypt"
+
+	"ironsnake/core/mail"
 )
 
 var (
@@ -13,10 +17,30 @@ var (
 	jwtService  *JWTService
 )
 
+// ErrUserDisabled is returned when a disabled user tries to authenticate
+var ErrUserDisabled = errors.New("user is disabled")
+
+// ErrInvalidCredentials is returned for a wrong password
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
 // InitAuthServices initializes the authentication services
 func InitAuthServices(config *Config) {
-	ldapService = NewLDAPService(&config.LDAP)
-	jwtService = NewJWTService(&config.JWT)
+	var err error
+	ldapService, err = NewLDAPService(&config.LDAP)
+	if err != nil {
+		log.Fatalf("Failed to initialize LDAP: %v", err)
+	}
+	jwtService, err = NewJWTService(&config.JWT)
+	if err != nil {
+		log.Fatalf("Failed to initialize JWT: %v", err)
+	}
+	mailer, err = mail.New(config.Mail)
+	if err != nil {
+		log.Fatalf("Failed to initialize mail: %v", err)
+	}
+	if err := InitOIDCProviders(config.OIDCProviders); err != nil {
+		log.Fatalf("Failed to initialize OIDC: %v", err)
+	}
 }
 
 // LoginRequest represents the login request body
@@ -27,8 +51,10 @@ type LoginRequest struct {
 
 // LoginResponse represents the login response body
 type LoginResponse struct {
-	User  UserResponse `json:"user"`
-	Token string       `json:"token"`
+	User         UserResponse `json:"user"`
+	Token        string       `json:"token"`        // Access token
+	RefreshToken string       `json:"refreshToken"` // Single use, renews the access token at /auth/refresh
+	ExpiresIn    int          `json:"expiresIn"`    // Lifetime of the access token in seconds
 }
 
 // UserResponse represents user data in API responses
@@ -39,6 +65,24 @@ type UserResponse struct {
 	FirstName    string `json:"firstName"`
 	LastName     string `json:"lastName"`
 	AuthProvider string `json:"authProvider"`
+	IsAdmin      bool   `json:"isAdmin"` // Platform administrator
+
+	// Impersonation is set when a course admin sees the platform as this
+	// user, see impersonation.go
+	Impersonation *ImpersonationResponse `json:"impersonation,omitempty"`
+}
+
+// userResponse converts a user to its API representation
+func userResponse(user *User) UserResponse {
+	return UserResponse{
+		ID:           user.ID.String(),
+		Username:     user.Username,
+		Email:        user.Email,
+		FirstName:    user.FirstName,
+		LastName:     user.LastName,
+		AuthProvider: user.AuthProvider,
+		IsAdmin:      isPlatformAdmin(user),
+	}
 }
 
 // loginHandler handles user login
@@ -60,56 +104,32 @@ func loginHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Check if user exists in database
-	existingUser, err := GetUserByUsername(loginReq.Username)
-
-	var user *User
-	var authError error
-
-	if err == nil && existingUser != nil {
-		// User exists, determine auth method
-		if existingUser.AuthProvider == "ldap" || existingUser.LDAPEnabled {
-			// LDAP authentication
-			user, authError = authenticateLDAP(loginReq.Username, loginReq.Password)
-		} else {
-			// Local authentication
-			user, authError = authenticateLocal(existingUser, loginReq.Password)
-		}
-	} else {
-		// User doesn't exist, try LDAP (auto-provision)
-		user, authError = authenticateLDAP(loginReq.Username, loginReq.Password)
+	user, authError := authenticateThrottled(loginReq.Username, loginReq.Password, clientIP(r))
+	var throttled *LoginThrottledError
+	if errors.As(authError, &throttled) {
+		log.Printf("Login of user %s from %s throttled for %s", loginReq.Username, clientIP(r), throttled.RetryAfter)
+		writeLoginThrottled(w, throttled)
+		return
+	}
+	if errors.Is(authError, ErrEmailNotVerified) {
+		// The password was right, telling reveals nothing to others
+		http.Error(w, "Email address not verified, check your email", http.StatusForbidden)
+		return
 	}
-
 	if authError != nil {
 		log.Printf("Authentication failed for user %s: %v", loginReq.Username, authError)
 		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
 		return
 	}
 
-	// Generate JWT token
-	token, err := jwtService.GenerateToken(user)
+	// Open a session and set its token cookies
+	response, err := StartSession(w, r, user)
 	if err != nil {
-		log.Printf("Failed to generate token: %v", err)
+		log.Printf("Failed to start session: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
-	// Set secure cookie (use Secure=true in production with HTTPS)
-	jwtService.SetTokenCookie(w, token, false)
-
-	// Return response
-	response := LoginResponse{
-		User: UserResponse{
-			ID:           user.ID.String(),
-			Username:     user.Username,
-			Email:        user.Email,
-			FirstName:    user.FirstName,
-			LastName:     user.LastName,
-			AuthProvider: user.AuthProvider,
-		},
-		Token: token,
-	}
-
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
@@ -121,8 +141,41 @@ func logoutHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Clear the auth token cookie
+	// Logging out of an impersonation only ends it: the access token cookie
+	// is the impersonation's, while the refresh token cookie is still the
+	// course admin's
+	if tokenString, err := jwtService.ExtractToken(r); err == nil {
+		if _, session, err := authenticateToken(tokenString); err == nil && isImpersonation(session) {
+			if err := endImpersonation(r, session, http.StatusOK); err != nil {
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+			jwtService.ClearTokenCookie(w)
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]string{"message": "Impersonation ended"})
+			return
+		}
+	}
+
+	// Revoke the session, found by its refresh token or its access token
+	if refreshToken, err := jwtService.ExtractRefreshToken(r); err == nil {
+		var session Session
+		if err := DB.Where("refresh_token_hash = ?", hashToken(refreshToken)).First(&session).Error; err == nil {
+			if err := RevokeSession(session.ID); err != nil {
+				log.Printf("Failed to revoke session %s: %v", session.ID, err)
+			}
+		}
+	} else if tokenString, err := jwtService.ExtractToken(r); err == nil {
+		if claims, err := jwtService.ValidateToken(tokenString); err == nil {
+			if err := RevokeSession(claims.SessionID); err != nil {
+				log.Printf("Failed to revoke session %s: %v", claims.SessionID, err)
+			}
+		}
+	}
+
+	// Clear the token cookies
 	jwtService.ClearTokenCookie(w)
+	jwtService.ClearRefreshTokenCookie(w)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{"message": "Logged out successfully"})
@@ -142,19 +195,57 @@ func getMeHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	response := UserResponse{
-		ID:           user.ID.String(),
-		Username:     user.Username,
-		Email:        user.Email,
-		FirstName:    user.FirstName,
-		LastName:     user.LastName,
-		AuthProvider: user.AuthProvider,
+	response := userResponse(user)
+	if session := GetImpersonation(r); session != nil {
+		response.Impersonation = impersonationResponse(session)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
 
+// authenticateCredentials checks a username and password against the user's
+// auth provider. Unknown users are tried against LDAP so they get provisioned.
+func authenticateCredentials(username, password string) (*User, error) {
+	existingUser, err := GetUserByUsername(username)
+	if err == nil && existingUser != nil {
+		if existingUser.Disabled {
+			equalizeTiming(password)
+			return nil, ErrUserDisabled
+		}
+		// User exists, determine auth method
+		if existingUser.AuthProvider == "ldap" || existingUser.LDAPEnabled {
+			return authenticateLDAP(username, password)
+		}
+		user, err := authenticateLocal(existingUser, password)
+		if err == nil && user.Unverified {
+			return nil, ErrEmailNotVerified
+		}
+		return user, err
+	}
+
+	// User doesn't exist, try LDAP (auto-provision)
+	user, err := authenticateLDAP(username, password)
+	if errors.Is(err, ErrLDAPUserNotFound) {
+		equalizeTiming(password)
+		return nil, ErrInvalidCredentials
+	}
+	return user, err
+}
+
+// dummyPasswordHash is compared with the passwords of failed logins that
+// did not reach a password check
+var dummyPasswordHash = sync.OnceValue(func() []byte {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("not a password"), bcrypt.DefaultCost)
+	return hash
+})
+
+// equalizeTiming spends the time of a password check, so that response times
+// do not tell unknown or disabled accounts from wrong passwords
+func equalizeTiming(password string) {
+	bcrypt.CompareHashAndPassword(dummyPasswordHash(), []byte(password))
+}
+
 // authenticateLDAP authenticates against LDAP and syncs user
 func authenticateLDAP(username, password string) (*User, error) {
 	// Authenticate with LDAP
@@ -169,15 +260,26 @@ func authenticateLDAP(username, password string) (*User, error) {
 		return nil, err
 	}
 
+	// Group changes apply from the next login, a failure keeps the previous roles
+	if err := SyncLDAPRoles(user, ldapUser.DN); err != nil {
+		log.Printf("Failed to sync LDAP roles of %s: %v", user.Username, err)
+	}
+
 	return user, nil
 }
 
 // authenticateLocal authenticates against local database
 func authenticateLocal(user *User, password string) (*User, error) {
+	if user.PasswordHash == "" {
+		// Accounts of OpenID providers have no local password
+		equalizeTiming(password)
+		return nil, ErrInvalidCredentials
+	}
+
 	// Verify password hash
 	err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password))
 	if err != nil {
-		return nil, err
+		return nil, ErrInvalidCredentials
 	}
 
 	return user, nil
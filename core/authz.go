@@ -0,0 +1,293 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/google/uuid"
+
+	"ironsnake/core/courseparser"
+)
+
+// CourseRole is the role of a user in a course, from least to most privileged
+type CourseRole int
+
+const (
+	RoleNone    CourseRole = iota // Not part of the course
+	RoleStudent                   // Enrolled in the course
+	RoleTutor                     // Listed in tutors or assigned as a teaching assistant
+	RoleAdmin                     // Listed in admins or assigned as a teacher
+)
+
+var courseRoleNames = map[CourseRole]string{
+	RoleNone:    "none",
+	RoleStudent: "student",
+	RoleTutor:   "tutor",
+	RoleAdmin:   "admin",
+}
+
+// String returns the name of the role
+func (r CourseRole) String() string {
+	return courseRoleNames[r]
+}
+
+// parseCourseRole returns the role of a name, as returned by String
+func parseCourseRole(name string) (CourseRole, bool) {
+	for role, roleName := range courseRoleNames {
+		if roleName == name {
+			return role, true
+		}
+	}
+	return RoleNone, false
+}
+
+// teachingRoles maps the names of the Role table to course roles. Unknown
+// names give the least privileged staff role.
+var teachingRoles = map[string]CourseRole{
+	"Professor":           RoleAdmin,
+	"Assistant Professor": RoleAdmin,
+	"Lecturer":            RoleAdmin,
+	"Teaching Assistant":  RoleTutor,
+}
+
+// Permission is an action in a course that handlers require
+type Permission string
+
+const (
+	PermViewCourse      Permission = "view course"      // See the course and register to it
+	PermReadTasks       Permission = "read tasks"       // Read tasks and the syllabus
+	PermSubmit          Permission = "submit"           // Submit answers to tasks
+	PermViewSubmissions Permission = "view submissions" // See the submissions of students
+	PermGrade           Permission = "grade"            // Grade and comment submissions
+	PermEditTask        Permission = "edit task"        // Edit tasks and course files
+	PermManageGroups    Permission = "manage groups"    // Create groups and assign their members
+	PermManageCourse    Permission = "manage course"    // Export or replace the course
+)
+
+// rolePermissions lists the staff permissions of each role. Reading and
+// submitting depend on the course settings too, see CourseContext.Can.
+var rolePermissions = map[CourseRole]map[Permission]bool{
+	RoleTutor: {
+		PermViewSubmissions: true,
+		PermGrade:           true,
+	},
+	RoleAdmin: {
+		PermViewSubmissions: true,
+		PermGrade:           true,
+		PermEditTask:        true,
+		PermManageGroups:    true,
+		PermManageCourse:    true,
+	},
+}
+
+// roleAssignments are the database records giving a user a role in courses
+type roleAssignments struct {
+	teaching map[string]CourseRole // By course ID, from CourseTeacher and CourseStaff
+	enrolled map[string]bool       // Course IDs, from Enrollment
+}
+
+// loadRoleAssignments loads the teaching and staff assignments and enrollments of a
+// user, in the given courses only if any. Database courses are matched to
+// catalog courses by their code.
+func loadRoleAssignments(userID uuid.UUID, courseIDs ...string) (*roleAssignments, error) {
+	var teaching []struct {
+		Code     string
+		RoleName string
+	}
+	query := DB.Table("course_teachers").
+		Select("courses.code AS code, roles.name AS role_name").
+		Joins("JOIN courses ON courses.id = course_teachers.course_id").
+		Joins("JOIN roles ON roles.id = course_teachers.role_id").
+		Where("course_teachers.teacher_id = ?", userID)
+	if len(courseIDs) > 0 {
+		query = query.Where("courses.code IN ?", courseIDs)
+	}
+	if err := query.Scan(&teaching).Error; err != nil {
+		return nil, fmt.Errorf("failed to load teaching assignments: %w", err)
+	}
+
+	var staff []CourseStaff
+	query = DB.Where("user_id = ?", userID)
+	if len(courseIDs) > 0 {
+		query = query.Where("course_id IN ?", courseIDs)
+	}
+	if err := query.Find(&staff).Error; err != nil {
+		return nil, fmt.Errorf("failed to load staff assignments: %w", err)
+	}
+
+	var enrolled []string
+	query = DB.Model(&Enrollment{}).Where("user_id = ?", userID)
+	if len(courseIDs) > 0 {
+		query = query.Where("course_id IN ?", courseIDs)
+	}
+	if err := query.Pluck("course_id", &enrolled).Error; err != nil {
+		return nil, fmt.Errorf("failed to load enrollments: %w", err)
+	}
+
+	assignments := &roleAssignments{
+		teaching: make(map[string]CourseRole, len(teaching)),
+		enrolled: make(map[string]bool, len(enrolled)),
+	}
+	for _, t := range teaching {
+		role, ok := teachingRoles[t.RoleName]
+		if !ok {
+			role = RoleTutor
+		}
+		if role > assignments.teaching[t.Code] {
+			assignments.teaching[t.Code] = role
+		}
+	}
+	for _, s := range staff {
+		if role, _ := parseCourseRole(s.Role); role > assignments.teaching[s.CourseID] {
+			assignments.teaching[s.CourseID] = role
+		}
+	}
+	for _, courseID := range enrolled {
+		assignments.enrolled[courseID] = true
+	}
+	return assignments, nil
+}
+
+// staticRole returns the role a user has in a course regardless of the
+// database assignments: admin for platform administrators, otherwise the
+// role the course configuration gives
+func staticRole(user *User, course *courseparser.ParsedCourse) CourseRole {
+	if isPlatformAdmin(user) {
+		return RoleAdmin
+	}
+	for _, admin := range course.Config.Admins {
+		if admin == user.Username {
+			return RoleAdmin
+		}
+	}
+	for _, tutor := range course.Config.Tutors {
+		if tutor == user.Username {
+			return RoleTutor
+		}
+	}
+	return RoleNone
+}
+
+// role returns the highest role of a user in a course
+func (a *roleAssignments) role(user *User, course *courseparser.ParsedCourse) CourseRole {
+	role := staticRole(user, course)
+	if teaching := a.teaching[course.CourseID]; teaching > role {
+		role = teaching
+	}
+	if role == RoleNone && a.enrolled[course.CourseID] {
+		role = RoleStudent
+	}
+	return role
+}
+
+// ResolveCourseRole returns the role of a user in a course: admin for
+// platform administrators, admin or tutor when listed in the course
+// configuration or assigned in the database, student when enrolled, none
+// otherwise. When the database fails, the role
+// from the configuration is returned with the error.
+func ResolveCourseRole(user *User, course *courseparser.ParsedCourse) (CourseRole, error) {
+	assignments, err := loadRoleAssignments(user.ID, course.CourseID)
+	if err != nil {
+		return staticRole(user, course), err
+	}
+	return assignments.role(user, course), nil
+}
+
+// CourseContext is the course of a request and how the current user relates
+// to it
+type CourseContext struct {
+	User     *User
+	Course   *courseparser.ParsedCourse
+	Role     CourseRole
+	Enrolled bool
+	Access   CourseAccess
+}
+
+// newCourseContext resolves the role and access of a user in a course
+func newCourseContext(user *User, course *courseparser.ParsedCourse) (*CourseContext, error) {
+	assignments, err := loadRoleAssignments(user.ID, course.CourseID)
+	if err != nil {
+		return nil, err
+	}
+	role := assignments.role(user, course)
+	return &CourseContext{
+		User:     user,
+		Course:   course,
+		Role:     role,
+		Enrolled: assignments.enrolled[course.CourseID],
+		Access:   resolveCourseAccess(course, role),
+	}, nil
+}
+
+// Staff reports whether the user is an admin or a tutor of the course
+func (c *CourseContext) Staff() bool {
+	return c.Role >= RoleTutor
+}
+
+// Can reports whether the user has a permission in the course
+func (c *CourseContext) Can(perm Permission) bool {
+	switch perm {
+	case PermViewCourse:
+		return c.Access >= CourseListed
+	case PermReadTasks:
+		return c.Access >= CoursePreview
+	case PermSubmit:
+		return c.Access >= CourseMember
+	}
+	return rolePermissions[c.Role][perm]
+}
+
+// CourseHandlerFunc is a handler for course routes, given the course of the
+// request and the current user's role in it
+type CourseHandlerFunc func(w http.ResponseWriter, r *http.Request, cc *CourseContext)
+
+// RequireCoursePermission resolves the role of the current user in the
+// course of the {courseID} path parameter and only calls next if it grants
+// perm. Courses the user may not see are reported as missing; other denials
+// are 403 Forbidden. It must be wrapped in AuthMiddleware.
+func RequireCoursePermission(perm Permission, next CourseHandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, err := GetUserFromContext(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		if !scopeAllows(GetTokenScopes(r), permissionResources[perm], r.Method) {
+			writeInsufficientScope(w, r, permissionResources[perm])
+			return
+		}
+
+		courseID := r.PathValue("courseID")
+		course, ok := courseCatalog.Get(courseID)
+		if !ok || !impersonatedCourseAllowed(r, courseID) {
+			http.Error(w, "Course not found", http.StatusNotFound)
+			return
+		}
+
+		cc, err := newCourseContext(user, course)
+		if err != nil {
+			log.Printf("Error resolving the role of %s in course %s: %v", user.Username, courseID, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		if !cc.Can(PermViewCourse) {
+			http.Error(w, "Course not found", http.StatusNotFound)
+			return
+		}
+		if !cc.Can(perm) {
+			writeForbidden(w, cc, perm)
+			return
+		}
+
+		next(w, r, cc)
+	}
+}
+
+// writeForbidden reports a missing permission, the same way for every route
+func writeForbidden(w http.ResponseWriter, cc *CourseContext, perm Permission) {
+	log.Printf("User %s (%s) denied %q in course %s", cc.User.Username, cc.Role, perm, cc.Course.CourseID)
+	http.Error(w, fmt.Sprintf("Forbidden: missing permission %q", perm), http.StatusForbidden)
+}
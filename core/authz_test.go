@@ -0,0 +1,38 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestCourseContextCan(t *testing.T) {
+	all := []Permission{
+		PermViewCourse, PermReadTasks, PermSubmit, PermViewSubmissions,
+		PermGrade, PermEditTask, PermManageGroups, PermManageCourse,
+	}
+	tests := []struct {
+		name   string
+		role   CourseRole
+		access CourseAccess
+		want   []Permission
+	}{
+		{"hidden", RoleNone, CourseHidden, nil},
+		{"listed", RoleNone, CourseListed, []Permission{PermViewCourse}},
+		{"preview", RoleNone, CoursePreview, []Permission{PermViewCourse, PermReadTasks}},
+		{"student", RoleStudent, CourseMember, []Permission{PermViewCourse, PermReadTasks, PermSubmit}},
+		{"student of a hidden course", RoleStudent, CourseHidden, nil},
+		{"tutor", RoleTutor, CourseMember, []Permission{
+			PermViewCourse, PermReadTasks, PermSubmit, PermViewSubmissions, PermGrade,
+		}},
+		{"admin", RoleAdmin, CourseMember, all},
+	}
+	for _, tt := range tests {
+		cc := &CourseContext{Role: tt.role, Access: tt.access}
+		for _, perm := range all {
+			want := slices.Contains(tt.want, perm)
+			if got := cc.Can(perm); got != want {
+				t.Errorf("%s: Can(%q) = %v, want %v", tt.name, perm, got, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,138 @@
+// Command coursearchive imports and exports IronSnake course archives.
+//
+// Usage:
+//
+//	coursearchive import [-courses dir] [-id ID] [-on-conflict fail|rename|replace] [-admin username] archive
+//	coursearchive export [-courses dir] [-format zip|tar.gz] [-o file] courseID
+//
+// Archives may be IronSnake course exports or INGInious courses, which are
+// converted on import. A running server picks up imported courses after a
+// SIGHUP.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"ironsnake/core/courseparser"
+)
+
+func main() {
+	log.SetFlags(0)
+
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	switch os.Args[1] {
+	case "import":
+		runImport(os.Args[2:])
+	case "export":
+		runExport(os.Args[2:])
+	default:
+		usage()
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: coursearchive import [flags] archive")
+	fmt.Fprintln(os.Stderr, "       coursearchive export [flags] courseID")
+	os.Exit(2)
+}
+
+func runImport(args []string) {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	coursesDir := flags.String("courses", "courses", "courses directory")
+	courseID := flags.String("id", "", "course ID (defaults to the archive's top-level directory)")
+	onConflict := flags.String("on-conflict", "fail", "what to do if the course exists: fail, rename or replace")
+	admin := flags.String("admin", "", "username to add to the course admins")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		usage()
+	}
+	archive := flags.Arg(0)
+
+	opts := courseparser.ImportOptions{
+		CourseID:   *courseID,
+		FallbackID: trimArchiveExt(filepath.Base(archive)),
+		OnConflict: courseparser.ConflictPolicy(*onConflict),
+	}
+	if *admin != "" {
+		opts.Admins = []string{*admin}
+	}
+
+	result, err := courseparser.ImportArchive(*coursesDir, archive, opts)
+	if err != nil {
+		log.Fatalf("Import failed: %v", err)
+	}
+
+	fmt.Printf("Imported course %s (%s) with %d tasks\n", result.CourseID, result.Course.Config.Name, len(result.Course.Tasks))
+	if result.INGInious {
+		fmt.Println("Converted from the INGInious course layout")
+	}
+	if result.Replaced {
+		fmt.Println("Replaced the existing course")
+	}
+}
+
+func runExport(args []string) {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	coursesDir := flags.String("courses", "courses", "courses directory")
+	formatName := flags.String("format", "zip", "archive format: zip or tar.gz")
+	output := flags.String("o", "", "output file (defaults to <courseID>-<date>.<format>)")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		usage()
+	}
+	courseID := flags.Arg(0)
+
+	format, err := courseparser.ParseArchiveFormat(*formatName)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	catalog := courseparser.NewCatalog(*coursesDir)
+	courseDir, err := catalog.CoursePath(courseID)
+	if err != nil {
+		log.Fatalf("Invalid course ID %q", courseID)
+	}
+	if _, err := os.Stat(filepath.Join(courseDir, "config.yaml")); err != nil {
+		log.Fatalf("Course %s not found in %s", courseID, *coursesDir)
+	}
+
+	path := *output
+	if path == "" {
+		path = courseparser.ArchiveName(courseID, format, time.Now())
+	}
+
+	out, err := os.Create(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := courseparser.ExportArchive(out, courseDir, format); err != nil {
+		out.Close()
+		os.Remove(path)
+		log.Fatalf("Export failed: %v", err)
+	}
+	if err := out.Close(); err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Printf("Exported course %s to %s\n", courseID, path)
+}
+
+// trimArchiveExt strips a .zip, .tar.gz or .tgz extension
+func trimArchiveExt(name string) string {
+	for _, ext := range []string{".tar.gz", ".tgz", ".zip"} {
+		if len(name) > len(ext) && name[len(name)-len(ext):] == ext {
+			return name[:len(name)-len(ext)]
+		}
+	}
+	return name
+}
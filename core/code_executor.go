@@ -49,6 +49,11 @@ func runCodeHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// isRunnableLanguage reports whether code in language can be executed
+func isRunnableLanguage(language string) bool {
+	return language == "python" || language == "python3"
+}
+
 // executeCodeInDocker runs the provided code in a sandboxed Docker container
 func executeCodeInDocker(code, language string) RunCodeResponse {
 	// Configuration
@@ -59,7 +64,7 @@ func executeCodeInDocker(code, language string) RunCodeResponse {
 	)
 
 	// Only support Python for now
-	if language != "python" && language != "python3" {
+	if !isRunnableLanguage(language) {
 		return RunCodeResponse{
 			Output:   "",
 			Error:    fmt.Sprintf("Unsupported language: %s. Only Python is supported.", language),
@@ -2,30 +2,133 @@ package main
 
 import (
 	"log"
+	"net"
 	"os"
 	"strconv"
+	"strings"
+	"time"
+
+	"ironsnake/core/mail"
 )
 
 // Config holds the application configuration
 type Config struct {
 	LDAP LDAPConfig
 	JWT  JWTConfig
+
+	// APIBasePath is the path under which the reverse proxy exposes this
+	// API, used to build links in rendered content
+	APIBasePath string
+
+	// PlatformAdmins are the usernames of the platform administrators
+	// bootstrapped at startup, in addition to those promoted in the database
+	PlatformAdmins []string
+
+	// OIDCProviders are the OpenID Connect providers users can log in with
+	OIDCProviders []OIDCProviderConfig
+
+	// PublicURL is the URL of the frontend, for the links sent by email
+	PublicURL string
+
+	// Mail configures the backend emails are sent with
+	Mail mail.Config
+
+	// SelfRegistration lets visitors create local accounts, verified by
+	// email. RegistrationDomains restricts it to addresses of these domains.
+	SelfRegistration    bool
+	RegistrationDomains []string
+
+	// LoginThrottle protects logins against password guessing
+	LoginThrottle LoginThrottleConfig
+
+	// TrustedProxies are the networks of the reverse proxies whose
+	// X-Forwarded-For header gives the client address. Only loopback by
+	// default: trusting a wider network lets its hosts forge addresses.
+	TrustedProxies []*net.IPNet
+}
+
+// LoginThrottleConfig holds the brute-force protection of logins. Failed
+// attempts are counted per username, known or not, and per client address.
+// Past the free attempts, each further attempt must wait twice as long as the
+// previous one; past LockoutThreshold, the username is locked out.
+type LoginThrottleConfig struct {
+	FreeAttempts     int           // Failures per username before backing off
+	IPFreeAttempts   int           // Failures per client address before backing off
+	BaseDelay        time.Duration // First backoff delay
+	MaxDelay         time.Duration // Longest backoff delay
+	LockoutThreshold int           // Failures per username locking it out, 0 disables lockouts
+	LockoutDuration  time.Duration // How long lockouts last
+	FailureWindow    time.Duration // Failures are forgotten after this long without attempts
+}
+
+// OIDCProviderConfig holds the configuration of an OpenID Connect provider.
+// Each provider listed in OIDC_PROVIDERS is configured by the variables
+// OIDC_<ID>_ISSUER, OIDC_<ID>_CLIENT_ID, ... with <ID> in upper case.
+type OIDCProviderConfig struct {
+	ID           string // Used in URLs and in the auth provider of users
+	Name         string // Shown on the login page
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+
+	// Claims used to fill the fields of provisioned users. Usernames get
+	// the provider ID as suffix, e.g. jdoe@partner.
+	UsernameClaim  string
+	EmailClaim     string
+	FirstNameClaim string
+	LastNameClaim  string
+
+	// TrustUnverifiedEmail accepts emails the provider has not verified
+	// (email_verified). Off by default: users of a provider that lets them
+	// enter any address could claim the email of another account.
+	TrustUnverifiedEmail bool
 }
 
 // LDAPConfig holds LDAP-specific configuration
 type LDAPConfig struct {
-	URL          string
+	URLs         []string // Servers tried in order, e.g. a primary and its replicas
 	BaseDN       string
 	BindDN       string
 	BindPassword string
 	UserFilter   string
 	UserBaseDN   string
+	GroupFilter  string // Filter finding a group by name, with %s the name
+	GroupBaseDN  string
+
+	// StartTLS upgrades ldap:// connections to TLS; ldaps:// URLs always use
+	// TLS. CACertFile is a PEM bundle trusted in addition to the system
+	// roots and TLSServerName overrides the host name that is verified.
+	StartTLS      bool
+	CACertFile    string
+	TLSServerName string
+
+	// PoolSize bounds the number of connections bound as BindDN
+	PoolSize       int
+	DialTimeout    time.Duration
+	RequestTimeout time.Duration
+
+	// GroupMembership is how the groups of a user are found: "memberof"
+	// reads the memberOf attribute, "search" searches the group entries
+	GroupMembership string
+
+	// RoleMappingFile is a YAML file mapping LDAP groups to roles, see
+	// LoadLDAPRoleMappings. Empty disables the mappings.
+	RoleMappingFile string
+
+	// SyncInterval is how often the roles of LDAP users are synchronized in
+	// the background. Zero disables the synchronization.
+	SyncInterval time.Duration
 }
 
 // JWTConfig holds JWT-specific configuration
 type JWTConfig struct {
-	Secret          string
-	ExpirationHours int
+	Secret           string        // HS256 secret, used when there is no signing key
+	SigningKeyFile   string        // PEM RSA or Ed25519 private key tokens are signed with
+	PreviousKeyFiles []string      // PEM keys of previous rotations, still accepted for verification
+	ExpirationHours  int           // Lifetime of sessions since their last refresh
+	AccessTokenTTL   time.Duration // Lifetime of access tokens, renewed with the refresh token
 }
 
 var config *Config
@@ -45,22 +148,67 @@ func LoadConfig() *Config {
 
 	config = &Config{
 		LDAP: LDAPConfig{
-			URL:          getEnv("LDAP_URL", "ldap://openldap:389"),
-			BaseDN:       getEnv("LDAP_BASE_DN", "dc=ironsnake,dc=local"),
-			BindDN:       getEnv("LDAP_BIND_DN", "cn=admin,dc=ironsnake,dc=local"),
-			BindPassword: getEnv("LDAP_BIND_PASSWORD", "admin"),
-			UserFilter:   getEnv("LDAP_USER_FILTER", "(uid=%s)"),
-			UserBaseDN:   getEnv("LDAP_USER_BASE_DN", "ou=users,dc=ironsnake,dc=local"),
+			URLs:            splitList(getEnv("LDAP_URL", "ldap://openldap:389")),
+			BaseDN:          getEnv("LDAP_BASE_DN", "dc=ironsnake,dc=local"),
+			BindDN:          getEnv("LDAP_BIND_DN", "cn=admin,dc=ironsnake,dc=local"),
+			BindPassword:    getEnv("LDAP_BIND_PASSWORD", "admin"),
+			UserFilter:      getEnv("LDAP_USER_FILTER", "(uid=%s)"),
+			UserBaseDN:      getEnv("LDAP_USER_BASE_DN", "ou=users,dc=ironsnake,dc=local"),
+			GroupFilter:     getEnv("LDAP_GROUP_FILTER", "(&(|(objectClass=groupOfNames)(objectClass=groupOfUniqueNames)(objectClass=posixGroup))(cn=%s))"),
+			GroupBaseDN:     getEnv("LDAP_GROUP_BASE_DN", "ou=groups,dc=ironsnake,dc=local"),
+			GroupMembership: getEnv("LDAP_GROUP_MEMBERSHIP", "search"),
+			RoleMappingFile: os.Getenv("LDAP_ROLE_MAPPING_FILE"),
+			SyncInterval:    getEnvDuration("LDAP_SYNC_INTERVAL", time.Hour),
+			StartTLS:        getEnv("LDAP_START_TLS", "false") == "true",
+			CACertFile:      os.Getenv("LDAP_CA_CERT_FILE"),
+			TLSServerName:   os.Getenv("LDAP_TLS_SERVER_NAME"),
+			PoolSize:        getEnvInt("LDAP_POOL_SIZE", 4),
+			DialTimeout:     getEnvDuration("LDAP_DIAL_TIMEOUT", 5*time.Second),
+			RequestTimeout:  getEnvDuration("LDAP_TIMEOUT", 10*time.Second),
 		},
 		JWT: JWTConfig{
-			Secret:          getEnv("JWT_SECRET", ""),
-			ExpirationHours: expirationHours,
+			Secret:           getEnv("JWT_SECRET", ""),
+			SigningKeyFile:   os.Getenv("JWT_SIGNING_KEY"),
+			PreviousKeyFiles: splitList(os.Getenv("JWT_PREVIOUS_KEYS")),
+			ExpirationHours:  expirationHours,
+			AccessTokenTTL:   getEnvDuration("JWT_ACCESS_TTL", 15*time.Minute),
+		},
+		APIBasePath:    strings.TrimSuffix(getEnv("API_BASE_PATH", "/api"), "/"),
+		PlatformAdmins: splitList(os.Getenv("PLATFORM_ADMINS")),
+		PublicURL:      strings.TrimSuffix(getEnv("PUBLIC_URL", "http://localhost"), "/"),
+		Mail: mail.Config{
+			Backend:      getEnv("MAIL_BACKEND", "log"),
+			From:         getEnv("MAIL_FROM", "IronSnake <noreply@ironsnake.local>"),
+			SMTPHost:     os.Getenv("SMTP_HOST"),
+			SMTPPort:     getEnvInt("SMTP_PORT", 587),
+			SMTPUsername: os.Getenv("SMTP_USERNAME"),
+			SMTPPassword: os.Getenv("SMTP_PASSWORD"),
+			SMTPTLS:      getEnv("SMTP_TLS", "false") == "true",
+			Dir:          getEnv("MAIL_DIR", "mail"),
+		},
+		SelfRegistration:    getEnv("SELF_REGISTRATION", "false") == "true",
+		RegistrationDomains: splitList(os.Getenv("REGISTRATION_EMAIL_DOMAINS")),
+		LoginThrottle: LoginThrottleConfig{
+			FreeAttempts:     getEnvInt("LOGIN_FREE_ATTEMPTS", 3),
+			IPFreeAttempts:   getEnvInt("LOGIN_IP_FREE_ATTEMPTS", 20),
+			BaseDelay:        getEnvDuration("LOGIN_BACKOFF_BASE", time.Second),
+			MaxDelay:         getEnvDuration("LOGIN_BACKOFF_MAX", 5*time.Minute),
+			LockoutThreshold: getEnvInt("LOGIN_LOCKOUT_THRESHOLD", 10),
+			LockoutDuration:  getEnvDuration("LOGIN_LOCKOUT_DURATION", 15*time.Minute),
+			FailureWindow:    getEnvDuration("LOGIN_FAILURE_WINDOW", time.Hour),
 		},
 	}
 
+	trustedProxies, err := parseNetworks(getEnv("TRUSTED_PROXIES", "127.0.0.1,::1"))
+	if err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
+	config.TrustedProxies = trustedProxies
+	config.OIDCProviders = loadOIDCProviders(getEnv("OIDC_REDIRECT_BASE_URL", "http://localhost"+config.APIBasePath))
+
 	// Validate required configuration
-	if config.JWT.Secret == "" {
-		log.Fatal("JWT_SECRET environment variable is required")
+	if config.JWT.Secret == "" && config.JWT.SigningKeyFile == "" {
+		log.Fatal("JWT_SECRET or JWT_SIGNING_KEY environment variable is required")
 	}
 
 	return config
@@ -74,6 +222,63 @@ func GetConfig() *Config {
 	return config
 }
 
+// splitList splits a comma-separated list, dropping empty items
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// loadOIDCProviders loads the configuration of the providers listed in
+// OIDC_PROVIDERS. redirectBaseURL is the public URL of the API, behind the
+// reverse proxy, under which their callback is served.
+func loadOIDCProviders(redirectBaseURL string) []OIDCProviderConfig {
+	var providers []OIDCProviderConfig
+	for _, id := range splitList(os.Getenv("OIDC_PROVIDERS")) {
+		prefix := "OIDC_" + strings.ToUpper(strings.NewReplacer("-", "_", ".", "_").Replace(id)) + "_"
+		providers = append(providers, OIDCProviderConfig{
+			ID:             id,
+			Name:           getEnv(prefix+"NAME", id),
+			Issuer:         os.Getenv(prefix + "ISSUER"),
+			ClientID:       os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret:   os.Getenv(prefix + "CLIENT_SECRET"),
+			RedirectURL:    strings.TrimSuffix(redirectBaseURL, "/") + "/auth/oidc/" + id + "/callback",
+			Scopes:         strings.Fields(getEnv(prefix+"SCOPES", "email profile")),
+			UsernameClaim:  getEnv(prefix+"CLAIM_USERNAME", "preferred_username"),
+			EmailClaim:     getEnv(prefix+"CLAIM_EMAIL", "email"),
+			FirstNameClaim: getEnv(prefix+"CLAIM_FIRST_NAME", "given_name"),
+			LastNameClaim:  getEnv(prefix+"CLAIM_LAST_NAME", "family_name"),
+
+			TrustUnverifiedEmail: getEnv(prefix+"TRUST_UNVERIFIED_EMAIL", "false") == "true",
+		})
+	}
+	return providers
+}
+
+// parseNetworks parses a comma-separated list of CIDR networks or addresses
+func parseNetworks(value string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, item := range splitList(value) {
+		if !strings.Contains(item, "/") {
+			if ip := net.ParseIP(item); ip != nil && ip.To4() != nil {
+				item += "/32"
+			} else {
+				item += "/128"
+			}
+		}
+		_, network, err := net.ParseCIDR(item)
+		if err != nil {
+			return nil, err
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
 // getEnv retrieves an environment variable or returns a default value
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
@@ -81,3 +286,21 @@ func getEnv(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+// getEnvInt retrieves an integer environment variable or returns a default
+// value when it is unset or invalid
+func getEnvInt(key string, defaultValue int) int {
+	if n, err := strconv.Atoi(os.Getenv(key)); err == nil {
+		return n
+	}
+	return defaultValue
+}
+
+// getEnvDuration retrieves a duration environment variable, such as "30s",
+// or returns a default value when it is unset or invalid
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	if d, err := time.ParseDuration(os.Getenv(key)); err == nil {
+		return d
+	}
+	return defaultValue
+}
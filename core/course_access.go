@@ -0,0 +1,60 @@
+package main
+
+import (
+	"time"
+
+	"ironsnake/core/courseparser"
+)
+
+// CourseAccess is what a user may do in a course, each level granting the
+// ones before it
+type CourseAccess int
+
+const (
+	CourseHidden  CourseAccess = iota // The course is not shown at all
+	CourseListed                      // Shown so that the user can register
+	CoursePreview                     // Tasks can be read but not submitted
+	CourseMember                      // Enrolled student or staff
+)
+
+var courseAccessNames = map[CourseAccess]string{
+	CourseHidden:  "hidden",
+	CourseListed:  "listed",
+	CoursePreview: "preview",
+	CourseMember:  "member",
+}
+
+// String returns the name of the access level
+func (a CourseAccess) String() string {
+	return courseAccessNames[a]
+}
+
+// resolveCourseAccess returns the access a role gives to a course. Courses
+// that are not accessible are only shown to their staff; allow_preview lets
+// users who did not register read the tasks.
+func resolveCourseAccess(course *courseparser.ParsedCourse, role CourseRole) CourseAccess {
+	switch {
+	case role >= RoleTutor:
+		return CourseMember
+	case !course.Config.Accessible:
+		return CourseHidden
+	case role == RoleStudent:
+		return CourseMember
+	case course.Config.AllowPreview:
+		return CoursePreview
+	}
+	return CourseListed
+}
+
+// isTaskAccessible reports whether students can currently see a task, as
+// set in access.yaml. Tasks without an entry are closed.
+func isTaskAccessible(course *courseparser.ParsedCourse, taskID string, now time.Time) bool {
+	access := course.Access.DispenserData.Config[taskID].Accessibility
+	return access.Status(now) == courseparser.AccessOpen
+}
+
+// CanSeeTask reports whether the user may read and submit a task at a given
+// time: staff always, others only while it is open
+func (c *CourseContext) CanSeeTask(taskID string, now time.Time) bool {
+	return c.Staff() || isTaskAccessible(c.Course, taskID, now)
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"testing"
+
+	"ironsnake/core/courseparser"
+)
+
+func TestResolveCourseAccess(t *testing.T) {
+	tests := []struct {
+		name         string
+		accessible   bool
+		allowPreview bool
+		role         CourseRole
+		want         CourseAccess
+	}{
+		{"staff of a hidden course", false, false, RoleAdmin, CourseMember},
+		{"tutor of a hidden course", false, false, RoleTutor, CourseMember},
+		{"student of a hidden course", false, true, RoleStudent, CourseHidden},
+		{"visitor of a hidden course", false, true, RoleNone, CourseHidden},
+		{"student", true, false, RoleStudent, CourseMember},
+		{"tutor", true, false, RoleTutor, CourseMember},
+		{"visitor", true, false, RoleNone, CourseListed},
+		{"visitor with preview", true, true, RoleNone, CoursePreview},
+		{"student with preview", true, true, RoleStudent, CourseMember},
+	}
+	for _, tt := range tests {
+		course := &courseparser.ParsedCourse{
+			CourseID: "CS01",
+			Config:   courseparser.CourseConfig{Accessible: tt.accessible, AllowPreview: tt.allowPreview},
+		}
+		if got := resolveCourseAccess(course, tt.role); got != tt.want {
+			t.Errorf("%s: resolveCourseAccess() = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"ironsnake/core/courseparser"
+)
+
+// maxUploadSize limits the size of uploaded course archives
+const maxUploadSize = 100 << 20
+
+// CourseImportResponse describes the result of a course import
+type CourseImportResponse struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	TaskCount int    `json:"taskCount"`
+	Replaced  bool   `json:"replaced"`
+	INGInious bool   `json:"inginious"`
+}
+
+// canCreateCourses reports whether a user may import new courses: platform
+// administrators and teachers, that is users who administer a course or have
+// a teaching assignment.
+func canCreateCourses(user *User) bool {
+	if isPlatformAdmin(user) {
+		return true
+	}
+	for _, course := range courseCatalog.List() {
+		if staticRole(user, course) == RoleAdmin {
+			return true
+		}
+	}
+
+	var count int64
+	DB.Model(&CourseTeacher{}).Where("teacher_id = ?", user.ID).Count(&count)
+	return count > 0
+}
+
+// importCourseHandler imports a zip or tar.gz course archive, sent either as
+// the request body or as the "archive" field of a multipart form.
+// Query parameters: id (course ID) and onConflict (fail, rename or replace).
+func importCourseHandler(w http.ResponseWriter, r *http.Request) {
+	user, err := GetUserFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if !canCreateCourses(user) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	courseID := r.URL.Query().Get("id")
+	if courseID != "" && !courseparser.ValidID(courseID) {
+		http.Error(w, "Invalid course ID", http.StatusBadRequest)
+		return
+	}
+
+	policy := courseparser.ConflictPolicy(r.URL.Query().Get("onConflict"))
+	switch policy {
+	case "", courseparser.ConflictFail, courseparser.ConflictRename, courseparser.ConflictReplace:
+	default:
+		http.Error(w, "onConflict must be fail, rename or replace", http.StatusBadRequest)
+		return
+	}
+
+	// Store the upload in a temporary file: zip archives need random access
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize)
+	upload, filename, err := receiveArchive(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer os.Remove(upload)
+
+	result, err := courseparser.ImportArchive(CoursesDir, upload, courseparser.ImportOptions{
+		CourseID:   courseID,
+		FallbackID: archiveBaseName(filename),
+		OnConflict: policy,
+		CanReplace: func(id string) bool {
+			existing, ok := courseCatalog.Get(id)
+			return ok && isCourseAdmin(user, existing)
+		},
+		Admins: []string{user.Username},
+		// A replaced course must not be written to by WebDAV or the task
+		// editor while it is swapped and reloaded
+		Install: func(id string, install func() error) error {
+			lock := courseEditLock(id)
+			lock.Lock()
+			defer lock.Unlock()
+
+			if err := install(); err != nil {
+				return err
+			}
+			if err := courseCatalog.Reload(id); err != nil {
+				log.Printf("Failed to reload imported course %s: %v", id, err)
+			}
+			return nil
+		},
+	})
+	if err != nil {
+		var parseErr *courseparser.ParseError
+		var loadErr *courseparser.CourseLoadError
+		switch {
+		case errors.Is(err, courseparser.ErrCourseExists):
+			http.Error(w, err.Error(), http.StatusConflict)
+		case errors.As(err, &parseErr), errors.As(err, &loadErr):
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		default:
+			log.Printf("Error importing course archive: %v", err)
+			http.Error(w, "Failed to import course", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	log.Printf("Course %s imported by %s (replaced: %v, INGInious: %v)", result.CourseID, user.Username, result.Replaced, result.INGInious)
+
+	response := CourseImportResponse{
+		ID:        result.CourseID,
+		Name:      result.Course.Config.Name,
+		TaskCount: len(result.Course.Tasks),
+		Replaced:  result.Replaced,
+		INGInious: result.INGInious,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+// receiveArchive writes the uploaded archive to a temporary file and returns
+// its path together with the client-side file name, if any
+func receiveArchive(r *http.Request) (string, string, error) {
+	var body io.Reader = r.Body
+	filename := ""
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "multipart/form-data" {
+		file, header, err := r.FormFile("archive")
+		if err != nil {
+			return "", "", fmt.Errorf("missing archive file")
+		}
+		defer file.Close()
+		body = file
+		filename = header.Filename
+	}
+
+	tmp, err := os.CreateTemp("", "course-upload-*")
+	if err != nil {
+		return "", "", err
+	}
+	defer tmp.Close()
+
+	if _, err := io.Copy(tmp, body); err != nil {
+		os.Remove(tmp.Name())
+		return "", "", fmt.Errorf("failed to read archive: %w", err)
+	}
+	return tmp.Name(), filename, nil
+}
+
+// archiveBaseName strips the directory and archive extension of a file name
+func archiveBaseName(filename string) string {
+	filename = filename[strings.LastIndexAny(filename, `/\`)+1:]
+	for _, ext := range []string{".tar.gz", ".tgz", ".zip"} {
+		if strings.HasSuffix(strings.ToLower(filename), ext) {
+			return filename[:len(filename)-len(ext)]
+		}
+	}
+	return filename
+}
+
+// exportCourseHandler downloads a course as a zip or tar.gz archive
+// (query parameter format, zip by default)
+func exportCourseHandler(w http.ResponseWriter, r *http.Request, cc *CourseContext) {
+	course := cc.Course
+
+	format, err := courseparser.ParseArchiveFormat(r.URL.Query().Get("format"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	contentType := "application/zip"
+	if format == courseparser.ArchiveTarGz {
+		contentType = "application/gzip"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{
+		"filename": courseparser.ArchiveName(course.CourseID, format, time.Now()),
+	}))
+
+	if err := courseparser.ExportArchive(w, course.DirPath, format); err != nil {
+		// Headers are already sent, the client sees a truncated archive
+		log.Printf("Error exporting course %s: %v", course.CourseID, err)
+	}
+}
@@ -2,10 +2,11 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
-	"path/filepath"
 	"strings"
+	"time"
 
 	"ironsnake/core/courseparser"
 )
@@ -13,31 +14,162 @@ import (
 // CoursesDir is the path to the courses directory
 var CoursesDir = "courses"
 
+// courseCatalog holds the parsed courses of CoursesDir
+var courseCatalog *courseparser.Catalog
+
+// InitCourseCatalog loads every course of CoursesDir into memory
+func InitCourseCatalog() {
+	courseCatalog = courseparser.NewCatalog(CoursesDir)
+	if err := courseCatalog.Load(); err != nil {
+		log.Printf("Some courses failed to load: %v", err)
+	}
+}
+
+// isCourseAdmin reports whether the user is an admin of the course
+func isCourseAdmin(user *User, course *courseparser.ParsedCourse) bool {
+	role, err := ResolveCourseRole(user, course)
+	if err != nil {
+		log.Printf("Error resolving the role of %s in course %s: %v", user.Username, course.CourseID, err)
+	}
+	return role == RoleAdmin
+}
+
+// courseTags returns the tags of the course the user may see. Hidden tags are
+// only shown to course staff.
+func courseTags(course *courseparser.ParsedCourse, staff bool) []TagResponse {
+	tags := make([]TagResponse, 0, len(course.Config.Tags))
+	for _, tag := range course.Config.TagList() {
+		if !tag.Visible && !staff {
+			continue
+		}
+		tags = append(tags, TagResponse{
+			ID:          tag.ID,
+			Name:        tag.Name,
+			Description: tag.Description,
+			Visible:     tag.Visible,
+			Type:        tag.Type.String(),
+		})
+	}
+	return tags
+}
+
+// taskTags returns the IDs of the tags of a task the user may see
+func taskTags(course *courseparser.ParsedCourse, task *courseparser.TaskConfig, staff bool) []string {
+	tags := make([]string, 0, len(task.Categories))
+	for _, id := range task.Categories {
+		tag, ok := course.Config.TagByID(id)
+		if !ok || (!tag.Visible && !staff) {
+			continue
+		}
+		tags = append(tags, id)
+	}
+	return tags
+}
+
+// hasAllTags reports whether every wanted tag ID is in tags
+func hasAllTags(tags []string, wanted []string) bool {
+	for _, want := range wanted {
+		found := false
+		for _, tag := range tags {
+			if tag == want {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// taskResponse builds the summary of a task shown to the user
+func taskResponse(course *courseparser.ParsedCourse, taskID string, task *courseparser.TaskConfig, staff bool) TaskResponse {
+	problems := make([]ProblemResponse, 0, task.Problems.Len())
+	for _, op := range task.Problems.Problems {
+		problems = append(problems, ProblemResponse{
+			ID:     op.ID,
+			Type:   op.Problem.GetType(),
+			Name:   op.Problem.GetName(),
+			Header: op.Problem.GetHeader(),
+		})
+	}
+
+	return TaskResponse{
+		ID:              taskID,
+		Name:            task.Name,
+		Author:          task.Author,
+		EnvironmentType: task.EnvironmentType,
+		Tags:            taskTags(course, task, staff),
+		Problems:        problems,
+	}
+}
+
+// courseResponse builds the summary of a course shown to a user with the
+// given role
+func courseResponse(course *courseparser.ParsedCourse, role CourseRole, enrolled bool) CourseResponse {
+	staff := role >= RoleTutor
+	return CourseResponse{
+		ID:                   course.CourseID,
+		Code:                 course.CourseID,
+		Name:                 course.Config.Name,
+		Accessible:           course.Config.Accessible,
+		Admins:               course.Config.Admins,
+		Tutors:               course.Config.Tutors,
+		TaskCount:            len(course.Tasks),
+		Tags:                 courseTags(course, staff),
+		Enrolled:             enrolled,
+		Role:                 role.String(),
+		Access:               resolveCourseAccess(course, role).String(),
+		GroupsStudentChoice:  course.Config.GroupsStudentChoice,
+		Registration:         course.Config.Registration,
+		RegistrationPassword: course.Config.RequiresRegistrationPassword(),
+		AllowUnregister:      course.Config.AllowUnregister,
+	}
+}
+
+// getCoursesHandler lists the courses the user can see with the user's role
+// in them. Passing one or more ?tag= parameters only lists the courses
+// defining all of these tags.
 func getCoursesHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	loader := courseparser.NewCourseLoader()
-	courses, err := loader.LoadAllCourses(CoursesDir)
+	user, err := GetUserFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	wantedTags := r.URL.Query()["tag"]
+
+	assignments, err := loadRoleAssignments(user.ID)
 	if err != nil {
-		http.Error(w, "Failed to load courses", http.StatusInternalServerError)
-		log.Printf("Error loading courses: %v", err)
+		log.Printf("Error listing courses: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
-	response := make([]CourseResponse, len(courses))
-	for i, course := range courses {
-		response[i] = CourseResponse{
-			ID:         course.CourseID,
-			Code:       course.CourseID,
-			Name:       course.Config.Name,
-			Accessible: course.Config.Accessible,
-			Admins:     course.Config.Admins,
-			Tutors:     course.Config.Tutors,
-			TaskCount:  len(course.Tasks),
+	courses := courseCatalog.List()
+
+	response := make([]CourseResponse, 0, len(courses))
+	for _, course := range courses {
+		role := assignments.role(user, course)
+		if resolveCourseAccess(course, role) == CourseHidden || !impersonatedCourseAllowed(r, course.CourseID) {
+			continue
 		}
+		item := courseResponse(course, role, assignments.enrolled[course.CourseID])
+		if len(wantedTags) > 0 {
+			ids := make([]string, len(item.Tags))
+			for i, tag := range item.Tags {
+				ids[i] = tag.ID
+			}
+			if !hasAllTags(ids, wantedTags) {
+				continue
+			}
+		}
+		response = append(response, item)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -48,7 +180,7 @@ func getCoursesHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 // submitMCQHandler handles POST requests for MCQ submissions
-func submitMCQHandler(w http.ResponseWriter, r *http.Request) {
+func submitMCQHandler(w http.ResponseWriter, r *http.Request, cc *CourseContext) {
 	// Set CORS headers
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
@@ -65,28 +197,31 @@ func submitMCQHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Extract IDs from URL path (format: /courses/:courseID/tasks/:taskID)
-	path := r.URL.Path
-	remaining := path[len("/courses/"):]
-
-	// Find the /tasks/ separator
-	tasksIdx := -1
-	for i := 0; i < len(remaining)-6; i++ {
-		if remaining[i:i+7] == "/tasks/" {
-			tasksIdx = i
-			break
-		}
-	}
+	courseID := r.PathValue("courseID")
+	taskID := r.PathValue("taskID")
 
-	if tasksIdx == -1 {
-		http.Error(w, "Invalid URL format", http.StatusBadRequest)
+	if courseID == "" || taskID == "" {
+		http.Error(w, "Course ID and Task ID are required", http.StatusBadRequest)
 		return
 	}
 
-	courseID := remaining[:tasksIdx]
-	taskID := remaining[tasksIdx+7:]
+	course := cc.Course
 
-	if courseID == "" || taskID == "" {
-		http.Error(w, "Course ID and Task ID are required", http.StatusBadRequest)
+	// Students only submit while the task is open, as set in access.yaml
+	if _, ok := course.Tasks[taskID]; ok && !cc.CanSeeTask(taskID, time.Now()) {
+		http.Error(w, "Forbidden: this task is not open for submissions", http.StatusForbidden)
+		return
+	}
+
+	// Group tasks are submitted for the group of the student
+	groupID, err := submissionGroup(cc, taskID)
+	if errors.Is(err, errNoGroup) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("Error submitting task %s: %v", taskID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
@@ -98,16 +233,6 @@ func submitMCQHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Load the course
-	loader := courseparser.NewCourseLoader()
-	coursePath := filepath.Join(CoursesDir, courseID)
-	course, err := loader.LoadCourse(coursePath)
-	if err != nil {
-		http.Error(w, "Course not found", http.StatusNotFound)
-		log.Printf("Error loading course %s: %v", courseID, err)
-		return
-	}
-
 	// Find the task
 	task, ok := course.Tasks[taskID]
 	if !ok {
@@ -164,6 +289,12 @@ func submitMCQHandler(w http.ResponseWriter, r *http.Request) {
 		Correct: correctCount,
 	}
 
+	if err := storeSubmission(cc, taskID, groupID, submission.Answers, &response); err != nil {
+		log.Printf("Error submitting task %s: %v", taskID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(response); err != nil {
 		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
@@ -217,69 +348,50 @@ func gradeMatch(problem *courseparser.MatchProblem, textAnswer string) bool {
 	return expected == given
 }
 
-func getCourseByIDHandler(w http.ResponseWriter, r *http.Request) {
+// getCourseByIDHandler returns a course with its tasks. Passing one or more
+// ?tag= parameters only lists the tasks carrying all of these tags.
+func getCourseByIDHandler(w http.ResponseWriter, r *http.Request, cc *CourseContext) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	// Extract ID from URL path (format: /courses/:id)
-	path := r.URL.Path
-	courseID := path[len("/courses/"):]
+	// Extract ID from URL path (format: /courses/:courseID)
+	courseID := r.PathValue("courseID")
 
 	if courseID == "" {
 		http.Error(w, "Course ID is required", http.StatusBadRequest)
 		return
 	}
 
-	// Load the specific course
-	loader := courseparser.NewCourseLoader()
-	coursePath := filepath.Join(CoursesDir, courseID)
-	course, err := loader.LoadCourse(coursePath)
-	if err != nil {
-		http.Error(w, "Course not found", http.StatusNotFound)
-		log.Printf("Error loading course %s: %v", courseID, err)
-		return
-	}
+	course, staff := cc.Course, cc.Staff()
+	wantedTags := r.URL.Query()["tag"]
 
-	// Build task responses
+	// Build task responses, only listed to users who may read them
+	now := time.Now()
 	tasks := make([]TaskResponse, 0, len(course.Tasks))
 	for taskID, task := range course.Tasks {
-		problems := make([]ProblemResponse, 0, task.Problems.Len())
-		for _, op := range task.Problems.Problems {
-			problems = append(problems, ProblemResponse{
-				ID:     op.ID,
-				Type:   op.Problem.GetType(),
-				Name:   op.Problem.GetName(),
-				Header: op.Problem.GetHeader(),
-			})
+		if !cc.Can(PermReadTasks) {
+			break
 		}
-
-		tasks = append(tasks, TaskResponse{
-			ID:              taskID,
-			Name:            task.Name,
-			Author:          task.Author,
-			EnvironmentType: task.EnvironmentType,
-			Problems:        problems,
-		})
+		if !cc.CanSeeTask(taskID, now) {
+			continue
+		}
+		response := taskResponse(course, taskID, &task, staff)
+		if !hasAllTags(response.Tags, wantedTags) {
+			continue
+		}
+		tasks = append(tasks, response)
 	}
 
 	// Build response
 	response := CourseDetailResponse{
-		CourseResponse: CourseResponse{
-			ID:         course.CourseID,
-			Code:       course.CourseID,
-			Name:       course.Config.Name,
-			Accessible: course.Config.Accessible,
-			Admins:     course.Config.Admins,
-			Tutors:     course.Config.Tutors,
-			TaskCount:  len(course.Tasks),
-		},
-		Tasks: tasks,
+		CourseResponse: courseResponse(course, cc.Role, cc.Enrolled),
+		Tasks:          tasks,
 	}
 
 	// Add syllabus if present
-	if course.Syllabus != nil {
+	if course.Syllabus != nil && cc.Can(PermReadTasks) {
 		response.Syllabus = &SyllabusResponse{
 			Title:   course.Syllabus.Book.Book.Title,
 			Author:  course.Syllabus.Book.Book.Author,
@@ -298,60 +410,37 @@ func convertSummary(entries []courseparser.SummaryEntry) []SummaryEntry {
 	result := make([]SummaryEntry, len(entries))
 	for i, entry := range entries {
 		result[i] = SummaryEntry{
+			Kind:     entry.Kind.String(),
 			Title:    entry.Title,
 			Path:     entry.Path,
+			Number:   entry.Number,
+			Draft:    entry.Draft,
 			Children: convertSummary(entry.Children),
 		}
 	}
 	return result
 }
 
-func getTaskByIDHandler(w http.ResponseWriter, r *http.Request) {
+func getTaskByIDHandler(w http.ResponseWriter, r *http.Request, cc *CourseContext) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
 	// Extract IDs from URL path (format: /courses/:courseID/tasks/:taskID)
-	path := r.URL.Path
-	// Remove prefix "/courses/"
-	remaining := path[len("/courses/"):]
-
-	// Find the /tasks/ separator
-	tasksIdx := -1
-	for i := 0; i < len(remaining)-6; i++ {
-		if remaining[i:i+7] == "/tasks/" {
-			tasksIdx = i
-			break
-		}
-	}
-
-	if tasksIdx == -1 {
-		http.Error(w, "Invalid URL format", http.StatusBadRequest)
-		return
-	}
-
-	courseID := remaining[:tasksIdx]
-	taskID := remaining[tasksIdx+7:] // +7 for "/tasks/"
+	courseID := r.PathValue("courseID")
+	taskID := r.PathValue("taskID")
 
 	if courseID == "" || taskID == "" {
 		http.Error(w, "Course ID and Task ID are required", http.StatusBadRequest)
 		return
 	}
 
-	// Load the course
-	loader := courseparser.NewCourseLoader()
-	coursePath := filepath.Join(CoursesDir, courseID)
-	course, err := loader.LoadCourse(coursePath)
-	if err != nil {
-		http.Error(w, "Course not found", http.StatusNotFound)
-		log.Printf("Error loading course %s: %v", courseID, err)
-		return
-	}
+	course := cc.Course
 
-	// Find the task
+	// Find the task, hidden from students while it is not open
 	task, ok := course.Tasks[taskID]
-	if !ok {
+	if !ok || !cc.CanSeeTask(taskID, time.Now()) {
 		http.Error(w, "Task not found", http.StatusNotFound)
 		log.Printf("Task %s not found in course %s", taskID, courseID)
 		return
@@ -401,6 +490,8 @@ func getTaskByIDHandler(w http.ResponseWriter, r *http.Request) {
 		EnvironmentID:   task.EnvironmentID,
 		EnvironmentType: task.EnvironmentType,
 		NetworkGrading:  task.NetworkGrading,
+		GroupSubmission: isGroupTask(cc, taskID),
+		Tags:            taskTags(course, &task, cc.Staff()),
 		Problems:        problems,
 	}
 
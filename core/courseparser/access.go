@@ -73,6 +73,22 @@ func (a *TaskAccessibility) UnmarshalYAML(node *yaml.Node) error {
 	return nil
 }
 
+// MarshalYAML writes the accessibility back in the form it was parsed from:
+// a boolean, or a "start/deadline/soft_deadline" date range
+func (a TaskAccessibility) MarshalYAML() (interface{}, error) {
+	if a.IsBoolean || a.DateRange == nil {
+		return a.BoolValue, nil
+	}
+	return a.DateRange.String(), nil
+}
+
+// String formats the date range as "start/deadline/soft_deadline"
+func (r *AccessibilityDateRange) String() string {
+	return r.Start.Format(dateTimeLayout) + "/" +
+		r.Deadline.Format(dateTimeLayout) + "/" +
+		r.SoftDeadline.Format(dateTimeLayout)
+}
+
 // IsAccessible returns whether the task is currently accessible
 func (a *TaskAccessibility) IsAccessible() bool {
 	if a.IsBoolean {
@@ -85,6 +101,35 @@ func (a *TaskAccessibility) IsAccessible() bool {
 	return now.After(a.DateRange.Start) && now.Before(a.DateRange.Deadline)
 }
 
+// AccessStatus is whether a task can be worked on at a given time
+type AccessStatus string
+
+const (
+	AccessOpen     AccessStatus = "open"     // The task is accessible
+	AccessUpcoming AccessStatus = "upcoming" // The task opens later
+	AccessClosed   AccessStatus = "closed"   // The task is closed or past its deadline
+)
+
+// Status returns the access status of the task at the given time
+func (a *TaskAccessibility) Status(now time.Time) AccessStatus {
+	if a.IsBoolean {
+		if a.BoolValue {
+			return AccessOpen
+		}
+		return AccessClosed
+	}
+	if a.DateRange == nil {
+		return AccessClosed
+	}
+	switch {
+	case now.Before(a.DateRange.Start):
+		return AccessUpcoming
+	case now.Before(a.DateRange.Deadline):
+		return AccessOpen
+	}
+	return AccessClosed
+}
+
 // SubmissionLimit defines rate limiting for task submissions
 type SubmissionLimit struct {
 	Amount int `yaml:"amount"` // Maximum submissions allowed
@@ -94,9 +139,10 @@ type SubmissionLimit struct {
 // TaskAccessConfig represents the configuration for a single task's access
 type TaskAccessConfig struct {
 	Accessibility       TaskAccessibility `yaml:"accessibility"`
-	EvaluationMode      string            `yaml:"evaluation_mode,omitempty"`      // "best" or "last"
+	EvaluationMode      string            `yaml:"evaluation_mode,omitempty"`       // "best" or "last"
 	NoStoredSubmissions int               `yaml:"no_stored_submissions,omitempty"` // Max stored submissions
 	SubmissionLimit     *SubmissionLimit  `yaml:"submission_limit,omitempty"`
+	GroupSubmission     bool              `yaml:"group_submission,omitempty"` // Submitted once for the whole group
 }
 
 // DispenserData represents the dispenser_data section
@@ -122,6 +168,11 @@ func ParseAccessConfig(path string) (*AccessConfig, error) {
 		}
 	}
 
+	return ParseAccessConfigData(path, data)
+}
+
+// ParseAccessConfigData parses the contents of a access.yaml file; path is only used in errors
+func ParseAccessConfigData(path string, data []byte) (*AccessConfig, error) {
 	var config AccessConfig
 	if err := yaml.Unmarshal(data, &config); err != nil {
 		return nil, &ParseError{
@@ -0,0 +1,553 @@
+package courseparser
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ArchiveFormat is the format of a course archive
+type ArchiveFormat string
+
+const (
+	ArchiveZip   ArchiveFormat = "zip"
+	ArchiveTarGz ArchiveFormat = "tar.gz"
+)
+
+// ConflictPolicy decides what happens when an imported course ID already exists
+type ConflictPolicy string
+
+const (
+	ConflictFail    ConflictPolicy = "fail"    // Refuse the import
+	ConflictRename  ConflictPolicy = "rename"  // Import under a new, unused ID
+	ConflictReplace ConflictPolicy = "replace" // Replace the existing course
+)
+
+// Limits applied to imported archives
+const (
+	DefaultMaxArchiveSize = 200 << 20 // Total uncompressed size
+	maxArchiveEntries     = 10000
+)
+
+// ErrCourseExists is returned when an imported course ID is already taken
+var ErrCourseExists = errors.New("course already exists")
+
+// ImportOptions controls how a course archive is imported
+type ImportOptions struct {
+	// CourseID is the ID of the imported course. When empty, the name of the
+	// archive's top-level directory is used, or FallbackID.
+	CourseID   string
+	FallbackID string
+
+	OnConflict ConflictPolicy
+
+	// CanReplace is consulted before an existing course is replaced. A nil
+	// function allows every replacement.
+	CanReplace func(courseID string) bool
+
+	// Admins are added to the admins of the imported course if missing
+	Admins []string
+
+	// Install, if not nil, is called with the final course ID and must run
+	// install, which moves the course into place, e.g. holding a lock
+	// against other writers of the course and reloading it afterwards
+	Install func(courseID string, install func() error) error
+
+	// MaxSize limits the total uncompressed size (DefaultMaxArchiveSize if 0)
+	MaxSize int64
+}
+
+// ImportResult describes an imported course
+type ImportResult struct {
+	CourseID  string
+	Course    *ParsedCourse
+	Replaced  bool // An existing course was replaced
+	INGInious bool // The archive was converted from the INGInious layout
+}
+
+// ImportArchive extracts a zip or tar.gz course archive into coursesDir.
+// The content is extracted to a temporary directory first, converted from the
+// INGInious layout if needed, and fully parsed before it is moved into place,
+// so a failed import never leaves a partial course behind.
+func ImportArchive(coursesDir, archivePath string, opts ImportOptions) (*ImportResult, error) {
+	if opts.MaxSize <= 0 {
+		opts.MaxSize = DefaultMaxArchiveSize
+	}
+	if opts.OnConflict == "" {
+		opts.OnConflict = ConflictFail
+	}
+
+	tmpDir, err := os.MkdirTemp(coursesDir, ".import-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create import directory: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	extractDir := filepath.Join(tmpDir, "extract")
+	if err := extractArchive(archivePath, extractDir, opts.MaxSize); err != nil {
+		return nil, err
+	}
+
+	// Archives usually wrap the course in a single top-level directory
+	root, rootName, err := findCourseRoot(extractDir)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ImportResult{}
+	converted, err := NormalizeINGInious(root)
+	if err != nil {
+		return nil, err
+	}
+	result.INGInious = converted
+
+	if len(opts.Admins) > 0 {
+		if err := addCourseAdmins(filepath.Join(root, "config.yaml"), opts.Admins); err != nil {
+			return nil, err
+		}
+	}
+
+	// Validate the whole course before it becomes visible
+	if _, err := NewCourseLoader().LoadCourse(root); err != nil {
+		return nil, err
+	}
+
+	courseID := opts.CourseID
+	if courseID == "" {
+		courseID = rootName
+	}
+	if courseID == "" {
+		courseID = opts.FallbackID
+	}
+	if !ValidID(courseID) {
+		return nil, fmt.Errorf("invalid course ID %q", courseID)
+	}
+
+	target := filepath.Join(coursesDir, courseID)
+	if _, err := os.Stat(target); err == nil && opts.OnConflict == ConflictRename {
+		courseID, err = unusedCourseID(coursesDir, courseID)
+		if err != nil {
+			return nil, err
+		}
+		target = filepath.Join(coursesDir, courseID)
+	}
+
+	install := func() error {
+		if _, err := os.Stat(target); err != nil {
+			if err := os.Rename(root, target); err != nil {
+				return fmt.Errorf("failed to install course: %w", err)
+			}
+			return nil
+		}
+
+		if opts.OnConflict != ConflictReplace || (opts.CanReplace != nil && !opts.CanReplace(courseID)) {
+			return fmt.Errorf("%w: %s", ErrCourseExists, courseID)
+		}
+		// Move the old course aside so it can be restored on failure
+		old := filepath.Join(tmpDir, "previous")
+		if err := os.Rename(target, old); err != nil {
+			return fmt.Errorf("failed to move existing course: %w", err)
+		}
+		if err := os.Rename(root, target); err != nil {
+			os.Rename(old, target)
+			return fmt.Errorf("failed to install course: %w", err)
+		}
+		result.Replaced = true
+		return nil
+	}
+	if opts.Install != nil {
+		err = opts.Install(courseID, install)
+	} else {
+		err = install()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	course, err := NewCourseLoader().LoadCourse(target)
+	if err != nil {
+		return nil, err
+	}
+
+	result.CourseID = courseID
+	result.Course = course
+	return result, nil
+}
+
+// unusedCourseID returns the first of id-2, id-3, ... that is not taken
+func unusedCourseID(coursesDir, id string) (string, error) {
+	for i := 2; i < 1000; i++ {
+		candidate := fmt.Sprintf("%s-%d", id, i)
+		if _, err := os.Stat(filepath.Join(coursesDir, candidate)); os.IsNotExist(err) {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("%w: no free ID for %s", ErrCourseExists, id)
+}
+
+// findCourseRoot returns the directory holding the course files: dir itself,
+// or its only subdirectory when the archive wraps the course in one. The name
+// of that subdirectory is returned as well.
+func findCourseRoot(dir string) (string, string, error) {
+	if isCourseRoot(dir) {
+		return dir, "", nil
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", "", err
+	}
+	var subdirs []os.DirEntry
+	for _, entry := range entries {
+		if entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") && entry.Name() != "__MACOSX" {
+			subdirs = append(subdirs, entry)
+		}
+	}
+	if len(subdirs) == 1 {
+		sub := filepath.Join(dir, subdirs[0].Name())
+		if isCourseRoot(sub) {
+			return sub, subdirs[0].Name(), nil
+		}
+	}
+
+	return "", "", &ParseError{
+		File:    "archive",
+		Message: "no config.yaml or INGInious course.yaml found",
+	}
+}
+
+// isCourseRoot reports whether dir contains a course configuration
+func isCourseRoot(dir string) bool {
+	for _, name := range []string{"config.yaml", ingCourseFile} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// addCourseAdmins adds usernames to the admins of a config.yaml
+func addCourseAdmins(configPath string, admins []string) error {
+	config, err := ParseCourseConfig(configPath)
+	if err != nil {
+		return err
+	}
+
+	changed := false
+	for _, admin := range admins {
+		found := false
+		for _, existing := range config.Admins {
+			if existing == admin {
+				found = true
+				break
+			}
+		}
+		if !found {
+			config.Admins = append(config.Admins, admin)
+			changed = true
+		}
+	}
+
+	if !changed {
+		return nil
+	}
+	return WriteCourseConfig(configPath, config)
+}
+
+// extractArchive extracts a zip or tar.gz archive into dest, detecting the
+// format from its content. Entries that would escape dest, links and special
+// files are refused.
+func extractArchive(archivePath, dest string, maxSize int64) error {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	header := make([]byte, 4)
+	n, _ := io.ReadFull(f, header)
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(dest, 0755); err != nil {
+		return err
+	}
+
+	switch {
+	case n >= 4 && bytes.Equal(header, []byte("PK\x03\x04")):
+		info, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		return extractZip(f, info.Size(), dest, maxSize)
+	case n >= 2 && header[0] == 0x1f && header[1] == 0x8b:
+		return extractTarGz(f, dest, maxSize)
+	}
+
+	return &ParseError{File: "archive", Message: "unsupported archive format, expected zip or tar.gz"}
+}
+
+// archiveWriter enforces the extraction limits shared by both formats
+type archiveWriter struct {
+	dest    string
+	maxSize int64
+	written int64
+	entries int
+}
+
+// target returns the extraction path of an archive entry
+func (a *archiveWriter) target(name string) (string, error) {
+	a.entries++
+	if a.entries > maxArchiveEntries {
+		return "", &ParseError{File: "archive", Message: fmt.Sprintf("more than %d entries", maxArchiveEntries)}
+	}
+
+	name = strings.ReplaceAll(name, `\`, "/")
+	cleaned := path.Clean(name)
+	if path.IsAbs(name) || cleaned == ".." || strings.HasPrefix(cleaned, "../") || strings.ContainsRune(name, 0) {
+		return "", &ParseError{File: name, Message: "archive entry escapes the course directory"}
+	}
+	return filepath.Join(a.dest, filepath.FromSlash(cleaned)), nil
+}
+
+func (a *archiveWriter) writeFile(name string, r io.Reader, mode fs.FileMode) error {
+	target, err := a.target(name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+
+	// Only keep the executable bit, never setuid or world-writable modes
+	perm := fs.FileMode(0644)
+	if mode&0111 != 0 {
+		perm = 0755
+	}
+	out, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	remaining := a.maxSize - a.written
+	n, err := io.Copy(out, io.LimitReader(r, remaining+1))
+	a.written += n
+	if err != nil {
+		return err
+	}
+	if a.written > a.maxSize {
+		return &ParseError{File: "archive", Message: fmt.Sprintf("uncompressed content is larger than %d bytes", a.maxSize)}
+	}
+	return nil
+}
+
+func (a *archiveWriter) mkdir(name string) error {
+	target, err := a.target(name)
+	if err != nil {
+		return err
+	}
+	return os.MkdirAll(target, 0755)
+}
+
+func extractZip(r io.ReaderAt, size int64, dest string, maxSize int64) error {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return &ParseError{File: "archive", Message: "invalid zip archive", Err: err}
+	}
+
+	a := &archiveWriter{dest: dest, maxSize: maxSize}
+	for _, file := range zr.File {
+		mode := file.Mode()
+		switch {
+		case mode.IsDir():
+			if err := a.mkdir(file.Name); err != nil {
+				return err
+			}
+		case mode.IsRegular():
+			rc, err := file.Open()
+			if err != nil {
+				return &ParseError{File: file.Name, Message: "failed to read archive entry", Err: err}
+			}
+			err = a.writeFile(file.Name, rc, mode)
+			rc.Close()
+			if err != nil {
+				return err
+			}
+		default:
+			return &ParseError{File: file.Name, Message: "links and special files are not allowed in course archives"}
+		}
+	}
+	return nil
+}
+
+func extractTarGz(r io.Reader, dest string, maxSize int64) error {
+	gz, err := gzip.NewReader(bufio.NewReader(r))
+	if err != nil {
+		return &ParseError{File: "archive", Message: "invalid gzip stream", Err: err}
+	}
+	defer gz.Close()
+
+	a := &archiveWriter{dest: dest, maxSize: maxSize}
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return &ParseError{File: "archive", Message: "invalid tar archive", Err: err}
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := a.mkdir(header.Name); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := a.writeFile(header.Name, tr, header.FileInfo().Mode()); err != nil {
+				return err
+			}
+		case tar.TypeXGlobalHeader, tar.TypeXHeader:
+			// PAX metadata, nothing to extract
+		default:
+			return &ParseError{File: header.Name, Message: "links and special files are not allowed in course archives"}
+		}
+	}
+}
+
+// ExportArchive writes the content of a course directory as an archive. Files
+// are stored under a top-level directory named after the course so that the
+// archive can be imported again as is. Hidden files are skipped.
+func ExportArchive(w io.Writer, courseDir string, format ArchiveFormat) error {
+	courseID := filepath.Base(courseDir)
+
+	switch format {
+	case ArchiveZip:
+		zw := zip.NewWriter(w)
+		err := walkCourseFiles(courseDir, func(rel string, info fs.FileInfo, full string) error {
+			header, err := zip.FileInfoHeader(info)
+			if err != nil {
+				return err
+			}
+			header.Name = path.Join(courseID, rel)
+			if info.IsDir() {
+				header.Name += "/"
+				_, err = zw.CreateHeader(header)
+				return err
+			}
+			header.Method = zip.Deflate
+			out, err := zw.CreateHeader(header)
+			if err != nil {
+				return err
+			}
+			return copyFile(out, full)
+		})
+		if err != nil {
+			return err
+		}
+		return zw.Close()
+
+	case ArchiveTarGz:
+		gz := gzip.NewWriter(w)
+		tw := tar.NewWriter(gz)
+		err := walkCourseFiles(courseDir, func(rel string, info fs.FileInfo, full string) error {
+			header, err := tar.FileInfoHeader(info, "")
+			if err != nil {
+				return err
+			}
+			header.Name = path.Join(courseID, rel)
+			if info.IsDir() {
+				header.Name += "/"
+			}
+			header.Uname, header.Gname = "", ""
+			header.Uid, header.Gid = 0, 0
+			if err := tw.WriteHeader(header); err != nil {
+				return err
+			}
+			if info.IsDir() {
+				return nil
+			}
+			return copyFile(tw, full)
+		})
+		if err != nil {
+			return err
+		}
+		if err := tw.Close(); err != nil {
+			return err
+		}
+		return gz.Close()
+	}
+
+	return fmt.Errorf("unsupported archive format %q", format)
+}
+
+// walkCourseFiles calls fn for every directory and regular file of a course,
+// with slash-separated paths relative to the course directory
+func walkCourseFiles(courseDir string, fn func(rel string, info fs.FileInfo, full string) error) error {
+	return filepath.WalkDir(courseDir, func(full string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if full == courseDir {
+			return nil
+		}
+		if strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.IsDir() && !d.Type().IsRegular() {
+			return nil // Links are not exported
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(courseDir, full)
+		if err != nil {
+			return err
+		}
+		return fn(filepath.ToSlash(rel), info, full)
+	})
+}
+
+func copyFile(w io.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// ParseArchiveFormat parses an archive format name, defaulting to zip
+func ParseArchiveFormat(name string) (ArchiveFormat, error) {
+	switch strings.ToLower(name) {
+	case "", "zip":
+		return ArchiveZip, nil
+	case "tar.gz", "tgz", "targz":
+		return ArchiveTarGz, nil
+	}
+	return "", fmt.Errorf("unsupported archive format %q", name)
+}
+
+// ArchiveName returns the file name of a course archive, e.g. CS01-20260125.zip
+func ArchiveName(courseID string, format ArchiveFormat, now time.Time) string {
+	return fmt.Sprintf("%s-%s.%s", courseID, now.Format("20060102"), format)
+}
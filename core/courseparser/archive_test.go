@@ -0,0 +1,218 @@
+package courseparser
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeZip creates a zip archive with the given files and returns its path
+func writeZip(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "course.zip")
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestImportINGIniousArchive(t *testing.T) {
+	archive := writeZip(t, map[string]string{
+		"LSINF1101/course.yaml": `name: Programming
+admins: [teacher]
+accessible: true
+dispenser_data:
+  config:
+    quiz:
+      accessibility: true
+      evaluation_mode: best
+`,
+		"LSINF1101/quiz/task.yaml": `name: Quiz
+environment_type: mcq
+problems:
+  q1:
+    type: match
+    name: Answer
+    header: What is 6*7?
+    answer: "42"
+`,
+		"LSINF1101/legacy/task.yaml": `name: Legacy
+accessible: 2026-01-01 00:00:00/2026-02-01 00:00:00
+evaluate: last
+problems:
+  code:
+    type: code_single_line
+    name: One liner
+    header: Write it
+    language: python
+`,
+	})
+
+	coursesDir := t.TempDir()
+	result, err := ImportArchive(coursesDir, archive, ImportOptions{})
+	if err != nil {
+		t.Fatalf("import failed: %v", err)
+	}
+
+	if result.CourseID != "LSINF1101" {
+		t.Errorf("expected course ID from the archive directory, got %q", result.CourseID)
+	}
+	if !result.INGInious {
+		t.Error("archive should be detected as INGInious")
+	}
+
+	course := result.Course
+	if len(course.Tasks) != 2 {
+		t.Fatalf("expected 2 tasks, got %d", len(course.Tasks))
+	}
+	if _, err := os.Stat(filepath.Join(coursesDir, "LSINF1101", "course.yaml")); !os.IsNotExist(err) {
+		t.Error("course.yaml should be replaced by config.yaml")
+	}
+
+	legacy := course.Tasks["legacy"]
+	problem, _ := legacy.Problems.Get("code")
+	if problem == nil || problem.GetType() != "code" {
+		t.Errorf("code_single_line should be converted to code, got %v", problem)
+	}
+
+	access := course.Access.DispenserData
+	if !access.Imported || !access.Converted {
+		t.Errorf("expected imported and converted flags, got %+v", access)
+	}
+	legacyAccess, ok := access.Config["legacy"]
+	if !ok {
+		t.Fatal("legacy task access settings were not converted")
+	}
+	if legacyAccess.EvaluationMode != "last" {
+		t.Errorf("expected evaluation mode 'last', got %q", legacyAccess.EvaluationMode)
+	}
+	if legacyAccess.Accessibility.DateRange == nil {
+		t.Fatal("legacy accessibility should be a date range")
+	}
+	if got := legacyAccess.Accessibility.DateRange.String(); got != "2026-01-01 00:00:00/2026-02-01 00:00:00/2026-02-01 00:00:00" {
+		t.Errorf("unexpected converted date range %q", got)
+	}
+}
+
+func TestImportArchiveRejectsEscapingEntries(t *testing.T) {
+	archive := writeZip(t, map[string]string{
+		"course/config.yaml":    "name: Evil\n",
+		"course/access.yaml":    "dispenser_data: {}\n",
+		"course/../../evil.txt": "owned",
+	})
+
+	coursesDir := t.TempDir()
+	_, err := ImportArchive(coursesDir, archive, ImportOptions{})
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) {
+		t.Fatalf("expected a ParseError, got %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(filepath.Dir(coursesDir), "evil.txt")); !os.IsNotExist(err) {
+		t.Error("escaping entry was written outside of the courses directory")
+	}
+	entries, _ := os.ReadDir(coursesDir)
+	if len(entries) != 0 {
+		t.Errorf("failed import left %d entries behind", len(entries))
+	}
+}
+
+func TestExportImportRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	if err := ExportArchive(&buf, testCourseDir, ArchiveTarGz); err != nil {
+		t.Fatalf("export failed: %v", err)
+	}
+	archive := filepath.Join(t.TempDir(), "CS01.tar.gz")
+	if err := os.WriteFile(archive, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	coursesDir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(coursesDir, "CS01"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ImportArchive(coursesDir, archive, ImportOptions{}); !errors.Is(err, ErrCourseExists) {
+		t.Fatalf("expected ErrCourseExists, got %v", err)
+	}
+
+	result, err := ImportArchive(coursesDir, archive, ImportOptions{OnConflict: ConflictRename})
+	if err != nil {
+		t.Fatalf("import failed: %v", err)
+	}
+	if result.CourseID != "CS01-2" {
+		t.Errorf("expected renamed course CS01-2, got %q", result.CourseID)
+	}
+	if result.INGInious {
+		t.Error("IronSnake export should not be converted")
+	}
+	if len(result.Course.Tasks) != 7 {
+		t.Errorf("expected 7 tasks, got %d", len(result.Course.Tasks))
+	}
+}
+
+func TestImportReplacesCourseWithinInstall(t *testing.T) {
+	var buf bytes.Buffer
+	if err := ExportArchive(&buf, testCourseDir, ArchiveTarGz); err != nil {
+		t.Fatalf("export failed: %v", err)
+	}
+	archive := filepath.Join(t.TempDir(), "CS01.tar.gz")
+	if err := os.WriteFile(archive, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	coursesDir := t.TempDir()
+	marker := filepath.Join(coursesDir, "CS01", "old.txt")
+	if err := os.Mkdir(filepath.Join(coursesDir, "CS01"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(marker, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var installed []string
+	result, err := ImportArchive(coursesDir, archive, ImportOptions{
+		OnConflict: ConflictReplace,
+		Install: func(courseID string, install func() error) error {
+			installed = append(installed, courseID)
+			if _, err := os.Stat(marker); err != nil {
+				t.Errorf("old course replaced before Install: %v", err)
+			}
+			if err := install(); err != nil {
+				return err
+			}
+			if _, err := os.Stat(marker); !os.IsNotExist(err) {
+				t.Errorf("old course still in place after install: %v", err)
+			}
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("import failed: %v", err)
+	}
+	if !result.Replaced {
+		t.Error("expected the course to be replaced")
+	}
+	if len(installed) != 1 || installed[0] != "CS01" {
+		t.Errorf("Install called with %v, want [CS01]", installed)
+	}
+}
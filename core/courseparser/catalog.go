@@ -0,0 +1,174 @@
+package courseparser
+
+import (
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// ErrCourseNotFound is returned when a course ID does not match a course directory
+var ErrCourseNotFound = errors.New("course not found")
+
+// Catalog keeps the parsed courses of a courses directory in memory.
+// Courses are loaded once and reloaded individually after their files change.
+// A search index is built for each course as it is loaded.
+type Catalog struct {
+	loader     *CourseLoader
+	coursesDir string
+
+	mu      sync.RWMutex
+	courses map[string]*ParsedCourse
+	indexes map[string]*SearchIndex
+}
+
+// NewCatalog creates an empty catalog for the given courses directory
+func NewCatalog(coursesDir string) *Catalog {
+	return &Catalog{
+		loader:     NewCourseLoader(),
+		coursesDir: coursesDir,
+		courses:    make(map[string]*ParsedCourse),
+		indexes:    make(map[string]*SearchIndex),
+	}
+}
+
+// Dir returns the courses directory the catalog was created for
+func (c *Catalog) Dir() string {
+	return c.coursesDir
+}
+
+// Load (re)loads every course of the courses directory. Courses that fail to
+// parse are logged and skipped so that one broken course does not hide the
+// others; the first error is returned.
+func (c *Catalog) Load() error {
+	entries, err := os.ReadDir(c.coursesDir)
+	if err != nil {
+		return &ParseError{
+			File:    c.coursesDir,
+			Message: "failed to read courses directory",
+			Err:     err,
+		}
+	}
+
+	courses := make(map[string]*ParsedCourse)
+	indexes := make(map[string]*SearchIndex)
+	var firstErr error
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		coursePath := filepath.Join(c.coursesDir, entry.Name())
+		if _, err := os.Stat(filepath.Join(coursePath, "config.yaml")); os.IsNotExist(err) {
+			continue
+		}
+
+		course, err := c.loader.LoadCourse(coursePath)
+		if err != nil {
+			log.Printf("Skipping course %s: %v", entry.Name(), err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		courses[course.CourseID] = course
+		indexes[course.CourseID] = BuildSearchIndex(course)
+	}
+
+	c.mu.Lock()
+	c.courses = courses
+	c.indexes = indexes
+	c.mu.Unlock()
+
+	return firstErr
+}
+
+// Reload re-parses a single course from disk. If the course directory no
+// longer exists the course is removed from the catalog. If parsing fails the
+// previously loaded version is kept and the error is returned.
+func (c *Catalog) Reload(courseID string) error {
+	coursePath, err := c.CoursePath(courseID)
+	if err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(filepath.Join(coursePath, "config.yaml")); os.IsNotExist(err) {
+		c.mu.Lock()
+		delete(c.courses, courseID)
+		delete(c.indexes, courseID)
+		c.mu.Unlock()
+		return nil
+	}
+
+	course, err := c.loader.LoadCourse(coursePath)
+	if err != nil {
+		return err
+	}
+	index := BuildSearchIndex(course)
+
+	c.mu.Lock()
+	c.courses[courseID] = course
+	c.indexes[courseID] = index
+	c.mu.Unlock()
+	return nil
+}
+
+// Get returns a loaded course by ID
+func (c *Catalog) Get(courseID string) (*ParsedCourse, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	course, ok := c.courses[courseID]
+	return course, ok
+}
+
+// Index returns the search index of a loaded course
+func (c *Catalog) Index(courseID string) (*SearchIndex, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	index, ok := c.indexes[courseID]
+	return index, ok
+}
+
+// List returns all loaded courses sorted by course ID
+func (c *Catalog) List() []*ParsedCourse {
+	c.mu.RLock()
+	courses := make([]*ParsedCourse, 0, len(c.courses))
+	for _, course := range c.courses {
+		courses = append(courses, course)
+	}
+	c.mu.RUnlock()
+
+	sort.Slice(courses, func(i, j int) bool {
+		return courses[i].CourseID < courses[j].CourseID
+	})
+	return courses
+}
+
+// CoursePath returns the directory of a course. The course ID must be a
+// single path element so that it cannot point outside the courses directory.
+func (c *Catalog) CoursePath(courseID string) (string, error) {
+	if !ValidID(courseID) {
+		return "", ErrCourseNotFound
+	}
+	return filepath.Join(c.coursesDir, courseID), nil
+}
+
+// ValidID reports whether id is a valid course, task or problem ID. IDs are
+// used as directory names and YAML keys, so only a conservative set of
+// characters is allowed.
+func ValidID(id string) bool {
+	if id == "" || id == "." || id == ".." {
+		return false
+	}
+	for _, ch := range id {
+		switch {
+		case ch >= 'a' && ch <= 'z', ch >= 'A' && ch <= 'Z', ch >= '0' && ch <= '9':
+		case ch == '-' || ch == '_' || ch == '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
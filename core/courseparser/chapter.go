@@ -0,0 +1,190 @@
+package courseparser
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// Chapter is a syllabus chapter with its rendered content
+type Chapter struct {
+	Path     string    // Slash-separated path relative to the syllabus directory
+	Title    string    // Title from {{#title}} or SUMMARY.md, empty if neither
+	Markdown string    // Markdown with preprocessor directives resolved
+	HTML     string    // Rendered HTML
+	Tasks    []string  // IDs of the tasks embedded with {{#task}}, in order
+	Snippets []Snippet // Runnable code blocks, indexed by their data-snippet
+}
+
+// RenderOptions controls how a chapter is rendered
+type RenderOptions struct {
+	// AssetURL maps a slash-separated path relative to the syllabus directory
+	// to the URL it is served at. It is used for images and links to files
+	// other than Markdown chapters, which are left relative. Nothing is
+	// rewritten when nil.
+	AssetURL func(path string) string
+
+	// Tasks of the course, used to title embedded tasks
+	Tasks map[string]TaskConfig
+	// TaskURL returns the link to an embedded task, if not nil
+	TaskURL func(taskID string) string
+	// Runnable reports whether code blocks of a language can be run. No
+	// block is runnable when nil.
+	Runnable func(language string) bool
+}
+
+// ResolvePath returns the filesystem path of a file of the syllabus, making
+// sure it stays inside the syllabus directory. Hidden files are never served.
+func (s *Syllabus) ResolvePath(name string) (string, error) {
+	for _, part := range strings.Split(name, "/") {
+		if strings.HasPrefix(part, ".") && part != "." && part != ".." {
+			return "", fmt.Errorf("%s: %w", name, os.ErrNotExist)
+		}
+	}
+	return SafeJoin(s.Dir, name)
+}
+
+// FindEntry returns the SUMMARY.md entry pointing to the chapter at path, or nil
+func (s *Syllabus) FindEntry(chapterPath string) *SummaryEntry {
+	return findEntry(s.Summary, path.Clean(chapterPath))
+}
+
+func findEntry(entries []SummaryEntry, chapterPath string) *SummaryEntry {
+	for i := range entries {
+		if entries[i].Path != "" && path.Clean(entries[i].Path) == chapterPath {
+			return &entries[i]
+		}
+		if entry := findEntry(entries[i].Children, chapterPath); entry != nil {
+			return entry
+		}
+	}
+	return nil
+}
+
+// Chapter reads and renders the Markdown chapter at the given path relative
+// to the syllabus directory
+func (s *Syllabus) Chapter(chapterPath string, opts RenderOptions) (*Chapter, error) {
+	chapterPath = strings.TrimPrefix(path.Clean("/"+chapterPath), "/")
+	if path.Ext(chapterPath) != ".md" {
+		return nil, fmt.Errorf("%s: %w", chapterPath, os.ErrNotExist)
+	}
+
+	filePath, err := s.ResolvePath(chapterPath)
+	if err != nil {
+		return nil, err
+	}
+	source, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	// Includes may reach anything in the course directory
+	root, err := filepath.EvalSymlinks(filepath.Dir(s.Dir))
+	if err != nil {
+		return nil, err
+	}
+	preprocessed, err := Preprocess(root, filePath, source)
+	if err != nil {
+		return nil, err
+	}
+
+	html, embeds, err := renderChapter([]byte(preprocessed.Markdown), chapterPath, opts)
+	if err != nil {
+		return nil, &ParseError{File: chapterPath, Message: "failed to render Markdown", Err: err}
+	}
+
+	chapter := &Chapter{
+		Path:     chapterPath,
+		Title:    preprocessed.Title,
+		Markdown: preprocessed.Markdown,
+		HTML:     string(html),
+		Tasks:    embeds.tasks,
+		Snippets: embeds.snippets,
+	}
+	if entry := s.FindEntry(chapterPath); entry != nil && chapter.Title == "" {
+		chapter.Title = entry.Title
+	}
+	return chapter, nil
+}
+
+// RenderMarkdown renders a chapter to HTML. Relative links are resolved
+// against chapterPath and rewritten with opts, {{#task}} lines become task
+// embeds. Raw HTML in the source is not rendered.
+func RenderMarkdown(source []byte, chapterPath string, opts RenderOptions) ([]byte, error) {
+	html, _, err := renderChapter(source, chapterPath, opts)
+	return html, err
+}
+
+// renderChapter renders a chapter and returns what it embeds
+func renderChapter(source []byte, chapterPath string, opts RenderOptions) ([]byte, *chapterEmbeds, error) {
+	embeds := &chapterEmbeds{}
+	md := goldmark.New(
+		goldmark.WithExtensions(extension.GFM, &embedExtension{opts: opts, embeds: embeds}),
+		goldmark.WithParserOptions(
+			parser.WithAutoHeadingID(),
+			parser.WithASTTransformers(util.Prioritized(&linkRewriter{base: path.Dir(chapterPath), opts: opts}, 100)),
+		),
+	)
+
+	var buf bytes.Buffer
+	if err := md.Convert(source, &buf); err != nil {
+		return nil, nil, err
+	}
+	return buf.Bytes(), embeds, nil
+}
+
+// linkRewriter rewrites the destination of relative links and images
+type linkRewriter struct {
+	base string
+	opts RenderOptions
+}
+
+func (t *linkRewriter) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch node := n.(type) {
+		case *ast.Link:
+			node.Destination = t.rewrite(node.Destination, false)
+		case *ast.Image:
+			node.Destination = t.rewrite(node.Destination, true)
+		}
+		return ast.WalkContinue, nil
+	})
+}
+
+// rewrite maps a link destination to its URL. Absolute URLs, fragments and
+// paths leaving the syllabus directory are kept as they are.
+func (t *linkRewriter) rewrite(dest []byte, image bool) []byte {
+	u, err := url.Parse(string(dest))
+	if err != nil || u.Scheme != "" || u.Host != "" || u.Path == "" || strings.HasPrefix(u.Path, "/") {
+		return dest
+	}
+
+	target := path.Join(t.base, u.Path)
+	if target == ".." || strings.HasPrefix(target, "../") {
+		return dest
+	}
+
+	if t.opts.AssetURL == nil || (!image && path.Ext(target) == ".md") {
+		return dest
+	}
+
+	result := t.opts.AssetURL(target)
+	if u.Fragment != "" {
+		result += "#" + u.EscapedFragment()
+	}
+	return []byte(result)
+}
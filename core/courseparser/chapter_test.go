@@ -0,0 +1,146 @@
+package courseparser
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSyllabusChapter(t *testing.T) {
+	syllabus, err := ParseSyllabus(filepath.Join(testCourseDir, "syllabus"))
+	if err != nil {
+		t.Fatalf("failed to parse syllabus: %v", err)
+	}
+
+	chapter, err := syllabus.Chapter("src/chapter2_algorithms.md", RenderOptions{})
+	if err != nil {
+		t.Fatalf("failed to render chapter: %v", err)
+	}
+	if chapter.Title != "Algorithmes et Complexité" {
+		t.Errorf("expected title from SUMMARY.md, got %q", chapter.Title)
+	}
+	if chapter.Markdown == "" || !strings.Contains(chapter.HTML, "<h1") {
+		t.Errorf("expected Markdown and rendered HTML, got %q", chapter.HTML)
+	}
+
+	for _, name := range []string{"../config.yaml", "src/../../access.yaml", "book.toml", "src/missing.md"} {
+		if _, err := syllabus.Chapter(name, RenderOptions{}); !errors.Is(err, os.ErrNotExist) && !errors.Is(err, ErrPathOutsideRoot) {
+			t.Errorf("%s: expected the chapter to be refused, got %v", name, err)
+		}
+	}
+}
+
+func TestRenderMarkdownLinks(t *testing.T) {
+	source := []byte(`![diagram](img/tree.png)
+[code](../example.py#L3) [next](chapter2.md) [site](https://example.com/a.png)
+[outside](../../secret.txt)
+
+<script>alert(1)</script>
+`)
+
+	html, err := RenderMarkdown(source, "src/chapter1.md", RenderOptions{
+		AssetURL: func(path string) string { return "/assets/" + path },
+	})
+	if err != nil {
+		t.Fatalf("failed to render: %v", err)
+	}
+	out := string(html)
+
+	for _, want := range []string{
+		`src="/assets/src/img/tree.png"`,
+		`href="/assets/example.py#L3"`,
+		`href="chapter2.md"`,
+		`href="https://example.com/a.png"`,
+		`href="../../secret.txt"`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %s in:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "<script>") {
+		t.Errorf("raw HTML should not be rendered:\n%s", out)
+	}
+}
+
+func TestRenderChapterEmbeds(t *testing.T) {
+	source := []byte("Try it:\n\n{{#task loops}}\n\n" +
+		"```python\nprint(\"<hi>\")\n```\n\n" +
+		"```python,norun\nimport os\n```\n\n" +
+		"```text\n{{#task loops}}\n```\n\n" +
+		"\\{{#task loops}}\n")
+
+	html, embeds, err := renderChapter(source, "src/chapter.md", RenderOptions{
+		Tasks:    map[string]TaskConfig{"loops": {Name: "Les boucles"}},
+		TaskURL:  func(id string) string { return "/tasks/" + id },
+		Runnable: func(language string) bool { return language == "python" },
+	})
+	if err != nil {
+		t.Fatalf("failed to render: %v", err)
+	}
+	out := string(html)
+
+	if !reflect.DeepEqual(embeds.tasks, []string{"loops"}) {
+		t.Errorf("expected one embedded task, got %v", embeds.tasks)
+	}
+	if strings.Count(out, `<div class="task-embed" data-task-id="loops"><a href="/tasks/loops">Les boucles</a></div>`) != 1 {
+		t.Errorf("expected exactly one task embed in:\n%s", out)
+	}
+	if !strings.Contains(out, "{{#task loops}}\n</code>") || !strings.Contains(out, "<p>{{#task loops}}</p>") {
+		t.Errorf("directives in code blocks or escaped should stay as text:\n%s", out)
+	}
+
+	if len(embeds.snippets) != 1 || embeds.snippets[0].Code != "print(\"<hi>\")\n" {
+		t.Fatalf("expected one runnable snippet, got %+v", embeds.snippets)
+	}
+	if !strings.Contains(out, `<pre class="runnable" data-snippet="0" data-language="python"><code class="language-python">print(&quot;&lt;hi&gt;&quot;)`) {
+		t.Errorf("runnable block not marked:\n%s", out)
+	}
+	if !strings.Contains(out, `<pre><code class="language-python">import os`) {
+		t.Errorf("norun block should not be runnable:\n%s", out)
+	}
+}
+
+func TestLoadCourseRejectsUnknownEmbeddedTasks(t *testing.T) {
+	root := writeCourseFiles(t, map[string]string{
+		"config.yaml":           "name: Course\n",
+		"access.yaml":           "dispenser_data: {}\n",
+		"tasks/loops/task.yaml": "name: Loops\n",
+		"syllabus/book.toml":    "[book]\ntitle = \"Course\"\n",
+		"syllabus/SUMMARY.md":   "- [One](src/one.md)\n- [Two](src/two.md)\n",
+		"syllabus/src/one.md":   "{{#task loops}}\n\n```\n{{#task example}}\n```\n",
+		"syllabus/src/two.md":   "# Two\n\n{{#task loop}}\n",
+	})
+
+	_, err := NewCourseLoader().LoadCourse(root)
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) {
+		t.Fatalf("expected a ParseError, got %v", err)
+	}
+	if parseErr.File != "syllabus/src/two.md" || parseErr.Line != 3 || parseErr.Message != `unknown task "loop"` {
+		t.Errorf("unexpected error: %v", parseErr)
+	}
+}
+
+func TestLoadCourseRejectsUnknownTasksOfIncludedFiles(t *testing.T) {
+	root := writeCourseFiles(t, map[string]string{
+		"config.yaml":               "name: Course\n",
+		"access.yaml":               "dispenser_data: {}\n",
+		"tasks/loops/task.yaml":     "name: Loops\n",
+		"syllabus/book.toml":        "[book]\ntitle = \"Course\"\n",
+		"syllabus/SUMMARY.md":       "- [One](src/one.md)\n",
+		"syllabus/src/one.md":       "# One\n\n{{#include exercises.md}}\n",
+		"syllabus/src/exercises.md": "{{#task loops}}\n\n{{#task whiles}}\n",
+	})
+
+	_, err := NewCourseLoader().LoadCourse(root)
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) {
+		t.Fatalf("expected a ParseError, got %v", err)
+	}
+	if parseErr.File != "syllabus/src/one.md" || parseErr.Message != `unknown task "whiles" (in an included file)` {
+		t.Errorf("unexpected error: %v", parseErr)
+	}
+}
@@ -20,7 +20,7 @@ type CourseConfig struct {
 	RegistrationAC       *string        `yaml:"registration_ac"`
 	RegistrationACAccept bool           `yaml:"registration_ac_accept"`
 	RegistrationACList   []string       `yaml:"registration_ac_list"`
-	Tags                 map[string]any `yaml:"tags"`
+	Tags                 map[string]Tag `yaml:"tags"`
 }
 
 // ParseCourseConfig parses a config.yaml file and returns a CourseConfig
@@ -34,6 +34,11 @@ func ParseCourseConfig(path string) (*CourseConfig, error) {
 		}
 	}
 
+	return ParseCourseConfigData(path, data)
+}
+
+// ParseCourseConfigData parses the contents of a config.yaml file; path is only used in errors
+func ParseCourseConfigData(path string, data []byte) (*CourseConfig, error) {
 	var config CourseConfig
 	if err := yaml.Unmarshal(data, &config); err != nil {
 		return nil, &ParseError{
@@ -43,5 +48,9 @@ func ParseCourseConfig(path string) (*CourseConfig, error) {
 		}
 	}
 
+	if err := config.validateRegistration(path); err != nil {
+		return nil, err
+	}
+
 	return &config, nil
 }
@@ -57,6 +57,17 @@ func (l *CourseLoader) LoadCourse(dirPath string) (*ParsedCourse, error) {
 		}
 	}
 
+	// Tasks may only reference tags defined by the course
+	for taskID, task := range course.Tasks {
+		if err := course.Config.ValidateTaskTags(filepath.Join(tasksDir, taskID, "task.yaml"), &task); err != nil {
+			return nil, &CourseLoadError{
+				CourseID: courseID,
+				Message:  "failed to load tasks",
+				Err:      err,
+			}
+		}
+	}
+
 	// Load syllabus (optional)
 	syllabusDir := filepath.Join(dirPath, "syllabus")
 	if _, err := os.Stat(syllabusDir); err == nil {
@@ -68,6 +79,13 @@ func (l *CourseLoader) LoadCourse(dirPath string) (*ParsedCourse, error) {
 				Err:      err,
 			}
 		}
+		if err := syllabus.ValidateTaskEmbeds(course.Tasks); err != nil {
+			return nil, &CourseLoadError{
+				CourseID: courseID,
+				Message:  "failed to load syllabus",
+				Err:      err,
+			}
+		}
 		course.Syllabus = syllabus
 	}
 
@@ -148,3 +166,21 @@ func (l *CourseLoader) LoadAllCourses(coursesDir string) ([]*ParsedCourse, error
 
 	return courses, nil
 }
+
+// ValidateCourseFile checks that data is a valid course file for the given
+// path. Only the files the loader parses (config.yaml, access.yaml, task.yaml
+// and book.toml) are checked; any other file is accepted as is.
+func ValidateCourseFile(path string, data []byte) error {
+	var err error
+	switch filepath.Base(path) {
+	case "config.yaml":
+		_, err = ParseCourseConfigData(path, data)
+	case "access.yaml":
+		_, err = ParseAccessConfigData(path, data)
+	case "task.yaml":
+		_, err = ParseTaskConfigData(path, data)
+	case "book.toml":
+		_, err = ParseBookConfigData(path, data)
+	}
+	return err
+}
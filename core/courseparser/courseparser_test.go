@@ -40,12 +40,12 @@ func TestLoadCourse(t *testing.T) {
 		if !task01.IsDocker() {
 			t.Error("task01 should be a docker task")
 		}
-		if len(task01.Problems) != 1 {
-			t.Errorf("expected 1 problem in task01, got %d", len(task01.Problems))
+		if task01.Problems.Len() != 1 {
+			t.Errorf("expected 1 problem in task01, got %d", task01.Problems.Len())
 		}
 
 		// Verify code problem type
-		problem, ok := task01.Problems["binary_to_base64"]
+		problem, ok := task01.Problems.Get("binary_to_base64")
 		if !ok {
 			t.Error("problem binary_to_base64 not found")
 		} else {
@@ -71,12 +71,12 @@ func TestLoadCourse(t *testing.T) {
 		if !task05.IsMCQ() {
 			t.Error("task05 should be an MCQ task")
 		}
-		if len(task05.Problems) != 5 {
-			t.Errorf("expected 5 problems in task05, got %d", len(task05.Problems))
+		if task05.Problems.Len() != 5 {
+			t.Errorf("expected 5 problems in task05, got %d", task05.Problems.Len())
 		}
 
 		// Verify multiple_choice problem
-		q1, ok := task05.Problems["Q1"]
+		q1, ok := task05.Problems.Get("Q1")
 		if !ok {
 			t.Error("Q1 not found")
 		} else {
@@ -94,7 +94,7 @@ func TestLoadCourse(t *testing.T) {
 		}
 
 		// Verify match problem
-		q4, ok := task05.Problems["Q4"]
+		q4, ok := task05.Problems.Get("Q4")
 		if !ok {
 			t.Error("Q4 not found")
 		} else {
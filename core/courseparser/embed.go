@@ -0,0 +1,287 @@
+package courseparser
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// taskDirectivePattern matches a {{#task id}} directive filling a whole line
+var taskDirectivePattern = regexp.MustCompile(`^\{\{\s*#task\s+([^\s}]+)\s*\}\}$`)
+
+// Snippet is a runnable code block of a chapter
+type Snippet struct {
+	Language string
+	Code     string
+}
+
+// KindTaskEmbed is the goldmark node kind of an embedded task
+var KindTaskEmbed = ast.NewNodeKind("TaskEmbed")
+
+// taskEmbed is a {{#task id}} directive in the chapter AST
+type taskEmbed struct {
+	ast.BaseBlock
+	TaskID string
+}
+
+func (n *taskEmbed) Kind() ast.NodeKind {
+	return KindTaskEmbed
+}
+
+func (n *taskEmbed) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"TaskID": n.TaskID}, nil)
+}
+
+// chapterEmbeds collects what a chapter embeds while it is rendered
+type chapterEmbeds struct {
+	tasks    []string
+	snippets []Snippet
+}
+
+// embedExtension turns {{#task}} paragraphs into task embeds and marks
+// runnable code blocks
+type embedExtension struct {
+	opts   RenderOptions
+	embeds *chapterEmbeds
+}
+
+func (e *embedExtension) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(parser.WithASTTransformers(util.Prioritized(e, 200)))
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(util.Prioritized(e, 100)))
+}
+
+// Transform replaces paragraphs made of a single task directive
+func (e *embedExtension) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	source := reader.Source()
+
+	var paragraphs []*ast.Paragraph
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if p, ok := n.(*ast.Paragraph); ok && entering {
+			paragraphs = append(paragraphs, p)
+			return ast.WalkSkipChildren, nil
+		}
+		return ast.WalkContinue, nil
+	})
+
+	for _, p := range paragraphs {
+		if p.Lines().Len() != 1 {
+			continue
+		}
+		line := p.Lines().At(0)
+		matches := taskDirectivePattern.FindSubmatch(bytes.TrimSpace(line.Value(source)))
+		if matches == nil {
+			continue
+		}
+		embed := &taskEmbed{TaskID: string(matches[1])}
+		p.Parent().ReplaceChild(p.Parent(), p, embed)
+		e.embeds.tasks = appendUnique(e.embeds.tasks, embed.TaskID)
+	}
+}
+
+// RegisterFuncs renders task embeds and code blocks
+func (e *embedExtension) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(KindTaskEmbed, e.renderTaskEmbed)
+	reg.Register(ast.KindFencedCodeBlock, e.renderFencedCodeBlock)
+}
+
+// renderTaskEmbed writes a placeholder the client replaces with the task,
+// linking to it meanwhile
+func (e *embedExtension) renderTaskEmbed(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+	n := node.(*taskEmbed)
+
+	title := n.TaskID
+	if task, ok := e.opts.Tasks[n.TaskID]; ok && task.Name != "" {
+		title = task.Name
+	}
+
+	fmt.Fprintf(w, `<div class="task-embed" data-task-id="%s">`, util.EscapeHTML([]byte(n.TaskID)))
+	if e.opts.TaskURL != nil {
+		fmt.Fprintf(w, `<a href="%s">`, util.EscapeHTML(util.URLEscape([]byte(e.opts.TaskURL(n.TaskID)), true)))
+		html.DefaultWriter.RawWrite(w, []byte(title))
+		w.WriteString("</a>")
+	} else {
+		html.DefaultWriter.RawWrite(w, []byte(title))
+	}
+	w.WriteString("</div>\n")
+	return ast.WalkSkipChildren, nil
+}
+
+// renderFencedCodeBlock renders code blocks like goldmark does, adding
+// data-snippet to the blocks that can be run. Blocks marked "norun" or
+// "ignore" ("```python,norun") are never runnable.
+func (e *embedExtension) renderFencedCodeBlock(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	n := node.(*ast.FencedCodeBlock)
+	if !entering {
+		w.WriteString("</code></pre>\n")
+		return ast.WalkContinue, nil
+	}
+
+	var attributes []string
+	if n.Info != nil {
+		attributes = strings.FieldsFunc(string(n.Info.Segment.Value(source)), func(r rune) bool {
+			return r == ',' || r == ' ' || r == '\t'
+		})
+	}
+
+	var code bytes.Buffer
+	for i := 0; i < n.Lines().Len(); i++ {
+		line := n.Lines().At(i)
+		code.Write(line.Value(source))
+	}
+
+	w.WriteString("<pre")
+	if len(attributes) > 0 && e.isRunnable(attributes) {
+		fmt.Fprintf(w, ` class="runnable" data-snippet="%d" data-language="%s"`, len(e.embeds.snippets), util.EscapeHTML([]byte(attributes[0])))
+		e.embeds.snippets = append(e.embeds.snippets, Snippet{Language: attributes[0], Code: code.String()})
+	}
+	w.WriteString("><code")
+	if len(attributes) > 0 {
+		w.WriteString(` class="language-`)
+		html.DefaultWriter.Write(w, []byte(attributes[0]))
+		w.WriteString(`"`)
+	}
+	w.WriteString(">")
+	html.DefaultWriter.RawWrite(w, code.Bytes())
+	return ast.WalkContinue, nil
+}
+
+// isRunnable reports whether a code block with the given info attributes
+// (language first) can be run
+func (e *embedExtension) isRunnable(attributes []string) bool {
+	if e.opts.Runnable == nil || !e.opts.Runnable(attributes[0]) {
+		return false
+	}
+	for _, attribute := range attributes[1:] {
+		if attribute == "norun" || attribute == "ignore" {
+			return false
+		}
+	}
+	return true
+}
+
+// appendUnique appends s to list unless it is already there
+func appendUnique(list []string, s string) []string {
+	for _, item := range list {
+		if item == s {
+			return list
+		}
+	}
+	return append(list, s)
+}
+
+// ValidateTaskEmbeds checks that every {{#task}} directive of the chapters
+// listed in the summary refers to a task of the course. Chapters that do not
+// exist are skipped; they are reported when requested.
+func (s *Syllabus) ValidateTaskEmbeds(tasks map[string]TaskConfig) error {
+	return validateTaskEmbeds(s, s.Summary, tasks)
+}
+
+func validateTaskEmbeds(s *Syllabus, entries []SummaryEntry, tasks map[string]TaskConfig) error {
+	for _, entry := range entries {
+		if entry.Path != "" {
+			if err := validateChapterTaskEmbeds(s, entry.Path, tasks); err != nil {
+				return err
+			}
+		}
+		if err := validateTaskEmbeds(s, entry.Children, tasks); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateChapterTaskEmbeds checks the {{#task}} directives of a chapter once
+// its includes are resolved, since the renderer sees those of included files
+// too. Chapters failing to preprocess are skipped like missing ones.
+func validateChapterTaskEmbeds(s *Syllabus, chapterPath string, tasks map[string]TaskConfig) error {
+	filePath, err := s.ResolvePath(chapterPath)
+	if err != nil {
+		return nil
+	}
+	source, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil
+	}
+	root, err := filepath.EvalSymlinks(filepath.Dir(s.Dir))
+	if err != nil {
+		return nil
+	}
+	preprocessed, err := Preprocess(root, filePath, source)
+	if err != nil {
+		return nil
+	}
+
+	for _, directive := range taskDirectives(preprocessed.Markdown) {
+		if _, ok := tasks[directive.taskID]; ok {
+			continue
+		}
+		parseErr := &ParseError{
+			File:    filepath.ToSlash(filepath.Join("syllabus", chapterPath)),
+			Message: fmt.Sprintf("unknown task %q", directive.taskID),
+		}
+		// Point at the chapter line if the directive is written there,
+		// otherwise it comes from an included file
+		for _, own := range taskDirectives(string(source)) {
+			if own.taskID == directive.taskID {
+				parseErr.Line = own.line
+				break
+			}
+		}
+		if parseErr.Line == 0 {
+			parseErr.Message += " (in an included file)"
+		}
+		return parseErr
+	}
+	return nil
+}
+
+// taskDirective is a {{#task}} directive and its 1-based line
+type taskDirective struct {
+	taskID string
+	line   int
+}
+
+// taskDirectives returns the {{#task}} directives of Markdown outside of
+// code blocks
+func taskDirectives(markdown string) []taskDirective {
+	var directives []taskDirective
+	lineNo := 0
+	fence := ""
+	scanner := bufio.NewScanner(strings.NewReader(markdown))
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+
+		// Directives inside code blocks are only examples
+		if fence != "" {
+			if strings.HasPrefix(line, fence) {
+				fence = ""
+			}
+			continue
+		}
+		if strings.HasPrefix(line, "```") || strings.HasPrefix(line, "~~~") {
+			fence = line[:3]
+			continue
+		}
+
+		if matches := taskDirectivePattern.FindStringSubmatch(line); matches != nil {
+			directives = append(directives, taskDirective{taskID: matches[1], line: lineNo})
+		}
+	}
+	return directives
+}
@@ -5,19 +5,29 @@ import "fmt"
 // ParseError represents a parsing error with context
 type ParseError struct {
 	File    string // File path where error occurred
+	Line    int    // 1-based line (optional)
+	Column  int    // 1-based column (optional, requires Line)
 	Field   string // Field name (optional)
 	Message string // Error description
 	Err     error  // Underlying error
 }
 
 func (e *ParseError) Error() string {
+	file := e.File
+	if e.Line > 0 {
+		file = fmt.Sprintf("%s:%d", file, e.Line)
+		if e.Column > 0 {
+			file = fmt.Sprintf("%s:%d", file, e.Column)
+		}
+	}
+
 	if e.Field != "" {
-		return fmt.Sprintf("%s: field %q: %s", e.File, e.Field, e.Message)
+		return fmt.Sprintf("%s: field %q: %s", file, e.Field, e.Message)
 	}
 	if e.Err != nil {
-		return fmt.Sprintf("%s: %s: %v", e.File, e.Message, e.Err)
+		return fmt.Sprintf("%s: %s: %v", file, e.Message, e.Err)
 	}
-	return fmt.Sprintf("%s: %s", e.File, e.Message)
+	return fmt.Sprintf("%s: %s", file, e.Message)
 }
 
 func (e *ParseError) Unwrap() error {
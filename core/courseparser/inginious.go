@@ -0,0 +1,304 @@
+package courseparser
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ingCourseFile is the course description file of INGInious courses
+const ingCourseFile = "course.yaml"
+
+// Legacy INGInious task.yaml fields that now live in the task dispenser config
+var ingLegacyTaskFields = []string{"accessible", "evaluate", "submission_limit", "stored_submissions"}
+
+// ingProblemTypes maps INGInious problem types to the IronSnake ones
+var ingProblemTypes = map[string]string{
+	"code_single_line": "code",
+}
+
+// ingCourse holds the parts of an INGInious course.yaml that are not part of
+// CourseConfig. Accessibility values are decoded leniently because INGInious
+// accepts forms that TaskAccessibility does not.
+type ingCourse struct {
+	DispenserData struct {
+		Config map[string]ingTaskAccess `yaml:"config"`
+	} `yaml:"dispenser_data"`
+}
+
+// ingTaskAccess is a task dispenser entry, or the legacy fields of a task.yaml
+type ingTaskAccess struct {
+	Accessibility       interface{}      `yaml:"accessibility"`
+	Accessible          interface{}      `yaml:"accessible"` // legacy task.yaml name
+	EvaluationMode      string           `yaml:"evaluation_mode"`
+	Evaluate            string           `yaml:"evaluate"` // legacy task.yaml name
+	NoStoredSubmissions int              `yaml:"no_stored_submissions"`
+	StoredSubmissions   int              `yaml:"stored_submissions"` // legacy task.yaml name
+	SubmissionLimit     *SubmissionLimit `yaml:"submission_limit"`
+}
+
+// NormalizeINGInious converts a course directory in the INGInious layout
+// (course.yaml, tasks at the top level, access settings in task.yaml) into
+// the IronSnake layout (config.yaml, access.yaml and a tasks directory). It
+// reports whether anything was converted; courses already in the IronSnake
+// layout are left untouched.
+func NormalizeINGInious(root string) (bool, error) {
+	coursePath := filepath.Join(root, ingCourseFile)
+	if _, err := os.Stat(coursePath); os.IsNotExist(err) {
+		return false, nil
+	}
+
+	data, err := os.ReadFile(coursePath)
+	if err != nil {
+		return false, &ParseError{File: ingCourseFile, Message: "failed to read file", Err: err}
+	}
+
+	config, err := ParseCourseConfigData(ingCourseFile, data)
+	if err != nil {
+		return false, err
+	}
+	var course ingCourse
+	if err := yaml.Unmarshal(data, &course); err != nil {
+		return false, &ParseError{File: ingCourseFile, Message: "failed to parse YAML", Err: err}
+	}
+
+	access := AccessConfig{
+		DispenserData: DispenserData{
+			Config:   make(map[string]TaskAccessConfig),
+			Imported: true,
+		},
+	}
+	for taskID, entry := range course.DispenserData.Config {
+		taskAccess, err := entry.toTaskAccessConfig()
+		if err != nil {
+			return false, &ParseError{File: ingCourseFile, Field: "dispenser_data.config." + taskID, Message: err.Error()}
+		}
+		access.DispenserData.Config[taskID] = taskAccess
+	}
+
+	// Tasks live at the top level of INGInious courses
+	tasksDir := filepath.Join(root, "tasks")
+	if err := moveTopLevelTasks(root, tasksDir); err != nil {
+		return false, err
+	}
+
+	entries, err := os.ReadDir(tasksDir)
+	if err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		taskID := entry.Name()
+		legacy, err := normalizeINGTask(filepath.Join(tasksDir, taskID, "task.yaml"))
+		if err != nil {
+			return false, err
+		}
+
+		// The dispenser config wins over settings left in old task files
+		if _, configured := access.DispenserData.Config[taskID]; legacy != nil && !configured {
+			taskAccess, err := legacy.toTaskAccessConfig()
+			if err != nil {
+				return false, &ParseError{File: filepath.Join("tasks", taskID, "task.yaml"), Field: "accessible", Message: err.Error()}
+			}
+			access.DispenserData.Config[taskID] = taskAccess
+			access.DispenserData.Converted = true
+		}
+	}
+
+	if err := WriteCourseConfig(filepath.Join(root, "config.yaml"), config); err != nil {
+		return false, err
+	}
+	if err := WriteAccessConfig(filepath.Join(root, "access.yaml"), &access); err != nil {
+		return false, err
+	}
+	if err := os.Remove(coursePath); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// moveTopLevelTasks moves every directory of root that holds a task.yaml into tasksDir
+func moveTopLevelTasks(root, tasksDir string) error {
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() || entry.Name() == "tasks" {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(root, entry.Name(), "task.yaml")); err != nil {
+			continue
+		}
+
+		if err := os.MkdirAll(tasksDir, 0755); err != nil {
+			return err
+		}
+		target := filepath.Join(tasksDir, entry.Name())
+		if _, err := os.Stat(target); err == nil {
+			return &ParseError{File: filepath.Join("tasks", entry.Name()), Message: "task exists both at the top level and in tasks/"}
+		}
+		if err := os.Rename(filepath.Join(root, entry.Name()), target); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// normalizeINGTask rewrites an INGInious task.yaml in place: legacy access
+// fields are removed (and returned, or nil if there were none) and problem
+// types are mapped to their IronSnake equivalent
+func normalizeINGTask(path string) (*ingTaskAccess, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, &ParseError{File: path, Message: "failed to parse YAML", Err: err}
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil, nil
+	}
+	root := doc.Content[0]
+
+	var legacy *ingTaskAccess
+	hasLegacy := false
+	for _, field := range ingLegacyTaskFields {
+		if mappingValue(root, field) != nil {
+			hasLegacy = true
+		}
+	}
+	if hasLegacy {
+		legacy = &ingTaskAccess{}
+		if err := root.Decode(legacy); err != nil {
+			return nil, &ParseError{File: path, Message: "invalid task access settings", Err: err}
+		}
+		removeMappingKeys(root, ingLegacyTaskFields)
+	}
+
+	changed := hasLegacy
+	if problems := mappingValue(root, "problems"); problems != nil && problems.Kind == yaml.MappingNode {
+		for i := 1; i < len(problems.Content); i += 2 {
+			typeNode := mappingValue(problems.Content[i], "type")
+			if typeNode == nil {
+				continue
+			}
+			if mapped, ok := ingProblemTypes[typeNode.Value]; ok {
+				typeNode.Value = mapped
+				changed = true
+			}
+		}
+	}
+
+	if !changed {
+		return nil, nil
+	}
+
+	out, err := marshalYAML(&doc)
+	if err != nil {
+		return nil, err
+	}
+	if err := WriteFileAtomic(path, out, 0644); err != nil {
+		return nil, err
+	}
+	return legacy, nil
+}
+
+// removeMappingKeys removes the given keys from a mapping node
+func removeMappingKeys(mapping *yaml.Node, keys []string) {
+	content := mapping.Content[:0]
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		remove := false
+		for _, key := range keys {
+			if mapping.Content[i].Value == key {
+				remove = true
+				break
+			}
+		}
+		if !remove {
+			content = append(content, mapping.Content[i], mapping.Content[i+1])
+		}
+	}
+	mapping.Content = content
+}
+
+// toTaskAccessConfig converts an INGInious access entry to a TaskAccessConfig
+func (e *ingTaskAccess) toTaskAccessConfig() (TaskAccessConfig, error) {
+	config := TaskAccessConfig{
+		EvaluationMode:      e.EvaluationMode,
+		NoStoredSubmissions: e.NoStoredSubmissions,
+		SubmissionLimit:     e.SubmissionLimit,
+	}
+	if config.EvaluationMode == "" {
+		config.EvaluationMode = e.Evaluate
+	}
+	if config.NoStoredSubmissions == 0 {
+		config.NoStoredSubmissions = e.StoredSubmissions
+	}
+	if config.SubmissionLimit != nil && config.SubmissionLimit.Amount < 0 {
+		// INGInious uses amount -1 for "no limit"
+		config.SubmissionLimit = nil
+	}
+
+	raw := e.Accessibility
+	if raw == nil {
+		raw = e.Accessible
+	}
+	accessibility, err := parseINGAccessibility(raw)
+	if err != nil {
+		return config, err
+	}
+	config.Accessibility = accessibility
+	return config, nil
+}
+
+// parseINGAccessibility converts an INGInious accessibility value: a boolean
+// or a date range "start/end" or "start/end/soft_end" where any part may be
+// empty to mean unbounded
+func parseINGAccessibility(raw interface{}) (TaskAccessibility, error) {
+	switch v := raw.(type) {
+	case nil:
+		return TaskAccessibility{IsBoolean: true, BoolValue: false}, nil
+	case bool:
+		return TaskAccessibility{IsBoolean: true, BoolValue: v}, nil
+	case string:
+		parts := strings.Split(v, "/")
+		if len(parts) != 2 && len(parts) != 3 {
+			return TaskAccessibility{}, fmt.Errorf("invalid accessibility %q", v)
+		}
+		if len(parts) == 2 {
+			parts = append(parts, parts[1])
+		}
+
+		defaults := []string{"0001-01-01 00:00:00", "9999-12-31 23:59:59", ""}
+		for i := range parts {
+			parts[i] = strings.TrimSpace(parts[i])
+			if parts[i] == "" {
+				parts[i] = defaults[i]
+			}
+		}
+		if parts[2] == "" {
+			parts[2] = parts[1]
+		}
+
+		var accessibility TaskAccessibility
+		node := yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: strings.Join(parts, "/")}
+		if err := accessibility.UnmarshalYAML(&node); err != nil {
+			return TaskAccessibility{}, err
+		}
+		return accessibility, nil
+	}
+	return TaskAccessibility{}, fmt.Errorf("invalid accessibility %v", raw)
+}
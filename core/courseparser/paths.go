@@ -0,0 +1,75 @@
+package courseparser
+
+import (
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ErrPathOutsideRoot is returned when a path would resolve outside of its root directory
+var ErrPathOutsideRoot = errors.New("path escapes root directory")
+
+// SafeJoin joins a slash-separated name to root and makes sure the result,
+// after resolving symlinks, stays inside root. The name does not need to
+// exist; only its existing ancestors are resolved.
+func SafeJoin(root, name string) (string, error) {
+	if strings.ContainsRune(name, 0) || strings.Contains(name, `\`) {
+		return "", ErrPathOutsideRoot
+	}
+
+	cleaned := path.Clean("/" + name)
+	joined := filepath.Join(root, filepath.FromSlash(cleaned))
+
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return "", err
+	}
+
+	// Resolve the deepest existing ancestor so that symlinks pointing
+	// outside of the root are caught even for files about to be created
+	existing := joined
+	rest := ""
+	for {
+		if _, err := os.Lstat(existing); err == nil {
+			break
+		}
+		parent := filepath.Dir(existing)
+		if parent == existing {
+			return "", ErrPathOutsideRoot
+		}
+		rest = filepath.Join(filepath.Base(existing), rest)
+		existing = parent
+	}
+
+	resolved, err := filepath.EvalSymlinks(existing)
+	if err != nil {
+		return "", err
+	}
+	if !isWithin(realRoot, resolved) {
+		return "", ErrPathOutsideRoot
+	}
+
+	return filepath.Join(resolved, rest), nil
+}
+
+// isWithin reports whether target is root or a descendant of root
+func isWithin(root, target string) bool {
+	rel, err := filepath.Rel(root, target)
+	if err != nil {
+		return false
+	}
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)))
+}
+
+// IsCourseFile reports whether the file at path is one the course loader
+// parses, and therefore should be validated with ValidateCourseFile before
+// being written.
+func IsCourseFile(path string) bool {
+	switch filepath.Base(path) {
+	case "config.yaml", "access.yaml", "task.yaml", "book.toml":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,84 @@
+package courseparser
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSafeJoin(t *testing.T) {
+	// Resolve the temporary directories, which may be behind a symlink
+	root, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	outside, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.MkdirAll(filepath.Join(root, "tasks", "task01"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(outside, "secret"), []byte("secret"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(root, "escape")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(outside, "secret"), filepath.Join(root, "tasks", "secret")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(root, "tasks"), filepath.Join(root, "alias")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		want string // Relative to root, empty if refused
+	}{
+		{"", "."},
+		{"/", "."},
+		{"tasks/task01", "tasks/task01"},
+		{"/tasks/task01/task.yaml", "tasks/task01/task.yaml"},
+
+		// Dot segments are cleaned as if the name were rooted, so they
+		// cannot climb above the root
+		{"..", "."},
+		{"../../etc/passwd", "etc/passwd"},
+		{"tasks/../../config.yaml", "config.yaml"},
+		{"tasks/./task01/../task02", "tasks/task02"},
+
+		// Names whose parents do not exist yet, e.g. for MKCOL or PUT
+		{"tasks/task02/task.yaml", "tasks/task02/task.yaml"},
+		{"new/deeply/nested/file.py", "new/deeply/nested/file.py"},
+
+		// Symlinks are followed, and refused when they lead outside
+		{"alias/task01", "tasks/task01"},
+		{"escape", ""},
+		{"escape/secret", ""},
+		{"escape/missing/file", ""},
+		{"tasks/secret", ""},
+
+		// Characters that could be interpreted differently by the OS
+		{"tasks\\..\\..\\secret", ""},
+		{"tasks/task01\x00.yaml", ""},
+	}
+	for _, tt := range tests {
+		got, err := SafeJoin(root, tt.name)
+		if tt.want == "" {
+			if !errors.Is(err, ErrPathOutsideRoot) {
+				t.Errorf("SafeJoin(%q) = %q, %v, want ErrPathOutsideRoot", tt.name, got, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("SafeJoin(%q) failed: %v", tt.name, err)
+			continue
+		}
+		if want := filepath.Join(root, filepath.FromSlash(tt.want)); got != want {
+			t.Errorf("SafeJoin(%q) = %q, want %q", tt.name, got, want)
+		}
+	}
+}
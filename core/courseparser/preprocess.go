@@ -0,0 +1,261 @@
+package courseparser
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// maxIncludeDepth bounds nested includes, like mdBook does
+const maxIncludeDepth = 10
+
+// directivePattern matches mdBook preprocessor directives such as
+// {{#include file.py:anchor}}. A leading backslash escapes the directive.
+var directivePattern = regexp.MustCompile(`\\?\{\{\s*#([a-z_]+)\s*(.*?)\s*\}\}`)
+
+// preprocessorDirectives are the directives resolved by Preprocess. Others,
+// such as {{#task}}, are left to the renderer.
+var preprocessorDirectives = map[string]bool{"include": true, "rustdoc_include": true, "title": true}
+
+// anchorPattern matches the ANCHOR and ANCHOR_END marker lines of included files
+var anchorPattern = regexp.MustCompile(`ANCHOR(_END)?:\s*([\w-]+)`)
+
+// Preprocessed is the result of running the preprocessor on a chapter
+type Preprocessed struct {
+	Markdown string // Markdown with every directive resolved
+	Title    string // Title set with {{#title}}, empty if none
+}
+
+// preprocessor resolves the directives of a chapter and, recursively, of the
+// files it includes
+type preprocessor struct {
+	root  string   // Directory includes must stay in
+	stack []string // Files being processed, outermost first
+	title string
+}
+
+// Preprocess resolves the mdBook directives of a chapter: {{#include}} and
+// {{#rustdoc_include}} with optional line ranges or anchors, and {{#title}}.
+// Included paths are relative to the including file and must stay inside
+// root; file is the chapter path and must be inside root too.
+func Preprocess(root, file string, source []byte) (*Preprocessed, error) {
+	p := &preprocessor{root: root}
+	markdown, err := p.process(file, string(source))
+	if err != nil {
+		return nil, err
+	}
+	return &Preprocessed{Markdown: markdown, Title: p.title}, nil
+}
+
+// process resolves the directives found in the content of file
+func (p *preprocessor) process(file, content string) (string, error) {
+	p.stack = append(p.stack, file)
+	defer func() { p.stack = p.stack[:len(p.stack)-1] }()
+
+	var out strings.Builder
+	last := 0
+	for _, loc := range directivePattern.FindAllStringSubmatchIndex(content, -1) {
+		out.WriteString(content[last:loc[0]])
+		last = loc[1]
+
+		directive := content[loc[0]:loc[1]]
+		name := content[loc[2]:loc[3]]
+		arg := content[loc[4]:loc[5]]
+		line := strings.Count(content[:loc[0]], "\n") + 1
+
+		// Only our own directives are unescaped, others stay escaped for
+		// the Markdown renderer
+		if strings.HasPrefix(directive, `\`) {
+			if preprocessorDirectives[name] {
+				directive = directive[1:]
+			}
+			out.WriteString(directive)
+			continue
+		}
+
+		var replacement string
+		var err error
+		switch name {
+		case "include":
+			replacement, err = p.include(file, arg, false)
+		case "rustdoc_include":
+			replacement, err = p.include(file, arg, true)
+		case "title":
+			p.title = arg
+		default:
+			// Leave directives of other preprocessors alone
+			replacement = directive
+		}
+		if err != nil {
+			return "", p.errorAt(file, line, err)
+		}
+		out.WriteString(replacement)
+	}
+	out.WriteString(content[last:])
+
+	return out.String(), nil
+}
+
+// errorAt positions err at a line of file, unless it already comes from a
+// nested include and carries its own position
+func (p *preprocessor) errorAt(file string, line int, err error) error {
+	if parseErr, ok := err.(*ParseError); ok {
+		return parseErr
+	}
+	return &ParseError{
+		File:    p.displayName(file),
+		Line:    line,
+		Message: err.Error(),
+	}
+}
+
+// displayName returns a file path relative to the root for error messages
+func (p *preprocessor) displayName(file string) string {
+	if rel, err := filepath.Rel(p.root, file); err == nil {
+		return filepath.ToSlash(rel)
+	}
+	return file
+}
+
+// include returns the selected part of a file included from file. With
+// hideOthers (rustdoc_include), the whole file is kept and unselected lines
+// are prefixed with "# " so that rustdoc hides them.
+func (p *preprocessor) include(file, arg string, hideOthers bool) (string, error) {
+	name, selector, _ := strings.Cut(arg, ":")
+	if name == "" {
+		return "", fmt.Errorf("include without a file name")
+	}
+
+	target := filepath.Join(filepath.Dir(file), filepath.FromSlash(name))
+	rel, err := filepath.Rel(p.root, target)
+	if err != nil || !isWithin(p.root, target) {
+		return "", fmt.Errorf("cannot include %s: %w", name, ErrPathOutsideRoot)
+	}
+	resolved, err := SafeJoin(p.root, filepath.ToSlash(rel))
+	if err != nil {
+		return "", fmt.Errorf("cannot include %s: %w", name, err)
+	}
+
+	for i, open := range p.stack {
+		if open == target {
+			chain := make([]string, 0, len(p.stack)-i+1)
+			for _, f := range p.stack[i:] {
+				chain = append(chain, p.displayName(f))
+			}
+			chain = append(chain, p.displayName(target))
+			return "", fmt.Errorf("include cycle: %s", strings.Join(chain, " -> "))
+		}
+	}
+	if len(p.stack) > maxIncludeDepth {
+		return "", fmt.Errorf("includes nested more than %d levels deep", maxIncludeDepth)
+	}
+
+	data, err := os.ReadFile(resolved)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", fmt.Errorf("included file %s does not exist", name)
+		}
+		return "", fmt.Errorf("cannot include %s: %w", name, err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	selected, err := selectLines(lines, selector)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", name, err)
+	}
+
+	var kept []string
+	for i, line := range lines {
+		if anchorPattern.MatchString(line) {
+			continue
+		}
+		switch {
+		case selected[i]:
+			kept = append(kept, line)
+		case hideOthers:
+			kept = append(kept, strings.TrimRight("# "+line, " "))
+		}
+	}
+
+	return p.process(target, strings.Join(kept, "\n"))
+}
+
+// selectLines returns which lines a selector keeps: everything when empty,
+// a line ("3"), a range ("3:10", "3:", ":10") or the lines of an anchor
+func selectLines(lines []string, selector string) ([]bool, error) {
+	selected := make([]bool, len(lines))
+
+	if selector == "" {
+		for i := range selected {
+			selected[i] = true
+		}
+		return selected, nil
+	}
+
+	if start, end, isRange, err := parseLineRange(selector, len(lines)); isRange {
+		if err != nil {
+			return nil, err
+		}
+		for i := start - 1; i < end && i < len(lines); i++ {
+			selected[i] = true
+		}
+		return selected, nil
+	}
+
+	// Anchors: lines between "ANCHOR: name" and "ANCHOR_END: name"
+	inside, found := false, false
+	for i, line := range lines {
+		matches := anchorPattern.FindStringSubmatch(line)
+		if matches != nil && matches[2] == selector {
+			if matches[1] == "" {
+				inside, found = true, true
+			} else {
+				inside = false
+			}
+			continue
+		}
+		selected[i] = inside
+	}
+	if !found {
+		return nil, fmt.Errorf("anchor %q not found", selector)
+	}
+	return selected, nil
+}
+
+// parseLineRange parses a 1-based inclusive line selector. isRange is false
+// when the selector is not made of line numbers (and thus is an anchor).
+func parseLineRange(selector string, count int) (start, end int, isRange bool, err error) {
+	startText, endText, hasEnd := strings.Cut(selector, ":")
+	if !isLineNumber(startText) || !isLineNumber(endText) || (startText == "" && !hasEnd) {
+		return 0, 0, false, nil
+	}
+
+	start, end = 1, count
+	if startText != "" {
+		start, _ = strconv.Atoi(startText)
+		if !hasEnd {
+			end = start
+		}
+	}
+	if endText != "" {
+		end, _ = strconv.Atoi(endText)
+	}
+
+	if start < 1 || end < start {
+		return 0, 0, true, fmt.Errorf("invalid line range %q", selector)
+	}
+	return start, end, true, nil
+}
+
+// isLineNumber reports whether s is empty or only made of digits
+func isLineNumber(s string) bool {
+	for _, ch := range s {
+		if ch < '0' || ch > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,128 @@
+package courseparser
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeCourseFiles creates files under a temporary course directory
+func writeCourseFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	root := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+const includedPython = `import sys
+# ANCHOR: greet
+def greet(name):
+    print("Bonjour", name)
+# ANCHOR_END: greet
+
+greet(sys.argv[1])
+`
+
+func TestPreprocessIncludes(t *testing.T) {
+	root := writeCourseFiles(t, map[string]string{
+		"syllabus/src/example.py": includedPython,
+		"syllabus/src/shared.md":  "Shared {{#include example.py:1}}",
+	})
+	chapter := filepath.Join(root, "syllabus", "src", "chapter.md")
+
+	tests := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{"whole file", "{{#include example.py}}", "import sys\ndef greet(name):\n    print(\"Bonjour\", name)\n\ngreet(sys.argv[1])"},
+		{"anchor", "{{#include example.py:greet}}", "def greet(name):\n    print(\"Bonjour\", name)"},
+		{"single line", "{{#include example.py:7}}", "greet(sys.argv[1])"},
+		{"range", "{{#include example.py:3:4}}", "def greet(name):\n    print(\"Bonjour\", name)"},
+		{"open start", "{{#include example.py::1}}", "import sys"},
+		{"open end", "{{#include example.py:6:}}", "\ngreet(sys.argv[1])"},
+		{"rustdoc", "{{#rustdoc_include example.py:3:4}}", "# import sys\ndef greet(name):\n    print(\"Bonjour\", name)\n#\n# greet(sys.argv[1])"},
+		{"nested", "{{ #include shared.md }}", "Shared import sys"},
+		{"escaped", `\{{#include example.py}}`, "{{#include example.py}}"},
+		{"other preprocessor", "{{#playground example.py}}", "{{#playground example.py}}"},
+		{"course directory", "{{#include ../../syllabus/src/example.py:1}}", "import sys"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := Preprocess(root, chapter, []byte(tt.source))
+			if err != nil {
+				t.Fatalf("preprocess failed: %v", err)
+			}
+			if result.Markdown != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, result.Markdown)
+			}
+		})
+	}
+}
+
+func TestPreprocessTitle(t *testing.T) {
+	result, err := Preprocess(t.TempDir(), "chapter.md", []byte("{{#title Les boucles}}\n# Boucles\n"))
+	if err != nil {
+		t.Fatalf("preprocess failed: %v", err)
+	}
+	if result.Title != "Les boucles" {
+		t.Errorf("expected title, got %q", result.Title)
+	}
+	if result.Markdown != "\n# Boucles\n" {
+		t.Errorf("the title directive should be removed, got %q", result.Markdown)
+	}
+}
+
+func TestPreprocessErrors(t *testing.T) {
+	root := writeCourseFiles(t, map[string]string{
+		"syllabus/src/a.md":       "A\n{{#include b.md}}",
+		"syllabus/src/b.md":       "B\n\n{{#include a.md}}",
+		"syllabus/src/example.py": includedPython,
+	})
+	outside := writeCourseFiles(t, map[string]string{"secret.txt": "secret"})
+	chapter := filepath.Join(root, "syllabus", "src", "chapter.md")
+
+	tests := []struct {
+		name    string
+		source  string
+		file    string
+		line    int
+		message string
+	}{
+		{"cycle", "{{#include a.md}}", "syllabus/src/b.md", 3, "include cycle: syllabus/src/a.md -> syllabus/src/b.md -> syllabus/src/a.md"},
+		{"missing file", "text\n{{#include missing.py}}", "syllabus/src/chapter.md", 2, "included file missing.py does not exist"},
+		{"missing anchor", "{{#include example.py:nope}}", "syllabus/src/chapter.md", 1, `example.py: anchor "nope" not found`},
+		{"bad range", "{{#include example.py:5:2}}", "syllabus/src/chapter.md", 1, `example.py: invalid line range "5:2"`},
+		{"outside", "{{#include ../../../" + filepath.Base(outside) + "/secret.txt}}", "syllabus/src/chapter.md", 1, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Preprocess(root, chapter, []byte(tt.source))
+			var parseErr *ParseError
+			if !errors.As(err, &parseErr) {
+				t.Fatalf("expected a ParseError, got %v", err)
+			}
+			if parseErr.File != tt.file || parseErr.Line != tt.line {
+				t.Errorf("expected error at %s:%d, got %s:%d", tt.file, tt.line, parseErr.File, parseErr.Line)
+			}
+			if tt.message != "" && parseErr.Message != tt.message {
+				t.Errorf("expected %q, got %q", tt.message, parseErr.Message)
+			}
+			if tt.message == "" && !strings.Contains(parseErr.Message, ErrPathOutsideRoot.Error()) {
+				t.Errorf("expected an outside root error, got %q", parseErr.Message)
+			}
+		})
+	}
+}
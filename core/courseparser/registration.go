@@ -0,0 +1,141 @@
+package courseparser
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Access-control types of registration_ac. The list of registration_ac_list
+// holds usernames, email addresses (or "@domain" suffixes) or LDAP
+// "attribute=value" pairs.
+const (
+	RegistrationACUsername = "username"
+	RegistrationACEmail    = "email"
+	RegistrationACLDAP     = "ldap"
+)
+
+// Registration errors returned by CheckRegistration
+var (
+	ErrRegistrationClosed   = errors.New("registration is closed")
+	ErrRegistrationPassword = errors.New("invalid registration password")
+	ErrRegistrationDenied   = errors.New("not allowed to register to this course")
+)
+
+// Registrant is a user trying to register to a course
+type Registrant struct {
+	Username string
+	Email    string
+	// LDAP attributes by lowercase name, only needed for the ldap access
+	// control; nil for users not coming from LDAP
+	Attributes map[string][]string
+}
+
+// validateRegistration checks the registration access-control settings
+func (c *CourseConfig) validateRegistration(path string) error {
+	if c.RegistrationAC == nil {
+		return nil
+	}
+
+	switch *c.RegistrationAC {
+	case RegistrationACUsername, RegistrationACEmail:
+	case RegistrationACLDAP:
+		for _, entry := range c.RegistrationACList {
+			if name, _, ok := strings.Cut(entry, "="); !ok || strings.TrimSpace(name) == "" {
+				return &ParseError{
+					File:    path,
+					Field:   "registration_ac_list",
+					Message: fmt.Sprintf("expected attribute=value, got %q", entry),
+				}
+			}
+		}
+	default:
+		return &ParseError{
+			File:    path,
+			Field:   "registration_ac",
+			Message: fmt.Sprintf("unknown access control %q, expected username, email or ldap", *c.RegistrationAC),
+		}
+	}
+	return nil
+}
+
+// RequiresRegistrationPassword reports whether registering needs a password
+func (c *CourseConfig) RequiresRegistrationPassword() bool {
+	return c.RegistrationPassword != nil && *c.RegistrationPassword != ""
+}
+
+// RegistrationAttributes returns the LDAP attributes the access control
+// needs, lowercased, or nil when it does not use LDAP
+func (c *CourseConfig) RegistrationAttributes() []string {
+	if c.RegistrationAC == nil || *c.RegistrationAC != RegistrationACLDAP {
+		return nil
+	}
+
+	var names []string
+	for _, entry := range c.RegistrationACList {
+		name, _, _ := strings.Cut(entry, "=")
+		names = appendUnique(names, strings.ToLower(strings.TrimSpace(name)))
+	}
+	return names
+}
+
+// RegistrationAllowed reports whether the access control lets the user
+// register. registration_ac_accept makes the list an allow list, otherwise
+// it is a deny list.
+func (c *CourseConfig) RegistrationAllowed(r Registrant) bool {
+	if c.RegistrationAC == nil {
+		return true
+	}
+
+	listed := false
+	for _, entry := range c.RegistrationACList {
+		if registrantMatches(*c.RegistrationAC, entry, r) {
+			listed = true
+			break
+		}
+	}
+	return listed == c.RegistrationACAccept
+}
+
+// registrantMatches reports whether an entry of the access-control list
+// designates the user
+func registrantMatches(ac, entry string, r Registrant) bool {
+	entry = strings.TrimSpace(entry)
+	switch ac {
+	case RegistrationACUsername:
+		return strings.EqualFold(entry, r.Username)
+	case RegistrationACEmail:
+		if r.Email == "" {
+			return false
+		}
+		if strings.HasPrefix(entry, "@") {
+			return strings.HasSuffix(strings.ToLower(r.Email), strings.ToLower(entry))
+		}
+		return strings.EqualFold(entry, r.Email)
+	case RegistrationACLDAP:
+		name, value, _ := strings.Cut(entry, "=")
+		for _, v := range r.Attributes[strings.ToLower(strings.TrimSpace(name))] {
+			if strings.EqualFold(v, strings.TrimSpace(value)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// CheckRegistration returns why the user may not register to the course
+// with the given password, or nil if they may
+func (c *CourseConfig) CheckRegistration(r Registrant, password string) error {
+	if !c.Registration {
+		return ErrRegistrationClosed
+	}
+	if !c.RegistrationAllowed(r) {
+		return ErrRegistrationDenied
+	}
+	if c.RequiresRegistrationPassword() &&
+		subtle.ConstantTimeCompare([]byte(password), []byte(*c.RegistrationPassword)) != 1 {
+		return ErrRegistrationPassword
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package courseparser
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCheckRegistration(t *testing.T) {
+	alice := Registrant{
+		Username:   "alice",
+		Email:      "alice@student.uclouvain.be",
+		Attributes: map[string][]string{"ou": {"INFO", "SINF"}},
+	}
+	bob := Registrant{Username: "bob", Email: "bob@example.com"}
+
+	tests := []struct {
+		name     string
+		config   string
+		user     Registrant
+		password string
+		want     error
+	}{
+		{"open", "registration: true", bob, "", nil},
+		{"closed", "registration: false", bob, "", ErrRegistrationClosed},
+		{"password", "registration: true\nregistration_password: secret", bob, "secret", nil},
+		{"wrong password", "registration: true\nregistration_password: secret", bob, "guess", ErrRegistrationPassword},
+		{"empty password", "registration: true\nregistration_password: ''", bob, "", nil},
+		{"username allowed", "registration: true\nregistration_ac: username\nregistration_ac_accept: true\nregistration_ac_list: [Alice]", alice, "", nil},
+		{"username not allowed", "registration: true\nregistration_ac: username\nregistration_ac_accept: true\nregistration_ac_list: [alice]", bob, "", ErrRegistrationDenied},
+		{"username denied", "registration: true\nregistration_ac: username\nregistration_ac_accept: false\nregistration_ac_list: [alice]", alice, "", ErrRegistrationDenied},
+		{"username not denied", "registration: true\nregistration_ac: username\nregistration_ac_accept: false\nregistration_ac_list: [alice]", bob, "", nil},
+		{"email domain", "registration: true\nregistration_ac: email\nregistration_ac_accept: true\nregistration_ac_list: ['@student.uclouvain.be']", alice, "", nil},
+		{"email address", "registration: true\nregistration_ac: email\nregistration_ac_accept: true\nregistration_ac_list: [bob@example.com]", bob, "", nil},
+		{"email other domain", "registration: true\nregistration_ac: email\nregistration_ac_accept: true\nregistration_ac_list: ['@student.uclouvain.be']", bob, "", ErrRegistrationDenied},
+		{"ldap attribute", "registration: true\nregistration_ac: ldap\nregistration_ac_accept: true\nregistration_ac_list: [OU=sinf]", alice, "", nil},
+		{"ldap without attributes", "registration: true\nregistration_ac: ldap\nregistration_ac_accept: true\nregistration_ac_list: [ou=SINF]", bob, "", ErrRegistrationDenied},
+		{"denied before password", "registration: true\nregistration_password: secret\nregistration_ac: username\nregistration_ac_accept: true\nregistration_ac_list: []", bob, "secret", ErrRegistrationDenied},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := ParseCourseConfigData("config.yaml", []byte(tt.config))
+			if err != nil {
+				t.Fatalf("failed to parse: %v", err)
+			}
+			if err := config.CheckRegistration(tt.user, tt.password); !errors.Is(err, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestRegistrationAttributes(t *testing.T) {
+	config, err := ParseCourseConfigData("config.yaml", []byte("registration_ac: ldap\nregistration_ac_list: [ou=INFO, OU=SINF, memberOf=cn=students]"))
+	if err != nil {
+		t.Fatalf("failed to parse: %v", err)
+	}
+	names := config.RegistrationAttributes()
+	if len(names) != 2 || names[0] != "ou" || names[1] != "memberof" {
+		t.Errorf("expected [ou memberof], got %v", names)
+	}
+}
+
+func TestParseRegistrationErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		field  string
+	}{
+		{"unknown access control", "registration_ac: binding", "registration_ac"},
+		{"ldap entry without value", "registration_ac: ldap\nregistration_ac_list: [INFO]", "registration_ac_list"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseCourseConfigData("config.yaml", []byte(tt.config))
+			var parseErr *ParseError
+			if !errors.As(err, &parseErr) {
+				t.Fatalf("expected a ParseError, got %v", err)
+			}
+			if parseErr.Field != tt.field {
+				t.Errorf("expected field %q, got %q", tt.field, parseErr.Field)
+			}
+		})
+	}
+}
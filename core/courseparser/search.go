@@ -0,0 +1,438 @@
+package courseparser
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// SearchKind is the kind of a searchable document
+type SearchKind string
+
+const (
+	SearchChapter SearchKind = "chapter" // A section of a syllabus chapter
+	SearchTask    SearchKind = "task"    // A task name and context
+	SearchProblem SearchKind = "problem" // A problem name and header
+)
+
+// Search scoring: title matches weigh more than body matches, and prefix
+// matches ("boucl" for "boucles") less than whole words
+const (
+	searchTitleWeight  = 3.0
+	searchPrefixWeight = 0.6
+	searchMinPrefixLen = 3
+	searchSnippetLen   = 160
+)
+
+// SearchHit is a search result
+type SearchHit struct {
+	Kind        SearchKind
+	Title       string
+	TaskID      string // For tasks and problems
+	ProblemID   string // For problems
+	ChapterPath string // For chapters, relative to the syllabus directory
+	Anchor      string // Heading ID of the chapter section, if any
+	Snippet     string // Extract of the text around the first match
+	Score       float64
+}
+
+// SearchIndex is an in-memory full-text index of a course. Matching ignores
+// case and accents, so "etudiant" finds "Étudiant".
+type SearchIndex struct {
+	docs     []searchDoc
+	postings map[string][]searchPosting // Term -> documents containing it
+}
+
+// searchDoc is an indexed document; hits are built from it
+type searchDoc struct {
+	hit    SearchHit
+	text   string        // Plain text the snippet is taken from
+	tokens []searchToken // Tokens of text
+	length int           // Number of tokens in title and text
+}
+
+// searchToken is a normalized word and its byte offsets in the original text
+type searchToken struct {
+	term       string
+	start, end int
+}
+
+// searchPosting counts the occurrences of a term in a document
+type searchPosting struct {
+	doc     int
+	inTitle int
+	inText  int
+}
+
+// BuildSearchIndex indexes the syllabus chapters, tasks and problems of a
+// course. Chapters that fail to render are left out.
+func BuildSearchIndex(course *ParsedCourse) *SearchIndex {
+	index := &SearchIndex{postings: make(map[string][]searchPosting)}
+
+	taskIDs := make([]string, 0, len(course.Tasks))
+	for taskID := range course.Tasks {
+		taskIDs = append(taskIDs, taskID)
+	}
+	sort.Strings(taskIDs)
+
+	for _, taskID := range taskIDs {
+		task := course.Tasks[taskID]
+		index.add(SearchHit{Kind: SearchTask, Title: task.Name, TaskID: taskID}, markdownText(task.Context))
+		for _, op := range task.Problems.Problems {
+			index.add(SearchHit{
+				Kind:      SearchProblem,
+				Title:     op.Problem.GetName(),
+				TaskID:    taskID,
+				ProblemID: op.ID,
+			}, markdownText(op.Problem.GetHeader()))
+		}
+	}
+
+	if course.Syllabus != nil {
+		for _, chapterPath := range course.Syllabus.chapterPaths() {
+			chapter, err := course.Syllabus.Chapter(chapterPath, RenderOptions{})
+			if err != nil {
+				continue
+			}
+			for _, section := range markdownSections([]byte(chapter.Markdown)) {
+				title := section.title
+				if title == "" {
+					title = chapter.Title
+				}
+				index.add(SearchHit{
+					Kind:        SearchChapter,
+					Title:       title,
+					ChapterPath: chapter.Path,
+					Anchor:      section.anchor,
+				}, section.text)
+			}
+		}
+	}
+
+	return index
+}
+
+// chapterPaths returns the paths of the chapters listed in the summary
+func (s *Syllabus) chapterPaths() []string {
+	var paths []string
+	var walk func(entries []SummaryEntry)
+	walk = func(entries []SummaryEntry) {
+		for _, entry := range entries {
+			if entry.Path != "" {
+				paths = append(paths, entry.Path)
+			}
+			walk(entry.Children)
+		}
+	}
+	walk(s.Summary)
+	return paths
+}
+
+// add indexes a document
+func (x *SearchIndex) add(hit SearchHit, body string) {
+	titleTokens := tokenize(hit.Title)
+	bodyTokens := tokenize(body)
+	if len(titleTokens) == 0 && len(bodyTokens) == 0 {
+		return
+	}
+
+	doc := len(x.docs)
+	x.docs = append(x.docs, searchDoc{
+		hit:    hit,
+		text:   body,
+		tokens: bodyTokens,
+		length: len(titleTokens) + len(bodyTokens),
+	})
+
+	counts := make(map[string]*searchPosting)
+	for _, token := range titleTokens {
+		if counts[token.term] == nil {
+			counts[token.term] = &searchPosting{doc: doc}
+		}
+		counts[token.term].inTitle++
+	}
+	for _, token := range bodyTokens {
+		if counts[token.term] == nil {
+			counts[token.term] = &searchPosting{doc: doc}
+		}
+		counts[token.term].inText++
+	}
+	for term, posting := range counts {
+		x.postings[term] = append(x.postings[term], *posting)
+	}
+}
+
+// Search returns up to limit hits matching every word of the query, best
+// first. Tasks and problems are only returned when visible reports their
+// task as visible; a nil visible shows everything.
+func (x *SearchIndex) Search(query string, limit int, visible func(taskID string) bool) []SearchHit {
+	var terms []string
+	for _, token := range tokenize(query) {
+		terms = append(terms, token.term)
+	}
+	if len(terms) == 0 {
+		return nil
+	}
+
+	scores := make(map[int]float64)
+	for i, term := range terms {
+		termScores := x.scoreTerm(term)
+		// Documents must match every term
+		if i == 0 {
+			scores = termScores
+			continue
+		}
+		for doc := range scores {
+			if termScore, ok := termScores[doc]; ok {
+				scores[doc] += termScore
+			} else {
+				delete(scores, doc)
+			}
+		}
+	}
+
+	hits := make([]SearchHit, 0, len(scores))
+	for doc, score := range scores {
+		hit := x.docs[doc].hit
+		if hit.TaskID != "" && visible != nil && !visible(hit.TaskID) {
+			continue
+		}
+		hit.Score = score
+		hit.Snippet = x.docs[doc].snippet(terms)
+		hits = append(hits, hit)
+	}
+
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].Title < hits[j].Title
+	})
+	if limit > 0 && len(hits) > limit {
+		hits = hits[:limit]
+	}
+	return hits
+}
+
+// scoreTerm scores every document containing the term, or a word it prefixes
+func (x *SearchIndex) scoreTerm(term string) map[int]float64 {
+	scores := make(map[int]float64)
+	for indexed, postings := range x.postings {
+		weight := 1.0
+		if indexed != term {
+			if len(term) < searchMinPrefixLen || !strings.HasPrefix(indexed, term) {
+				continue
+			}
+			weight = searchPrefixWeight
+		}
+
+		idf := math.Log(1 + float64(len(x.docs))/float64(len(postings)))
+		for _, posting := range postings {
+			frequency := searchTitleWeight*float64(posting.inTitle) + float64(posting.inText)
+			length := 1 + math.Log(float64(x.docs[posting.doc].length))
+			score := weight * idf * frequency / length
+			if score > scores[posting.doc] {
+				scores[posting.doc] = score
+			}
+		}
+	}
+	return scores
+}
+
+// snippet returns the text around the first token matching one of the terms
+func (d *searchDoc) snippet(terms []string) string {
+	if d.text == "" {
+		return ""
+	}
+
+	start := 0
+	for _, token := range d.tokens {
+		if matchesAnyTerm(token.term, terms) {
+			start = token.start
+			break
+		}
+	}
+
+	// Start a little before the match, on a word boundary
+	from := start - searchSnippetLen/4
+	if from < 0 {
+		from = 0
+	} else if space := strings.IndexAny(d.text[from:start], " \n\t"); space >= 0 {
+		from += space + 1
+	}
+	to := from + searchSnippetLen
+	if to >= len(d.text) {
+		to = len(d.text)
+	} else if space := strings.LastIndexAny(d.text[start:to], " \n\t"); space > 0 {
+		to = start + space
+	}
+
+	// Without whitespace in the window, the bounds may fall inside a
+	// multi-byte character
+	for from < start && !utf8.RuneStart(d.text[from]) {
+		from++
+	}
+	for to > start && to < len(d.text) && !utf8.RuneStart(d.text[to]) {
+		to--
+	}
+
+	snippet := strings.Join(strings.Fields(d.text[from:to]), " ")
+	if from > 0 {
+		snippet = "…" + snippet
+	}
+	if to < len(d.text) {
+		snippet += "…"
+	}
+	return snippet
+}
+
+func matchesAnyTerm(term string, terms []string) bool {
+	for _, t := range terms {
+		if term == t || (len(t) >= searchMinPrefixLen && strings.HasPrefix(term, t)) {
+			return true
+		}
+	}
+	return false
+}
+
+// foldAccents removes diacritics: "Étudiant" becomes "Etudiant"
+var foldAccents = transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+
+// tokenize splits text into lowercase, accent-free words of at least two
+// characters, keeping their offsets in text
+func tokenize(s string) []searchToken {
+	var tokens []searchToken
+	start := -1
+	flush := func(end int) {
+		if start < 0 {
+			return
+		}
+		word := s[start:end]
+		start = -1
+
+		folded, _, err := transform.String(foldAccents, strings.ToLower(word))
+		if err != nil {
+			folded = strings.ToLower(word)
+		}
+		folded = strings.NewReplacer("œ", "oe", "æ", "ae").Replace(folded)
+		if len([]rune(folded)) < 2 {
+			return
+		}
+		tokens = append(tokens, searchToken{term: folded, start: end - len(word), end: end})
+	}
+
+	for i, ch := range s {
+		if unicode.IsLetter(ch) || unicode.IsDigit(ch) || unicode.Is(unicode.Mn, ch) {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		flush(i)
+	}
+	flush(len(s))
+	return tokens
+}
+
+// markdownSection is the plain text under a heading of a Markdown document
+type markdownSection struct {
+	anchor string // Heading ID, empty for the text before the first heading
+	title  string
+	text   string
+}
+
+// searchMarkdown parses Markdown for indexing, with the heading IDs the
+// renderer generates
+var searchMarkdown = goldmark.New(
+	goldmark.WithExtensions(extension.GFM),
+	goldmark.WithParserOptions(parser.WithAutoHeadingID()),
+)
+
+// markdownSections splits Markdown into plain-text sections, one per heading
+func markdownSections(source []byte) []markdownSection {
+	doc := searchMarkdown.Parser().Parse(text.NewReader(source))
+
+	sections := []markdownSection{{}}
+	var body strings.Builder
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			if n.Type() == ast.TypeBlock {
+				body.WriteString("\n")
+			}
+			return ast.WalkContinue, nil
+		}
+
+		switch node := n.(type) {
+		case *ast.Heading:
+			sections[len(sections)-1].text = body.String()
+			body.Reset()
+
+			section := markdownSection{title: nodeText(node, source)}
+			if id, ok := node.AttributeString("id"); ok {
+				if b, ok := id.([]byte); ok {
+					section.anchor = string(b)
+				}
+			}
+			sections = append(sections, section)
+			return ast.WalkSkipChildren, nil
+		case *ast.Text:
+			body.Write(node.Segment.Value(source))
+			if node.SoftLineBreak() || node.HardLineBreak() {
+				body.WriteString(" ")
+			}
+		case *ast.String:
+			body.Write(node.Value)
+		case *ast.FencedCodeBlock, *ast.CodeBlock:
+			for i := 0; i < n.Lines().Len(); i++ {
+				line := n.Lines().At(i)
+				body.Write(line.Value(source))
+			}
+		}
+		return ast.WalkContinue, nil
+	})
+	sections[len(sections)-1].text = body.String()
+
+	// Drop the empty preamble of chapters starting with a heading
+	if strings.TrimSpace(sections[0].text) == "" {
+		sections = sections[1:]
+	}
+	return sections
+}
+
+// markdownText returns the plain text of a Markdown snippet
+func markdownText(source string) string {
+	var parts []string
+	for _, section := range markdownSections([]byte(source)) {
+		parts = append(parts, section.title, section.text)
+	}
+	return strings.TrimSpace(strings.Join(parts, "\n"))
+}
+
+// nodeText returns the plain text of an inline container such as a heading
+func nodeText(n ast.Node, source []byte) string {
+	var b strings.Builder
+	ast.Walk(n, func(child ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch node := child.(type) {
+		case *ast.Text:
+			b.Write(node.Segment.Value(source))
+		case *ast.String:
+			b.Write(node.Value)
+		}
+		return ast.WalkContinue, nil
+	})
+	return strings.TrimSpace(b.String())
+}
@@ -0,0 +1,81 @@
+package courseparser
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestSearchIndex(t *testing.T) {
+	course, err := NewCourseLoader().LoadCourse(testCourseDir)
+	if err != nil {
+		t.Fatalf("failed to load course: %v", err)
+	}
+	index := BuildSearchIndex(course)
+
+	// Accents and case are ignored in both directions
+	for _, query := range []string{"complexite", "COMPLEXITÉ", "complexité"} {
+		hits := index.Search(query, 0, nil)
+		if len(hits) == 0 || hits[0].Kind != SearchChapter || hits[0].Title != "Complexité Algorithmique" {
+			t.Errorf("%q: expected the complexity section first, got %+v", query, hits)
+		}
+	}
+
+	// Every word must match, prefixes included
+	hits := index.Search("liste chain", 0, nil)
+	if len(hits) == 0 {
+		t.Fatal("expected hits for a prefix query")
+	}
+	for _, hit := range hits {
+		if !strings.Contains(strings.ToLower(hit.Snippet+hit.Title), "chaîn") {
+			t.Errorf("hit does not match every word: %+v", hit)
+		}
+	}
+	if hits[0].ChapterPath != "src/chapter3_data_structures.md" || hits[0].Anchor == "" {
+		t.Errorf("expected a link to the linked list section, got %+v", hits[0])
+	}
+
+	// Problems link to their task, and hidden tasks are filtered out
+	hits = index.Search("base64", 0, nil)
+	if len(hits) != 2 || hits[0].Kind != SearchTask || hits[1].ProblemID == "" || hits[1].TaskID != "task01" {
+		t.Fatalf("expected task01 and its problem, got %+v", hits)
+	}
+	hidden := index.Search("base64", 0, func(taskID string) bool { return taskID != "task01" })
+	if len(hidden) != 0 {
+		t.Errorf("hidden task should not be found, got %+v", hidden)
+	}
+
+	if hits := index.Search("complexite", 1, nil); len(hits) != 1 {
+		t.Errorf("expected the limit to apply, got %d hits", len(hits))
+	}
+	if hits := index.Search("  ,; ", 0, nil); hits != nil {
+		t.Errorf("empty query should find nothing, got %+v", hits)
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	var terms []string
+	for _, token := range tokenize("L'Élève a créé un cœur: naïveté_2") {
+		terms = append(terms, token.term)
+	}
+	want := "eleve cree un coeur naivete"
+	if got := strings.Join(terms, " "); got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+func TestSnippetKeepsCharactersWhole(t *testing.T) {
+	// Without whitespace, the snippet bounds fall wherever the byte offsets
+	// do; each padding shifts them by one byte
+	for pad := range 4 {
+		text := strings.Repeat("a", pad) + strings.Repeat("é", 100) + ",fenêtre," + strings.Repeat("à", 200)
+		doc := searchDoc{text: text, tokens: tokenize(text)}
+		snippet := doc.snippet([]string{"fenetre"})
+		if !utf8.ValidString(snippet) {
+			t.Errorf("pad %d: invalid UTF-8 in %q", pad, snippet)
+		}
+		if !strings.Contains(snippet, "fenêtre") || !strings.HasPrefix(snippet, "…é") || !strings.HasSuffix(snippet, "à…") {
+			t.Errorf("pad %d: unexpected snippet %q", pad, snippet)
+		}
+	}
+}
@@ -0,0 +1,382 @@
+package courseparser
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// SummaryKind is the kind of a SUMMARY.md entry
+type SummaryKind int
+
+const (
+	SummaryChapter   SummaryKind = iota // A link to a chapter, possibly a draft
+	SummaryPart                         // A "# Title" heading grouping numbered chapters
+	SummarySeparator                    // A "---" line
+)
+
+// String returns the name of the entry kind
+func (k SummaryKind) String() string {
+	switch k {
+	case SummaryPart:
+		return "part"
+	case SummarySeparator:
+		return "separator"
+	}
+	return "chapter"
+}
+
+// SummaryEntry represents a single entry in the SUMMARY.md table of contents.
+//
+// The top level holds, in order, the prefix chapters, the numbered section
+// and the suffix chapters, with separators anywhere in between. Numbered
+// chapters are nested in the part they belong to, if any.
+type SummaryEntry struct {
+	Kind     SummaryKind
+	Title    string         // Display title
+	Path     string         // Relative path to the markdown file, empty for drafts
+	Number   string         // Section number such as "1.2." for numbered chapters
+	Level    int            // Nesting level (0 = part heading or separator, 1+ = chapters)
+	Draft    bool           // Chapter without a file yet: [Title]()
+	Children []SummaryEntry // Nested entries
+}
+
+// summarySection is the part of SUMMARY.md being parsed
+type summarySection int
+
+const (
+	summaryPrefix summarySection = iota
+	summaryNumbered
+	summarySuffix
+)
+
+// summaryHeadingPattern matches a part heading: # Part title
+var summaryHeadingPattern = regexp.MustCompile(`^#{1,6}\s+(.+?)(\s+#+)?\s*$`)
+
+// summaryListPattern matches a list item: - [Title](path.md)
+var summaryListPattern = regexp.MustCompile(`^([-*+])(\s+)(.*)$`)
+
+// summaryCommentPattern matches an HTML comment within a line
+var summaryCommentPattern = regexp.MustCompile(`<!--.*?-->`)
+
+// summaryNode is an entry being built, with children that can still grow
+type summaryNode struct {
+	entry    SummaryEntry
+	children []*summaryNode
+	numbered int // Numbered children so far
+}
+
+// summaryListLevel is an open list item and the indentation of its marker
+type summaryListLevel struct {
+	indent int
+	node   *summaryNode
+}
+
+// summaryParser builds the SUMMARY.md tree line by line
+type summaryParser struct {
+	file         string
+	top          []*summaryNode
+	section      summarySection
+	started      bool         // Whether any element (or the title) was seen
+	part         *summaryNode // Current part, nil before the first one
+	partHasItems bool         // Whether the current part has numbered chapters
+	list         []summaryListLevel
+	numbered     int // Numbered chapters at the top of the numbered section
+}
+
+// ParseSummary parses a SUMMARY.md file and returns the table of contents entries
+func ParseSummary(path string) ([]SummaryEntry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, &ParseError{
+			File:    path,
+			Message: "failed to open file",
+			Err:     err,
+		}
+	}
+	return ParseSummaryData(path, data)
+}
+
+// ParseSummaryData parses the contents of a SUMMARY.md file following the
+// mdBook grammar: an optional title, prefix chapters, numbered chapters
+// (nested lists, optionally grouped in "#" parts), then suffix chapters.
+// Drafts are written [Title]() and "---" lines are separators. As an
+// extension, plain links right after a part title are kept as unnumbered
+// chapters of that part. Errors carry the line and column of the problem.
+func ParseSummaryData(path string, data []byte) ([]SummaryEntry, error) {
+	p := &summaryParser{file: path}
+
+	lines := strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n")
+	commentLine := 0
+	for i, raw := range lines {
+		lineNo := i + 1
+		line := expandTabs(raw)
+
+		// HTML comments are ignored, even across lines. Comments within a
+		// line are blanked out so that columns stay right.
+		if commentLine > 0 {
+			end := strings.Index(line, "-->")
+			if end < 0 {
+				continue
+			}
+			commentLine = 0
+			line = strings.Repeat(" ", end+len("-->")) + line[end+len("-->"):]
+		}
+		line = summaryCommentPattern.ReplaceAllStringFunc(line, func(comment string) string {
+			return strings.Repeat(" ", len(comment))
+		})
+		if start := strings.Index(line, "<!--"); start >= 0 {
+			commentLine = lineNo
+			line = line[:start]
+		}
+
+		line = strings.TrimRight(line, " ")
+		trimmed := strings.TrimSpace(line)
+
+		if trimmed == "" {
+			continue
+		}
+
+		indent := len(line) - len(strings.TrimLeft(line, " "))
+		if err := p.parseLine(lineNo, indent, line[indent:]); err != nil {
+			return nil, err
+		}
+	}
+
+	if commentLine > 0 {
+		return nil, p.errorAt(commentLine, 1, "unterminated HTML comment")
+	}
+
+	return convertSummaryNodes(p.top), nil
+}
+
+// expandTabs replaces tabs with spaces up to the next multiple of 4 columns
+func expandTabs(s string) string {
+	if !strings.Contains(s, "\t") {
+		return s
+	}
+	var b strings.Builder
+	for _, ch := range s {
+		if ch == '\t' {
+			b.WriteString(strings.Repeat(" ", 4-b.Len()%4))
+		} else {
+			b.WriteRune(ch)
+		}
+	}
+	return b.String()
+}
+
+// parseLine handles a non-empty line whose content starts after indent spaces
+func (p *summaryParser) parseLine(lineNo, indent int, content string) error {
+	column := indent + 1
+
+	if matches := summaryHeadingPattern.FindStringSubmatch(content); matches != nil && indent < 4 {
+		// A heading before anything else is the title of the summary
+		if !p.started {
+			p.started = true
+			return nil
+		}
+		if p.section == summarySuffix {
+			return p.errorAt(lineNo, column, "part titles cannot follow suffix chapters")
+		}
+
+		p.section = summaryNumbered
+		p.part = &summaryNode{entry: SummaryEntry{Kind: SummaryPart, Title: matches[1]}}
+		p.top = append(p.top, p.part)
+		p.partHasItems = false
+		p.list = nil
+		return nil
+	}
+
+	p.started = true
+
+	if isSummarySeparator(content) {
+		if indent > 0 && len(p.list) > 0 {
+			return p.errorAt(lineNo, column, "separators cannot be nested")
+		}
+		p.list = nil
+		p.appendTop(&summaryNode{entry: SummaryEntry{Kind: SummarySeparator}})
+		return nil
+	}
+
+	if matches := summaryListPattern.FindStringSubmatch(content); matches != nil {
+		linkColumn := column + len(matches[1]) + len(matches[2])
+		if p.section == summarySuffix {
+			return p.errorAt(lineNo, column, "numbered chapters cannot follow suffix chapters")
+		}
+		entry, err := p.parseLink(lineNo, linkColumn, matches[3])
+		if err != nil {
+			return err
+		}
+		p.section = summaryNumbered
+		return p.addNumbered(lineNo, indent, entry)
+	}
+
+	if strings.HasPrefix(content, "[") {
+		if indent > 0 && len(p.list) > 0 {
+			return p.errorAt(lineNo, column, "unnumbered chapters cannot be nested")
+		}
+		entry, err := p.parseLink(lineNo, column, content)
+		if err != nil {
+			return err
+		}
+		entry.Level = 1
+		node := &summaryNode{entry: entry}
+		p.list = nil
+
+		switch {
+		case p.section == summaryNumbered && p.part != nil && !p.partHasItems:
+			p.part.children = append(p.part.children, node)
+		case p.section == summaryNumbered:
+			p.section = summarySuffix
+			p.top = append(p.top, node)
+		default:
+			p.top = append(p.top, node)
+		}
+		return nil
+	}
+
+	return p.errorAt(lineNo, column, "expected a chapter link, a list item, a part title or a separator")
+}
+
+// appendTop adds an entry at the top of the current part, or of the summary
+func (p *summaryParser) appendTop(node *summaryNode) {
+	if p.section == summaryNumbered && p.part != nil {
+		p.part.children = append(p.part.children, node)
+		return
+	}
+	p.top = append(p.top, node)
+}
+
+// addNumbered places a list item in the tree according to its indentation
+// and gives it its section number
+func (p *summaryParser) addNumbered(lineNo, indent int, entry SummaryEntry) error {
+	popped := -1
+	for len(p.list) > 0 && p.list[len(p.list)-1].indent >= indent {
+		popped = p.list[len(p.list)-1].indent
+		p.list = p.list[:len(p.list)-1]
+	}
+	if popped >= 0 && popped != indent {
+		return p.errorAt(lineNo, indent+1, "inconsistent indentation")
+	}
+
+	node := &summaryNode{entry: entry}
+	node.entry.Level = len(p.list) + 1
+
+	if len(p.list) == 0 {
+		p.numbered++
+		node.entry.Number = fmt.Sprintf("%d.", p.numbered)
+		p.appendTop(node)
+	} else {
+		parent := p.list[len(p.list)-1].node
+		parent.numbered++
+		node.entry.Number = fmt.Sprintf("%s%d.", parent.entry.Number, parent.numbered)
+		parent.children = append(parent.children, node)
+	}
+
+	p.list = append(p.list, summaryListLevel{indent: indent, node: node})
+	p.partHasItems = true
+	return nil
+}
+
+// parseLink parses a chapter link, [Title](path.md) or [Title]() for a
+// draft. column is the column of s on the line, used in errors.
+func (p *summaryParser) parseLink(lineNo, column int, s string) (SummaryEntry, error) {
+	if !strings.HasPrefix(s, "[") {
+		return SummaryEntry{}, p.errorAt(lineNo, column, "expected a link such as [Title](chapter.md)")
+	}
+
+	// Find the bracket closing the title, allowing nested and escaped ones
+	end := -1
+	depth := 0
+	for i := 0; i < len(s) && end < 0; i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '[':
+			depth++
+		case ']':
+			depth--
+			if depth == 0 {
+				end = i
+			}
+		}
+	}
+	if end < 0 {
+		return SummaryEntry{}, p.errorAt(lineNo, column, "unclosed '[' in link title")
+	}
+
+	title := strings.TrimSpace(s[1:end])
+	if title == "" {
+		return SummaryEntry{}, p.errorAt(lineNo, column+1, "empty chapter title")
+	}
+
+	rest := s[end+1:]
+	if !strings.HasPrefix(rest, "(") {
+		return SummaryEntry{}, p.errorAt(lineNo, column+end+1, "expected '(' after the link title")
+	}
+	closing := strings.IndexByte(rest, ')')
+	if closing < 0 {
+		return SummaryEntry{}, p.errorAt(lineNo, column+end+1, "unclosed '(' in link target")
+	}
+	if trailing := rest[closing+1:]; strings.TrimSpace(trailing) != "" {
+		return SummaryEntry{}, p.errorAt(lineNo, column+end+1+closing+1, "unexpected text after the link")
+	}
+
+	entry := SummaryEntry{Kind: SummaryChapter, Title: title}
+	target := strings.TrimSpace(rest[1:closing])
+	target = strings.TrimSuffix(strings.TrimPrefix(target, "<"), ">")
+	if target == "" {
+		entry.Draft = true
+		return entry, nil
+	}
+	if unescaped, err := url.PathUnescape(target); err == nil {
+		target = unescaped
+	}
+	entry.Path = target
+	return entry, nil
+}
+
+// errorAt returns a ParseError positioned at the given line and column
+func (p *summaryParser) errorAt(line, column int, message string) error {
+	return &ParseError{
+		File:    p.file,
+		Line:    line,
+		Column:  column,
+		Message: message,
+	}
+}
+
+// isSummarySeparator reports whether s is a thematic break such as "---"
+func isSummarySeparator(s string) bool {
+	marker := s[0]
+	if marker != '-' && marker != '*' && marker != '_' {
+		return false
+	}
+	count := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case marker:
+			count++
+		case ' ':
+		default:
+			return false
+		}
+	}
+	return count >= 3
+}
+
+// convertSummaryNodes turns the nodes built by the parser into entries
+func convertSummaryNodes(nodes []*summaryNode) []SummaryEntry {
+	if len(nodes) == 0 {
+		return nil
+	}
+	entries := make([]SummaryEntry, len(nodes))
+	for i, node := range nodes {
+		entries[i] = node.entry
+		entries[i].Children = convertSummaryNodes(node.children)
+	}
+	return entries
+}
@@ -0,0 +1,219 @@
+package courseparser
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+// summaryOutline flattens entries into "number title" lines, indented by
+// depth, so that whole trees can be compared at once
+func summaryOutline(entries []SummaryEntry, depth int) []string {
+	var lines []string
+	for _, entry := range entries {
+		line := ""
+		for i := 0; i < depth; i++ {
+			line += "  "
+		}
+		switch entry.Kind {
+		case SummarySeparator:
+			line += "---"
+		case SummaryPart:
+			line += "# " + entry.Title
+		default:
+			if entry.Number != "" {
+				line += entry.Number + " "
+			}
+			line += entry.Title
+			if entry.Draft {
+				line += " (draft)"
+			}
+		}
+		lines = append(lines, line)
+		lines = append(lines, summaryOutline(entry.Children, depth+1)...)
+	}
+	return lines
+}
+
+func assertOutline(t *testing.T, entries []SummaryEntry, want []string) {
+	t.Helper()
+	got := summaryOutline(entries, 0)
+	if len(got) != len(want) {
+		t.Fatalf("expected %d entries, got %d:\n%q", len(want), len(got), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("entry %d: expected %q, got %q", i, want[i], got[i])
+		}
+	}
+}
+
+func TestParseSummaryAffixChapters(t *testing.T) {
+	entries, err := ParseSummaryData("SUMMARY.md", []byte(`# Summary
+
+[Preface](preface.md)
+[Foreword](foreword.md)
+
+- [Basics](basics.md)
+
+[Glossary](glossary.md)
+[Contributors](contributors.md)
+`))
+	if err != nil {
+		t.Fatalf("failed to parse: %v", err)
+	}
+	assertOutline(t, entries, []string{
+		"Preface",
+		"Foreword",
+		"1. Basics",
+		"Glossary",
+		"Contributors",
+	})
+	if entries[0].Path != "preface.md" || entries[0].Level != 1 {
+		t.Errorf("unexpected prefix chapter: %+v", entries[0])
+	}
+}
+
+func TestParseSummaryNesting(t *testing.T) {
+	entries, err := ParseSummaryData("SUMMARY.md", []byte(`- [Loops](loops.md)
+  - [For](loops/for.md)
+  - [While](loops/while.md)
+    - [Do while](loops/do-while.md)
+- [Functions](functions.md)
+	- [Recursion](functions/recursion.md)
+`))
+	if err != nil {
+		t.Fatalf("failed to parse: %v", err)
+	}
+	assertOutline(t, entries, []string{
+		"1. Loops",
+		"  1.1. For",
+		"  1.2. While",
+		"    1.2.1. Do while",
+		"2. Functions",
+		"  2.1. Recursion",
+	})
+	if level := entries[0].Children[1].Children[0].Level; level != 3 {
+		t.Errorf("expected level 3, got %d", level)
+	}
+}
+
+func TestParseSummaryParts(t *testing.T) {
+	entries, err := ParseSummaryData("SUMMARY.md", []byte(`# Summary
+
+# Getting started
+[About this part](part1.md)
+- [Install](install.md)
+- [Run](run.md)
+
+# Going further
+* [Modules](modules.md)
+`))
+	if err != nil {
+		t.Fatalf("failed to parse: %v", err)
+	}
+
+	// Numbering continues across parts, like in mdBook
+	assertOutline(t, entries, []string{
+		"# Getting started",
+		"  About this part",
+		"  1. Install",
+		"  2. Run",
+		"# Going further",
+		"  3. Modules",
+	})
+}
+
+func TestParseSummarySeparatorsAndDrafts(t *testing.T) {
+	entries, err := ParseSummaryData("SUMMARY.md", []byte(`[Introduction](intro.md)
+---
+- [Written](written.md)
+- [Coming soon]()
+    - [Later too]( )
+***
+[Appendix](appendix%20a.md)
+`))
+	if err != nil {
+		t.Fatalf("failed to parse: %v", err)
+	}
+	assertOutline(t, entries, []string{
+		"Introduction",
+		"---",
+		"1. Written",
+		"2. Coming soon (draft)",
+		"  2.1. Later too (draft)",
+		"---",
+		"Appendix",
+	})
+	if entries[3].Path != "" {
+		t.Errorf("drafts should have no path, got %q", entries[3].Path)
+	}
+	if entries[5].Path != "appendix a.md" {
+		t.Errorf("expected an unescaped path, got %q", entries[5].Path)
+	}
+}
+
+func TestParseSummaryComments(t *testing.T) {
+	entries, err := ParseSummaryData("SUMMARY.md", []byte(`<!-- hidden for now
+- [Old](old.md)
+-->
+- [New](new.md) <!-- not [a](chapter.md) -->
+- [Also new](also-new.md)<!-- -->
+`))
+	if err != nil {
+		t.Fatalf("failed to parse: %v", err)
+	}
+	assertOutline(t, entries, []string{"1. New", "2. Also new"})
+}
+
+func TestParseSummaryErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		source  string
+		line    int
+		column  int
+		message string
+	}{
+		{"no link", "- [A](a.md)\n- Just text\n", 2, 3, "expected a link such as [Title](chapter.md)"},
+		{"unclosed title", "- [A(a.md)\n", 1, 3, "unclosed '[' in link title"},
+		{"empty title", "[](a.md)\n", 1, 2, "empty chapter title"},
+		{"missing target", "- [A] a.md\n", 1, 6, "expected '(' after the link title"},
+		{"unclosed target", "- [A](a.md\n", 1, 6, "unclosed '(' in link target"},
+		{"trailing text", "[A](a.md) and more\n", 1, 10, "unexpected text after the link"},
+		{"stray text", "# Summary\n\nSome prose\n", 3, 1, "expected a chapter link, a list item, a part title or a separator"},
+		{"list after suffix", "- [A](a.md)\n[B](b.md)\n- [C](c.md)\n", 3, 1, "numbered chapters cannot follow suffix chapters"},
+		{"part after suffix", "- [A](a.md)\n[B](b.md)\n# Part\n", 3, 1, "part titles cannot follow suffix chapters"},
+		{"nested plain link", "- [A](a.md)\n  [B](b.md)\n", 2, 3, "unnumbered chapters cannot be nested"},
+		{"bad indentation", "- [A](a.md)\n    - [B](b.md)\n  - [C](c.md)\n", 3, 3, "inconsistent indentation"},
+		{"unterminated comment", "- [A](a.md)\n<!-- open\n", 2, 1, "unterminated HTML comment"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseSummaryData("SUMMARY.md", []byte(tt.source))
+			var parseErr *ParseError
+			if !errors.As(err, &parseErr) {
+				t.Fatalf("expected a ParseError, got %v", err)
+			}
+			if parseErr.Line != tt.line || parseErr.Column != tt.column || parseErr.Message != tt.message {
+				t.Errorf("expected %d:%d %q, got %d:%d %q", tt.line, tt.column, tt.message, parseErr.Line, parseErr.Column, parseErr.Message)
+			}
+		})
+	}
+}
+
+func TestParseSummaryCourse(t *testing.T) {
+	entries, err := ParseSummary(filepath.Join(testCourseDir, "syllabus", "SUMMARY.md"))
+	if err != nil {
+		t.Fatalf("failed to parse: %v", err)
+	}
+	assertOutline(t, entries, []string{
+		"# Introduction",
+		"  Base 64 Encoding",
+		"# Core Concepts",
+		"  1. Algorithmes et Complexité",
+		"  2. Structures de Données",
+		"  3. Programmation Orientée Objet",
+		"  4. Traitement de Texte",
+	})
+}
@@ -0,0 +1,128 @@
+package courseparser
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"gopkg.in/yaml.v3"
+)
+
+// TagType is the kind of a course tag, using the INGInious numbering
+type TagType int
+
+const (
+	TagSkill          TagType = 0 // A skill the task trains, shown to students
+	TagCategory       TagType = 1 // A free category used to group tasks
+	TagOrganisational TagType = 2 // Used by staff to organise tasks
+)
+
+var tagTypeNames = map[TagType]string{
+	TagSkill:          "skill",
+	TagCategory:       "category",
+	TagOrganisational: "organisational",
+}
+
+// String returns the name of the tag type
+func (t TagType) String() string {
+	if name, ok := tagTypeNames[t]; ok {
+		return name
+	}
+	return strconv.Itoa(int(t))
+}
+
+// UnmarshalYAML accepts the INGInious number or the type name
+func (t *TagType) UnmarshalYAML(node *yaml.Node) error {
+	var number int
+	if err := node.Decode(&number); err == nil {
+		if _, ok := tagTypeNames[TagType(number)]; !ok {
+			return fmt.Errorf("unknown tag type %d", number)
+		}
+		*t = TagType(number)
+		return nil
+	}
+
+	for tagType, name := range tagTypeNames {
+		if node.Value == name {
+			*t = tagType
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown tag type %q", node.Value)
+}
+
+// MarshalYAML writes the INGInious number so exported courses stay compatible
+func (t TagType) MarshalYAML() (interface{}, error) {
+	return int(t), nil
+}
+
+// Tag represents a course tag. Tasks reference tags by ID in their
+// categories field.
+type Tag struct {
+	ID          string  `yaml:"id,omitempty"` // Defaults to the key in the tags map
+	Name        string  `yaml:"name"`
+	Description string  `yaml:"description"`
+	Visible     bool    `yaml:"visible"` // Whether students see the tag
+	Type        TagType `yaml:"type"`
+}
+
+// TagList returns the course tags with their IDs resolved, sorted by type
+// and name
+func (c *CourseConfig) TagList() []Tag {
+	tags := make([]Tag, 0, len(c.Tags))
+	for key, tag := range c.Tags {
+		if tag.ID == "" {
+			tag.ID = key
+		}
+		tags = append(tags, tag)
+	}
+
+	sort.Slice(tags, func(i, j int) bool {
+		if tags[i].Type != tags[j].Type {
+			return tags[i].Type < tags[j].Type
+		}
+		if tags[i].Name != tags[j].Name {
+			return tags[i].Name < tags[j].Name
+		}
+		return tags[i].ID < tags[j].ID
+	})
+	return tags
+}
+
+// TagByID returns a course tag by its ID
+func (c *CourseConfig) TagByID(id string) (Tag, bool) {
+	for key, tag := range c.Tags {
+		if tag.ID == "" {
+			tag.ID = key
+		}
+		if tag.ID == id {
+			return tag, true
+		}
+	}
+	return Tag{}, false
+}
+
+// ValidateTaskTags checks that every tag referenced by the task is defined by
+// the course
+func (c *CourseConfig) ValidateTaskTags(path string, task *TaskConfig) error {
+	for _, id := range task.Categories {
+		if _, ok := c.TagByID(id); !ok {
+			return &ParseError{
+				File:    path,
+				Field:   "categories",
+				Message: fmt.Sprintf("unknown tag %q", id),
+			}
+		}
+	}
+	return nil
+}
+
+// HasTag reports whether the task references the tag
+func (t *TaskConfig) HasTag(id string) bool {
+	for _, tag := range t.Categories {
+		if tag == id {
+			return true
+		}
+	}
+	return false
+}
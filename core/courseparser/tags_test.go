@@ -0,0 +1,91 @@
+package courseparser
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseTags(t *testing.T) {
+	config, err := ParseCourseConfigData("config.yaml", []byte(`name: Programming
+tags:
+  "0":
+    id: loops
+    name: Loops
+    description: for and while
+    visible: true
+    type: 0
+  recursion:
+    name: Recursion
+    visible: true
+    type: category
+  "2":
+    id: exam
+    name: Exam
+    visible: false
+    type: 2
+`))
+	if err != nil {
+		t.Fatalf("failed to parse: %v", err)
+	}
+
+	var ids []string
+	var types []TagType
+	for _, tag := range config.TagList() {
+		ids = append(ids, tag.ID)
+		types = append(types, tag.Type)
+	}
+	if !reflect.DeepEqual(ids, []string{"loops", "recursion", "exam"}) {
+		t.Errorf("unexpected tag IDs: %v", ids)
+	}
+	if !reflect.DeepEqual(types, []TagType{TagSkill, TagCategory, TagOrganisational}) {
+		t.Errorf("unexpected tag types: %v", types)
+	}
+
+	tag, ok := config.TagByID("recursion")
+	if !ok || tag.Name != "Recursion" {
+		t.Errorf("tag without an id field should be found by its key, got %+v", tag)
+	}
+
+	if _, err := ParseCourseConfigData("config.yaml", []byte("tags:\n  a:\n    name: A\n    type: 7\n")); err == nil {
+		t.Error("unknown tag type should be rejected")
+	}
+}
+
+func TestLoadCourseRejectsUnknownTags(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"config.yaml":        "name: Course\ntags:\n  loops:\n    name: Loops\n    visible: true\n",
+		"access.yaml":        "dispenser_data: {}\n",
+		"tasks/t1/task.yaml": "name: T1\ncategories: [loops]\n",
+		"tasks/t2/task.yaml": "name: T2\ncategories: [loops, graphs]\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, err := NewCourseLoader().LoadCourse(dir)
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) || parseErr.Field != "categories" {
+		t.Fatalf("expected an unknown tag error, got %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "tasks/t2/task.yaml"), []byte("name: T2\ncategories: [loops]\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	course, err := NewCourseLoader().LoadCourse(dir)
+	if err != nil {
+		t.Fatalf("failed to load course: %v", err)
+	}
+	if task := course.Tasks["t1"]; !task.HasTag("loops") {
+		t.Error("task t1 should carry the loops tag")
+	}
+}
@@ -3,6 +3,7 @@ package courseparser
 import (
 	"fmt"
 	"os"
+	"strings"
 
 	"gopkg.in/yaml.v3"
 )
@@ -46,6 +47,64 @@ func (pm *ProblemMap) Len() int {
 	return len(pm.Problems)
 }
 
+// IDs returns the problem IDs in order
+func (pm *ProblemMap) IDs() []string {
+	ids := make([]string, len(pm.Problems))
+	for i, op := range pm.Problems {
+		ids[i] = op.ID
+	}
+	return ids
+}
+
+// Set adds a problem at the end of the map, or replaces it in place if a
+// problem with the same ID already exists
+func (pm *ProblemMap) Set(id string, problem Problem) {
+	if pm.byID == nil {
+		pm.byID = make(map[string]Problem)
+	}
+	if _, exists := pm.byID[id]; exists {
+		for i := range pm.Problems {
+			if pm.Problems[i].ID == id {
+				pm.Problems[i].Problem = problem
+			}
+		}
+	} else {
+		pm.Problems = append(pm.Problems, OrderedProblem{ID: id, Problem: problem})
+	}
+	pm.byID[id] = problem
+}
+
+// Delete removes a problem by ID and reports whether it was present
+func (pm *ProblemMap) Delete(id string) bool {
+	if _, exists := pm.byID[id]; !exists {
+		return false
+	}
+	delete(pm.byID, id)
+	for i := range pm.Problems {
+		if pm.Problems[i].ID == id {
+			pm.Problems = append(pm.Problems[:i], pm.Problems[i+1:]...)
+			break
+		}
+	}
+	return true
+}
+
+// MarshalYAML encodes the problems as a mapping, in order
+func (pm ProblemMap) MarshalYAML() (interface{}, error) {
+	node := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	for _, op := range pm.Problems {
+		var valueNode yaml.Node
+		if err := valueNode.Encode(op.Problem); err != nil {
+			return nil, fmt.Errorf("problem %s: %w", op.ID, err)
+		}
+		node.Content = append(node.Content,
+			&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: op.ID},
+			&valueNode,
+		)
+	}
+	return node, nil
+}
+
 // UnmarshalYAML handles polymorphic deserialization of problems while preserving order
 func (pm *ProblemMap) UnmarshalYAML(node *yaml.Node) error {
 	if node.Kind != yaml.MappingNode {
@@ -116,6 +175,7 @@ type TaskConfig struct {
 	Name                  string                `yaml:"name"`
 	NetworkGrading        bool                  `yaml:"network_grading"`
 	Problems              ProblemMap            `yaml:"problems"`
+	Categories            []string              `yaml:"categories,omitempty"` // Course tag IDs
 
 	// MCQ-specific fields
 	InputRandom           int    `yaml:"input_random,omitempty"`
@@ -132,6 +192,41 @@ func (t *TaskConfig) IsMCQ() bool {
 	return t.EnvironmentType == "mcq"
 }
 
+// Validate checks the semantic constraints that YAML decoding alone does not
+// enforce. path is only used in errors.
+func (t *TaskConfig) Validate(path string) error {
+	if strings.TrimSpace(t.Name) == "" {
+		return &ParseError{File: path, Field: "name", Message: "must not be empty"}
+	}
+
+	for _, op := range t.Problems.Problems {
+		field := "problems." + op.ID
+		if !ValidID(op.ID) {
+			return &ParseError{File: path, Field: field, Message: "invalid problem ID"}
+		}
+
+		switch p := op.Problem.(type) {
+		case *CodeProblem:
+			if p.Language == "" {
+				return &ParseError{File: path, Field: field + ".language", Message: "must not be empty"}
+			}
+		case *MultipleChoiceProblem:
+			if len(p.Choices) == 0 {
+				return &ParseError{File: path, Field: field + ".choices", Message: "must contain at least one choice"}
+			}
+			if p.Limit < 0 || p.Limit > len(p.Choices) {
+				return &ParseError{File: path, Field: field + ".limit", Message: "must be between 0 and the number of choices"}
+			}
+		case *MatchProblem:
+			if strings.TrimSpace(p.Answer) == "" {
+				return &ParseError{File: path, Field: field + ".answer", Message: "must not be empty"}
+			}
+		}
+	}
+
+	return nil
+}
+
 // ParseTaskConfig parses a task.yaml file and returns a TaskConfig
 func ParseTaskConfig(path string) (*TaskConfig, error) {
 	data, err := os.ReadFile(path)
@@ -143,6 +238,11 @@ func ParseTaskConfig(path string) (*TaskConfig, error) {
 		}
 	}
 
+	return ParseTaskConfigData(path, data)
+}
+
+// ParseTaskConfigData parses the contents of a task.yaml file; path is only used in errors
+func ParseTaskConfigData(path string, data []byte) (*TaskConfig, error) {
 	var config TaskConfig
 	if err := yaml.Unmarshal(data, &config); err != nil {
 		return nil, &ParseError{
@@ -0,0 +1,348 @@
+package courseparser
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+
+	"gopkg.in/yaml.v3"
+)
+
+// MarshalTaskConfig encodes a TaskConfig as task.yaml content, keeping the
+// problem order
+func MarshalTaskConfig(config *TaskConfig) ([]byte, error) {
+	return marshalYAML(config)
+}
+
+// MarshalCourseConfig encodes a CourseConfig as config.yaml content
+func MarshalCourseConfig(config *CourseConfig) ([]byte, error) {
+	return marshalYAML(config)
+}
+
+// MarshalAccessConfig encodes an AccessConfig as access.yaml content
+func MarshalAccessConfig(config *AccessConfig) ([]byte, error) {
+	return marshalYAML(config)
+}
+
+// UpdateTaskConfig encodes a TaskConfig on top of the original task.yaml
+// content. Comments and formatting of the original are kept wherever the
+// content did not change, and problems follow the order of config.Problems.
+func UpdateTaskConfig(original []byte, config *TaskConfig) ([]byte, error) {
+	return updateYAML(original, config, func(root *yaml.Node) {
+		if problems := mappingValue(root, "problems"); problems != nil {
+			orderMapping(problems, config.Problems.IDs())
+		}
+	})
+}
+
+// UpdateCourseConfig encodes a CourseConfig on top of the original
+// config.yaml content, keeping comments and formatting where possible
+func UpdateCourseConfig(original []byte, config *CourseConfig) ([]byte, error) {
+	return updateYAML(original, config, nil)
+}
+
+// UpdateAccessConfig encodes an AccessConfig on top of the original
+// access.yaml content, keeping comments and formatting where possible
+func UpdateAccessConfig(original []byte, config *AccessConfig) ([]byte, error) {
+	return updateYAML(original, config, nil)
+}
+
+// WriteTaskConfig atomically writes a task.yaml, keeping the comments of the
+// existing file if there is one
+func WriteTaskConfig(path string, config *TaskConfig) error {
+	return writeYAMLFile(path, func(original []byte) ([]byte, error) {
+		return UpdateTaskConfig(original, config)
+	})
+}
+
+// WriteCourseConfig atomically writes a config.yaml, keeping the comments of
+// the existing file if there is one
+func WriteCourseConfig(path string, config *CourseConfig) error {
+	return writeYAMLFile(path, func(original []byte) ([]byte, error) {
+		return UpdateCourseConfig(original, config)
+	})
+}
+
+// WriteAccessConfig atomically writes an access.yaml, keeping the comments of
+// the existing file if there is one
+func WriteAccessConfig(path string, config *AccessConfig) error {
+	return writeYAMLFile(path, func(original []byte) ([]byte, error) {
+		return UpdateAccessConfig(original, config)
+	})
+}
+
+// writeYAMLFile reads the current content of path (if any), lets encode
+// produce the new content and atomically replaces the file
+func writeYAMLFile(path string, encode func(original []byte) ([]byte, error)) error {
+	original, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return &ParseError{File: path, Message: "failed to read file", Err: err}
+	}
+
+	data, err := encode(original)
+	if err != nil {
+		return &ParseError{File: path, Message: "failed to encode YAML", Err: err}
+	}
+
+	if err := WriteFileAtomic(path, data, 0644); err != nil {
+		return &ParseError{File: path, Message: "failed to write file", Err: err}
+	}
+	return nil
+}
+
+// marshalYAML encodes v with the indentation used by course files
+func marshalYAML(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(v); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// updateYAML encodes v and merges the result into the original document so
+// that comments, styles and the keys the Go types do not model survive.
+// fixup, if not nil, is called on the merged root mapping before encoding.
+// Without a usable original, v is encoded as is.
+func updateYAML(original []byte, v interface{}, fixup func(root *yaml.Node)) ([]byte, error) {
+	var updated yaml.Node
+	if err := updated.Encode(v); err != nil {
+		return nil, err
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(original, &doc); err != nil || doc.Kind != yaml.DocumentNode || len(doc.Content) == 0 {
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{&updated}}
+	} else {
+		modeled := modeledNode(doc.Content[0], v)
+		if modeled == nil {
+			modeled = &updated // Drop what the update does not have
+		}
+		doc.Content[0] = mergeNodes(doc.Content[0], modeled, &updated)
+	}
+
+	if fixup != nil {
+		fixup(doc.Content[0])
+	}
+
+	return marshalYAML(&doc)
+}
+
+// modeledNode decodes orig into a new value of the type of v and encodes it
+// back, which gives the part of orig that the Go types model. It returns nil
+// if orig does not decode.
+func modeledNode(orig *yaml.Node, v interface{}) *yaml.Node {
+	t := reflect.TypeOf(v)
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	value := reflect.New(t).Interface()
+	if err := orig.Decode(value); err != nil {
+		return nil
+	}
+	var node yaml.Node
+	if err := node.Encode(value); err != nil {
+		return nil
+	}
+	return &node
+}
+
+// mergeNodes returns the node to write for a value that was orig in the
+// original document and is updated now; modeled is orig as the Go types see
+// it, or nil. Unchanged scalars keep their original node; everything else
+// takes the new content with the original comments. Keys of orig that are
+// not modeled are kept, while modeled keys missing from updated were
+// removed. New keys with a zero value are left out, as they only restate
+// defaults.
+func mergeNodes(orig, modeled, updated *yaml.Node) *yaml.Node {
+	if orig.Kind != updated.Kind {
+		copyComments(updated, orig)
+		return updated
+	}
+
+	switch orig.Kind {
+	case yaml.ScalarNode:
+		if orig.Value == updated.Value && orig.ShortTag() == updated.ShortTag() {
+			return orig
+		}
+		// Keep explicit string styles (quoted, literal, folded) on edits
+		if orig.ShortTag() == "!!str" && updated.ShortTag() == "!!str" && orig.Style != 0 {
+			updated.Style = orig.Style
+		}
+		copyComments(updated, orig)
+		return updated
+
+	case yaml.MappingNode:
+		origValues := make(map[string]int, len(orig.Content)/2)
+		for i := 0; i+1 < len(orig.Content); i += 2 {
+			origValues[orig.Content[i].Value] = i
+		}
+		updatedKeys := make(map[string]int, len(updated.Content)/2)
+		for i := 0; i+1 < len(updated.Content); i += 2 {
+			updatedKeys[updated.Content[i].Value] = i
+		}
+
+		// Keys that still exist keep their original position, new keys are
+		// appended in the order of the encoded value
+		content := make([]*yaml.Node, 0, len(updated.Content))
+		for i := 0; i+1 < len(orig.Content); i += 2 {
+			key := orig.Content[i].Value
+			j, ok := updatedKeys[key]
+			if !ok {
+				if modeled != nil && mappingValue(modeled, key) == nil {
+					content = append(content, orig.Content[i], orig.Content[i+1])
+				}
+				continue
+			}
+			var modeledValue *yaml.Node
+			if modeled != nil {
+				modeledValue = mappingValue(modeled, key)
+			}
+			content = append(content, orig.Content[i], mergeNodes(orig.Content[i+1], modeledValue, updated.Content[j+1]))
+		}
+		for i := 0; i+1 < len(updated.Content); i += 2 {
+			if _, ok := origValues[updated.Content[i].Value]; !ok && !isZeroNode(updated.Content[i+1]) {
+				content = append(content, updated.Content[i], updated.Content[i+1])
+			}
+		}
+
+		setContent(orig, content)
+		return orig
+
+	case yaml.SequenceNode:
+		content := make([]*yaml.Node, len(updated.Content))
+		for i, item := range updated.Content {
+			if i < len(orig.Content) {
+				var modeledItem *yaml.Node
+				if modeled != nil && modeled.Kind == yaml.SequenceNode && i < len(modeled.Content) {
+					modeledItem = modeled.Content[i]
+				}
+				content[i] = mergeNodes(orig.Content[i], modeledItem, item)
+			} else {
+				content[i] = item
+			}
+		}
+
+		setContent(orig, content)
+		return orig
+	}
+
+	copyComments(updated, orig)
+	return updated
+}
+
+// isZeroNode reports whether an encoded value is the zero value of its type
+func isZeroNode(node *yaml.Node) bool {
+	switch node.Kind {
+	case yaml.MappingNode, yaml.SequenceNode:
+		return len(node.Content) == 0
+	case yaml.ScalarNode:
+		switch node.ShortTag() {
+		case "!!null":
+			return true
+		case "!!str":
+			return node.Value == ""
+		case "!!bool":
+			return node.Value == "false"
+		case "!!int", "!!float":
+			return node.Value == "0"
+		}
+	}
+	return false
+}
+
+// setContent replaces the content of a collection node. An originally empty
+// flow collection ({} or []) switches to block style once it has content.
+func setContent(node *yaml.Node, content []*yaml.Node) {
+	if len(node.Content) == 0 && len(content) > 0 {
+		node.Style &^= yaml.FlowStyle
+	}
+	node.Content = content
+}
+
+// copyComments copies the comments attached to src onto dst
+func copyComments(dst, src *yaml.Node) {
+	dst.HeadComment = src.HeadComment
+	dst.LineComment = src.LineComment
+	dst.FootComment = src.FootComment
+}
+
+// mappingValue returns the value node of key in a mapping node, or nil
+func mappingValue(mapping *yaml.Node, key string) *yaml.Node {
+	if mapping.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// orderMapping reorders the pairs of a mapping node to follow keys. Keys that
+// are not listed keep their relative order after the listed ones.
+func orderMapping(mapping *yaml.Node, keys []string) {
+	pairs := make(map[string][2]*yaml.Node, len(mapping.Content)/2)
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		pairs[mapping.Content[i].Value] = [2]*yaml.Node{mapping.Content[i], mapping.Content[i+1]}
+	}
+
+	content := make([]*yaml.Node, 0, len(mapping.Content))
+	for _, key := range keys {
+		if pair, ok := pairs[key]; ok {
+			content = append(content, pair[0], pair[1])
+			delete(pairs, key)
+		}
+	}
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if _, ok := pairs[mapping.Content[i].Value]; ok {
+			content = append(content, mapping.Content[i], mapping.Content[i+1])
+		}
+	}
+	mapping.Content = content
+}
+
+// WriteFileAtomic writes data to a temporary file next to path and renames it
+// over path, so readers never observe a partially written file
+func WriteFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+
+	// Clean up the temporary file if anything below fails
+	success := false
+	defer func() {
+		if !success {
+			os.Remove(tmpName)
+		}
+	}()
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmpName, perm); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpName, path); err != nil {
+		return err
+	}
+
+	success = true
+	return nil
+}
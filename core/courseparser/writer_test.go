@@ -0,0 +1,295 @@
+package courseparser
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testCourseDir = "../../courses/CS01"
+
+func TestTaskConfigRoundTrip(t *testing.T) {
+	taskFiles, err := filepath.Glob(filepath.Join(testCourseDir, "tasks", "*", "task.yaml"))
+	if err != nil || len(taskFiles) == 0 {
+		t.Fatalf("no task files found: %v", err)
+	}
+
+	for _, path := range taskFiles {
+		original, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("failed to read %s: %v", path, err)
+		}
+		parsed, err := ParseTaskConfigData(path, original)
+		if err != nil {
+			t.Fatalf("failed to parse %s: %v", path, err)
+		}
+
+		marshaled, err := MarshalTaskConfig(parsed)
+		if err != nil {
+			t.Fatalf("%s: failed to marshal: %v", path, err)
+		}
+		reparsed, err := ParseTaskConfigData(path, marshaled)
+		if err != nil {
+			t.Fatalf("%s: failed to parse marshaled task: %v", path, err)
+		}
+		if !reflect.DeepEqual(parsed, reparsed) {
+			t.Errorf("%s: marshaled task differs after round trip", path)
+		}
+		if !reflect.DeepEqual(parsed.Problems.IDs(), reparsed.Problems.IDs()) {
+			t.Errorf("%s: problem order changed: %v -> %v", path, parsed.Problems.IDs(), reparsed.Problems.IDs())
+		}
+
+		updated, err := UpdateTaskConfig(original, parsed)
+		if err != nil {
+			t.Fatalf("%s: failed to update: %v", path, err)
+		}
+		reparsed, err = ParseTaskConfigData(path, updated)
+		if err != nil {
+			t.Fatalf("%s: failed to parse updated task: %v", path, err)
+		}
+		if !reflect.DeepEqual(parsed, reparsed) {
+			t.Errorf("%s: updated task differs after round trip", path)
+		}
+	}
+}
+
+func TestCourseConfigRoundTrip(t *testing.T) {
+	path := filepath.Join(testCourseDir, "config.yaml")
+	original, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read %s: %v", path, err)
+	}
+	parsed, err := ParseCourseConfigData(path, original)
+	if err != nil {
+		t.Fatalf("failed to parse %s: %v", path, err)
+	}
+
+	marshaled, err := MarshalCourseConfig(parsed)
+	if err != nil {
+		t.Fatalf("failed to marshal: %v", err)
+	}
+	reparsed, err := ParseCourseConfigData(path, marshaled)
+	if err != nil {
+		t.Fatalf("failed to parse marshaled config: %v", err)
+	}
+	if !reflect.DeepEqual(parsed, reparsed) {
+		t.Errorf("marshaled config differs after round trip:\n%+v\n%+v", parsed, reparsed)
+	}
+
+	// Writing back an unchanged config must not change the file
+	updated, err := UpdateCourseConfig(original, parsed)
+	if err != nil {
+		t.Fatalf("failed to update: %v", err)
+	}
+	if string(updated) != string(original) {
+		t.Errorf("unchanged config was rewritten:\n%s", updated)
+	}
+}
+
+func TestAccessConfigRoundTrip(t *testing.T) {
+	path := filepath.Join(testCourseDir, "access.yaml")
+	original, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read %s: %v", path, err)
+	}
+	parsed, err := ParseAccessConfigData(path, original)
+	if err != nil {
+		t.Fatalf("failed to parse %s: %v", path, err)
+	}
+
+	marshaled, err := MarshalAccessConfig(parsed)
+	if err != nil {
+		t.Fatalf("failed to marshal: %v", err)
+	}
+	reparsed, err := ParseAccessConfigData(path, marshaled)
+	if err != nil {
+		t.Fatalf("failed to parse marshaled access config: %v", err)
+	}
+	if !reflect.DeepEqual(parsed, reparsed) {
+		t.Errorf("marshaled access config differs after round trip")
+	}
+
+	// Both forms of accessibility must survive
+	if !reparsed.DispenserData.Config["task02"].Accessibility.IsBoolean {
+		t.Error("task02 accessibility should stay a boolean")
+	}
+	task01 := reparsed.DispenserData.Config["task01"].Accessibility
+	if task01.IsBoolean || task01.DateRange == nil {
+		t.Fatal("task01 accessibility should stay a date range")
+	}
+	if got := task01.DateRange.String(); got != "2026-01-25 19:15:03/2026-01-29 19:15:07/2026-01-28 19:15:04" {
+		t.Errorf("unexpected task01 date range: %q", got)
+	}
+
+	updated, err := UpdateAccessConfig(original, parsed)
+	if err != nil {
+		t.Fatalf("failed to update: %v", err)
+	}
+	if string(updated) != string(original) {
+		t.Errorf("unchanged access config was rewritten:\n%s", updated)
+	}
+}
+
+func TestUpdateTaskConfigKeepsComments(t *testing.T) {
+	original := []byte(`# Task written by hand
+name: Quiz # shown to students
+author: Jean
+problems:
+  # First question
+  Q1:
+    type: match
+    name: First
+    header: ""
+    answer: "42"
+  Q2:
+    type: match
+    name: Second
+    header: ""
+    answer: "43"
+`)
+
+	task, err := ParseTaskConfigData("task.yaml", original)
+	if err != nil {
+		t.Fatalf("failed to parse: %v", err)
+	}
+
+	// Edit a field, reorder the problems and add one
+	task.Name = "Renamed quiz"
+	q1, _ := task.Problems.Get("Q1")
+	q2, _ := task.Problems.Get("Q2")
+	task.Problems = ProblemMap{}
+	task.Problems.Set("Q2", q2)
+	task.Problems.Set("Q1", q1)
+	task.Problems.Set("Q3", &MatchProblem{
+		BaseProblem: BaseProblem{Type: "match", Name: "Third"},
+		Answer:      "44",
+	})
+
+	updated, err := UpdateTaskConfig(original, task)
+	if err != nil {
+		t.Fatalf("failed to update: %v", err)
+	}
+	out := string(updated)
+
+	for _, comment := range []string{"# Task written by hand", "# shown to students", "# First question"} {
+		if !strings.Contains(out, comment) {
+			t.Errorf("comment %q was lost:\n%s", comment, out)
+		}
+	}
+	if !strings.Contains(out, `answer: "42"`) {
+		t.Errorf("quoting of unchanged values was lost:\n%s", out)
+	}
+
+	reparsed, err := ParseTaskConfigData("task.yaml", updated)
+	if err != nil {
+		t.Fatalf("failed to parse updated task: %v", err)
+	}
+	if reparsed.Name != "Renamed quiz" {
+		t.Errorf("expected updated name, got %q", reparsed.Name)
+	}
+	if got := reparsed.Problems.IDs(); !reflect.DeepEqual(got, []string{"Q2", "Q1", "Q3"}) {
+		t.Errorf("unexpected problem order: %v", got)
+	}
+}
+
+func TestUpdateTaskConfigKeepsUnknownKeys(t *testing.T) {
+	original := `name: Quiz
+weight: 2
+author: Jean
+categories:
+  - loops
+problems:
+  choice:
+    type: multiple_choice
+    name: Pick
+    header: Which one?
+    multiple: true
+    success_message: Well done
+    choices:
+      - text: Right
+        valid: true
+        feedback: Indeed
+      - text: Wrong
+  old:
+    type: match
+    name: Old
+    header: Removed
+    answer: "1"
+    tolerance: 0.5
+stored_submissions: 3
+`
+
+	task, err := ParseTaskConfigData("task.yaml", []byte(original))
+	if err != nil {
+		t.Fatalf("failed to parse: %v", err)
+	}
+
+	// Writing back an unchanged task must not change the file
+	updated, err := UpdateTaskConfig([]byte(original), task)
+	if err != nil {
+		t.Fatalf("failed to update: %v", err)
+	}
+	if string(updated) != original {
+		t.Errorf("unchanged task was rewritten:\n%s", updated)
+	}
+
+	// Keys the types model are removed when the task no longer has them,
+	// unknown ones stay
+	task.Name = "Renamed"
+	task.Categories = nil
+	task.Problems.Delete("old")
+	updated, err = UpdateTaskConfig([]byte(original), task)
+	if err != nil {
+		t.Fatalf("failed to update: %v", err)
+	}
+	want := `name: Renamed
+weight: 2
+author: Jean
+problems:
+  choice:
+    type: multiple_choice
+    name: Pick
+    header: Which one?
+    multiple: true
+    success_message: Well done
+    choices:
+      - text: Right
+        valid: true
+        feedback: Indeed
+      - text: Wrong
+stored_submissions: 3
+`
+	if string(updated) != want {
+		t.Errorf("updated task:\n%s\nwant:\n%s", updated, want)
+	}
+}
+
+func TestUpdateCourseConfigKeepsUnknownKeys(t *testing.T) {
+	original := `name: Course
+description: Kept from INGInious
+admins:
+  - jean
+`
+
+	config, err := ParseCourseConfigData("config.yaml", []byte(original))
+	if err != nil {
+		t.Fatalf("failed to parse: %v", err)
+	}
+	config.Admins = append(config.Admins, "marie")
+	updated, err := UpdateCourseConfig([]byte(original), config)
+	if err != nil {
+		t.Fatalf("failed to update: %v", err)
+	}
+
+	want := `name: Course
+description: Kept from INGInious
+admins:
+  - jean
+  - marie
+`
+	if string(updated) != want {
+		t.Errorf("updated config:\n%s\nwant:\n%s", updated, want)
+	}
+}
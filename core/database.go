@@ -45,7 +45,7 @@ func RunMigrations() error {
 
 	// AutoMigrate will create tables, missing columns, missing indexes, etc.
 	// It will NOT delete unused columns to protect your data
-	err := DB.AutoMigrate(&User{}, &Task{}, &Course{}, &CourseTeacher{}, &Role{})
+	err := DB.AutoMigrate(&User{}, &Session{}, &ImpersonationLog{}, &PersonalAccessToken{}, &UserToken{}, &LoginThrottle{}, &Task{}, &Course{}, &CourseTeacher{}, &Role{}, &Enrollment{}, &CourseStaff{}, &Group{}, &GroupMember{}, &GroupTutor{}, &Submission{})
 	if err != nil {
 		return fmt.Errorf("failed to migrate database: %w", err)
 	}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"ironsnake/core/courseparser"
+)
+
+// RegisterRequest represents the body of a course registration
+type RegisterRequest struct {
+	Password string `json:"password"`
+}
+
+// GetEnrollment retrieves the enrollment of a user in a course, or nil if the
+// user is not enrolled
+func GetEnrollment(userID uuid.UUID, courseID string) (*Enrollment, error) {
+	var enrollment Enrollment
+	err := DB.Where("user_id = ? AND course_id = ?", userID, courseID).First(&enrollment).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load enrollment: %w", err)
+	}
+	return &enrollment, nil
+}
+
+// registrantFor describes the user to the course access control, fetching
+// the LDAP attributes it needs
+func registrantFor(user *User, course *courseparser.ParsedCourse) (courseparser.Registrant, error) {
+	registrant := courseparser.Registrant{
+		Username: user.Username,
+		Email:    user.Email,
+	}
+
+	names := course.Config.RegistrationAttributes()
+	if len(names) == 0 || !(user.LDAPEnabled || user.AuthProvider == "ldap") {
+		return registrant, nil
+	}
+	attributes, err := ldapService.GetAttributes(user.Username, names)
+	if err != nil {
+		return registrant, fmt.Errorf("failed to get LDAP attributes of %s: %w", user.Username, err)
+	}
+	registrant.Attributes = attributes
+	return registrant, nil
+}
+
+// writeEnrollment writes the enrollment state of the user in a course
+func writeEnrollment(w http.ResponseWriter, status int, courseID string, enrollment *Enrollment) {
+	response := EnrollmentResponse{CourseID: courseID}
+	if enrollment != nil {
+		response.Enrolled = true
+		response.EnrolledAt = &enrollment.CreatedAt
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+// registerCourseHandler enrolls the current user in a course, checking the
+// registration password and access-control list of the course
+func registerCourseHandler(w http.ResponseWriter, r *http.Request, cc *CourseContext) {
+	user, course, courseID := cc.User, cc.Course, cc.Course.CourseID
+
+	// The body is optional for courses without a password
+	var request RegisterRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	enrollment, err := GetEnrollment(user.ID, courseID)
+	if err != nil {
+		log.Printf("Error registering %s to course %s: %v", user.Username, courseID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if enrollment != nil {
+		writeEnrollment(w, http.StatusOK, courseID, enrollment)
+		return
+	}
+
+	registrant, err := registrantFor(user, course)
+	if err != nil {
+		log.Printf("Error registering %s to course %s: %v", user.Username, courseID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := course.Config.CheckRegistration(registrant, request.Password); err != nil {
+		log.Printf("Registration of %s to course %s refused: %v", user.Username, courseID, err)
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	enrollment = &Enrollment{UserID: user.ID, CourseID: courseID}
+	if err := DB.Create(enrollment).Error; err != nil {
+		log.Printf("Error registering %s to course %s: %v", user.Username, courseID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("User %s registered to course %s", user.Username, courseID)
+	writeEnrollment(w, http.StatusCreated, courseID, enrollment)
+}
+
+// unregisterCourseHandler removes the current user from a course, if the
+// course allows it
+func unregisterCourseHandler(w http.ResponseWriter, r *http.Request, cc *CourseContext) {
+	user, course, courseID := cc.User, cc.Course, cc.Course.CourseID
+
+	if !course.Config.AllowUnregister {
+		http.Error(w, "Unregistering is not allowed for this course", http.StatusForbidden)
+		return
+	}
+
+	enrollment, err := GetEnrollment(user.ID, courseID)
+	if err != nil {
+		log.Printf("Error unregistering %s from course %s: %v", user.Username, courseID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if enrollment != nil && enrollment.Source == "ldap" {
+		// The next login would enroll the user again
+		http.Error(w, "Enrolled through an LDAP group, ask the course staff", http.StatusForbidden)
+		return
+	}
+
+	result := DB.Where("user_id = ? AND course_id = ?", user.ID, courseID).Delete(&Enrollment{})
+	if result.Error != nil {
+		log.Printf("Error unregistering %s from course %s: %v", user.Username, courseID, result.Error)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if result.RowsAffected == 0 {
+		http.Error(w, "Not enrolled in this course", http.StatusNotFound)
+		return
+	}
+
+	log.Printf("User %s unregistered from course %s", user.Username, courseID)
+	writeEnrollment(w, http.StatusOK, courseID, nil)
+}
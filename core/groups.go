@@ -0,0 +1,408 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// GroupRequest represents the body of a group creation or update
+type GroupRequest struct {
+	Name    string   `json:"name"`
+	Size    int      `json:"size"`    // Maximum number of members
+	Members []string `json:"members"` // Usernames of enrolled students
+	Tutors  []string `json:"tutors"`  // Usernames of course staff
+}
+
+// Group errors reported to the client
+var (
+	errGroupFull    = errors.New("group is full")
+	errNotInGroup   = errors.New("not in a group of this course")
+	errGroupMissing = errors.New("group not found")
+)
+
+// groupInvalidError is a group request that does not fit the course
+type groupInvalidError struct {
+	Message string
+}
+
+func (e *groupInvalidError) Error() string {
+	return e.Message
+}
+
+// loadCourseGroups returns the groups of a course with their members and
+// tutors, sorted by name
+func loadCourseGroups(courseID string) ([]Group, error) {
+	var groups []Group
+	err := DB.Preload("Members.User").Preload("Tutors.User").
+		Where("course_id = ?", courseID).Order("name").Find(&groups).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to load groups: %w", err)
+	}
+	return groups, nil
+}
+
+// loadGroup returns a group of a course with its members and tutors
+func loadGroup(db *gorm.DB, courseID, groupID string) (*Group, error) {
+	id, err := uuid.Parse(groupID)
+	if err != nil {
+		return nil, errGroupMissing
+	}
+	var group Group
+	err = db.Preload("Members.User").Preload("Tutors.User").
+		Where("id = ? AND course_id = ?", id, courseID).First(&group).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errGroupMissing
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load group: %w", err)
+	}
+	return &group, nil
+}
+
+// GetUserGroupID returns the ID of the group of a user in a course, or nil
+// if the user is in none
+func GetUserGroupID(courseID string, userID uuid.UUID) (*uuid.UUID, error) {
+	var member GroupMember
+	err := DB.Where("course_id = ? AND user_id = ?", courseID, userID).First(&member).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load group membership: %w", err)
+	}
+	return &member.GroupID, nil
+}
+
+// groupResponse converts a group with its members and tutors to JSON
+func groupResponse(group *Group) GroupResponse {
+	response := GroupResponse{
+		ID:      group.ID.String(),
+		Name:    group.Name,
+		Size:    group.Size,
+		Members: make([]GroupUserResponse, len(group.Members)),
+		Tutors:  make([]GroupUserResponse, len(group.Tutors)),
+	}
+	for i, member := range group.Members {
+		response.Members[i] = groupUserResponse(&member.User)
+	}
+	for i, tutor := range group.Tutors {
+		response.Tutors[i] = groupUserResponse(&tutor.User)
+	}
+	return response
+}
+
+func groupUserResponse(user *User) GroupUserResponse {
+	return GroupUserResponse{
+		Username:  user.Username,
+		FirstName: user.FirstName,
+		LastName:  user.LastName,
+	}
+}
+
+// resolveGroupUsers loads the users of a group request and checks that
+// members are students and tutors are staff of the course
+func resolveGroupUsers(cc *CourseContext, request *GroupRequest) (members, tutors []User, err error) {
+	if strings.TrimSpace(request.Name) == "" {
+		return nil, nil, &groupInvalidError{"name must not be empty"}
+	}
+	if request.Size < 1 {
+		return nil, nil, &groupInvalidError{"size must be at least 1"}
+	}
+	if len(request.Members) > request.Size {
+		return nil, nil, &groupInvalidError{fmt.Sprintf("%d members do not fit in a group of %d", len(request.Members), request.Size)}
+	}
+
+	resolve := func(usernames []string, wanted func(CourseRole) bool, kind string) ([]User, error) {
+		users := make([]User, 0, len(usernames))
+		seen := make(map[string]bool)
+		for _, username := range usernames {
+			if seen[username] {
+				continue
+			}
+			seen[username] = true
+
+			user, err := GetUserByUsername(username)
+			if err != nil {
+				return nil, &groupInvalidError{fmt.Sprintf("unknown user %q", username)}
+			}
+			role, err := ResolveCourseRole(user, cc.Course)
+			if err != nil {
+				return nil, err
+			}
+			if !wanted(role) {
+				return nil, &groupInvalidError{fmt.Sprintf("%s is not %s of the course", username, kind)}
+			}
+			users = append(users, *user)
+		}
+		return users, nil
+	}
+
+	members, err = resolve(request.Members, func(role CourseRole) bool { return role == RoleStudent }, "a student")
+	if err != nil {
+		return nil, nil, err
+	}
+	tutors, err = resolve(request.Tutors, func(role CourseRole) bool { return role >= RoleTutor }, "a tutor")
+	if err != nil {
+		return nil, nil, err
+	}
+	return members, tutors, nil
+}
+
+// setGroupUsers replaces the members and tutors of a group. Members are
+// moved out of their previous group of the course.
+func setGroupUsers(tx *gorm.DB, group *Group, members, tutors []User) error {
+	if err := tx.Where("group_id = ?", group.ID).Delete(&GroupMember{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("group_id = ?", group.ID).Delete(&GroupTutor{}).Error; err != nil {
+		return err
+	}
+
+	for _, member := range members {
+		if err := tx.Where("course_id = ? AND user_id = ?", group.CourseID, member.ID).Delete(&GroupMember{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(&GroupMember{GroupID: group.ID, UserID: member.ID, CourseID: group.CourseID}).Error; err != nil {
+			return err
+		}
+	}
+	for _, tutor := range tutors {
+		if err := tx.Create(&GroupTutor{GroupID: group.ID, UserID: tutor.ID}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeGroupError maps group errors to HTTP responses
+func writeGroupError(w http.ResponseWriter, err error) {
+	var invalid *groupInvalidError
+	switch {
+	case errors.Is(err, errGroupMissing), errors.Is(err, errNotInGroup):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, errGroupFull):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.As(err, &invalid):
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+	default:
+		log.Printf("Error managing groups: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+// writeGroup reloads a group and writes it as JSON
+func writeGroup(w http.ResponseWriter, status int, courseID string, groupID uuid.UUID) {
+	group, err := loadGroup(DB, courseID, groupID.String())
+	if err != nil {
+		writeGroupError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(groupResponse(group)); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+// listGroupsHandler lists the groups of a course and their members, to
+// course members only
+func listGroupsHandler(w http.ResponseWriter, r *http.Request, cc *CourseContext) {
+	groups, err := loadCourseGroups(cc.Course.CourseID)
+	if err != nil {
+		writeGroupError(w, err)
+		return
+	}
+
+	response := make([]GroupResponse, len(groups))
+	for i := range groups {
+		response[i] = groupResponse(&groups[i])
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+// createGroupHandler creates a group, with its members and tutors
+func createGroupHandler(w http.ResponseWriter, r *http.Request, cc *CourseContext) {
+	var request GroupRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	members, tutors, err := resolveGroupUsers(cc, &request)
+	if err != nil {
+		writeGroupError(w, err)
+		return
+	}
+
+	group := Group{CourseID: cc.Course.CourseID, Name: strings.TrimSpace(request.Name), Size: request.Size}
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&group).Error; err != nil {
+			return err
+		}
+		return setGroupUsers(tx, &group, members, tutors)
+	})
+	if err != nil {
+		writeGroupError(w, err)
+		return
+	}
+
+	log.Printf("Group %s created in course %s by %s", group.Name, group.CourseID, cc.User.Username)
+	writeGroup(w, http.StatusCreated, group.CourseID, group.ID)
+}
+
+// updateGroupHandler replaces the name, size, members and tutors of a group
+func updateGroupHandler(w http.ResponseWriter, r *http.Request, cc *CourseContext) {
+	var request GroupRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	members, tutors, err := resolveGroupUsers(cc, &request)
+	if err != nil {
+		writeGroupError(w, err)
+		return
+	}
+
+	group, err := loadGroup(DB, cc.Course.CourseID, r.PathValue("groupID"))
+	if err != nil {
+		writeGroupError(w, err)
+		return
+	}
+
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		group.Name = strings.TrimSpace(request.Name)
+		group.Size = request.Size
+		if err := tx.Model(group).Select("Name", "Size").Updates(group).Error; err != nil {
+			return err
+		}
+		return setGroupUsers(tx, group, members, tutors)
+	})
+	if err != nil {
+		writeGroupError(w, err)
+		return
+	}
+
+	writeGroup(w, http.StatusOK, group.CourseID, group.ID)
+}
+
+// deleteGroupHandler removes a group. Its submissions stay in the history of
+// the members who made them.
+func deleteGroupHandler(w http.ResponseWriter, r *http.Request, cc *CourseContext) {
+	group, err := loadGroup(DB, cc.Course.CourseID, r.PathValue("groupID"))
+	if err != nil {
+		writeGroupError(w, err)
+		return
+	}
+
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("group_id = ?", group.ID).Delete(&GroupMember{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("group_id = ?", group.ID).Delete(&GroupTutor{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(group).Error
+	})
+	if err != nil {
+		writeGroupError(w, err)
+		return
+	}
+
+	log.Printf("Group %s deleted from course %s by %s", group.Name, group.CourseID, cc.User.Username)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// requireStudentChoice checks that the course lets students pick their group
+// and that the user is one of its students
+func requireStudentChoice(w http.ResponseWriter, cc *CourseContext) bool {
+	if !cc.Course.Config.GroupsStudentChoice {
+		http.Error(w, "Groups of this course are assigned by its staff", http.StatusForbidden)
+		return false
+	}
+	if cc.Role != RoleStudent {
+		http.Error(w, "Only students can join groups", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// joinGroupHandler moves the current student to a group with room left, when
+// the course lets students choose their group
+func joinGroupHandler(w http.ResponseWriter, r *http.Request, cc *CourseContext) {
+	if !requireStudentChoice(w, cc) {
+		return
+	}
+
+	var groupID uuid.UUID
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		// Lock the group so that concurrent joins cannot exceed its size
+		var group Group
+		id, err := uuid.Parse(r.PathValue("groupID"))
+		if err != nil {
+			return errGroupMissing
+		}
+		err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND course_id = ?", id, cc.Course.CourseID).First(&group).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errGroupMissing
+		}
+		if err != nil {
+			return err
+		}
+		groupID = group.ID
+
+		var count int64
+		if err := tx.Model(&GroupMember{}).Where("group_id = ? AND user_id <> ?", group.ID, cc.User.ID).Count(&count).Error; err != nil {
+			return err
+		}
+		if int(count) >= group.Size {
+			return errGroupFull
+		}
+
+		if err := tx.Where("course_id = ? AND user_id = ?", group.CourseID, cc.User.ID).Delete(&GroupMember{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&GroupMember{GroupID: group.ID, UserID: cc.User.ID, CourseID: group.CourseID}).Error
+	})
+	if err != nil {
+		writeGroupError(w, err)
+		return
+	}
+
+	writeGroup(w, http.StatusOK, cc.Course.CourseID, groupID)
+}
+
+// leaveGroupHandler removes the current student from their group, when the
+// course lets students choose their group
+func leaveGroupHandler(w http.ResponseWriter, r *http.Request, cc *CourseContext) {
+	if !requireStudentChoice(w, cc) {
+		return
+	}
+
+	result := DB.Where("course_id = ? AND user_id = ?", cc.Course.CourseID, cc.User.ID).Delete(&GroupMember{})
+	if result.Error != nil {
+		writeGroupError(w, result.Error)
+		return
+	}
+	if result.RowsAffected == 0 {
+		writeGroupError(w, errNotInGroup)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
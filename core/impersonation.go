@@ -0,0 +1,280 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// An impersonation lets a course admin see a course as one of its students
+// does: their tasks, access windows and submissions.
+// It is a session of the student opened by the admin, which is read-only,
+// limited to the course, never refreshed and audited request by request in
+// ImpersonationLog. It lasts as long as an access token (JWT_ACCESS_TTL); the
+// admin's own session is left as it is, so ending the impersonation or
+// letting it expire returns to it at the next refresh. Its access token is
+// only ever set as a cookie.
+
+// ImpersonationContextKey is the key for storing the impersonation session
+// of a request in its context
+const ImpersonationContextKey contextKey = "impersonation"
+
+// ImpersonationResponse marks the current user of /auth/me as impersonated
+type ImpersonationResponse struct {
+	ImpersonatorID string    `json:"impersonatorId"`
+	Impersonator   string    `json:"impersonator"` // Username of the course admin
+	CourseID       string    `json:"courseId"`     // The only course visible
+	ExpiresAt      time.Time `json:"expiresAt"`
+}
+
+// ImpersonationLogResponse represents an entry of the impersonation audit log
+type ImpersonationLogResponse struct {
+	SessionID    string    `json:"sessionId"`
+	Impersonator string    `json:"impersonator"`
+	Student      string    `json:"student"`
+	Method       string    `json:"method"`
+	Path         string    `json:"path"`
+	Status       int       `json:"status"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+// StartImpersonationResponse is the response to starting an impersonation,
+// whose access token is only sent as a cookie
+type StartImpersonationResponse struct {
+	User      UserResponse `json:"user"`
+	ExpiresIn int          `json:"expiresIn"` // Lifetime of the impersonation in seconds
+}
+
+// GetImpersonation returns the impersonation session of a request, or nil if
+// the user is not impersonated
+func GetImpersonation(r *http.Request) *Session {
+	session, _ := r.Context().Value(ImpersonationContextKey).(*Session)
+	return session
+}
+
+// isImpersonation reports whether a session is an impersonation
+func isImpersonation(session *Session) bool {
+	return session != nil && session.ImpersonatorID != nil
+}
+
+// impersonationResponse converts an impersonation session to its marker
+func impersonationResponse(session *Session) *ImpersonationResponse {
+	return &ImpersonationResponse{
+		ImpersonatorID: session.ImpersonatorID.String(),
+		Impersonator:   session.Impersonator.Username,
+		CourseID:       session.ImpersonatedCourse,
+		ExpiresAt:      session.ExpiresAt,
+	}
+}
+
+// auditImpersonation writes a request of an impersonation to the audit log
+func auditImpersonation(session *Session, method, path string, status int) {
+	entry := ImpersonationLog{
+		SessionID:      session.ID,
+		ImpersonatorID: *session.ImpersonatorID,
+		UserID:         session.UserID,
+		CourseID:       session.ImpersonatedCourse,
+		Method:         method,
+		Path:           truncate(path, 2048),
+		Status:         status,
+	}
+	if err := DB.Create(&entry).Error; err != nil {
+		log.Printf("Failed to audit impersonation %s: %s %s (%d): %v", session.ID, method, path, status, err)
+	}
+}
+
+// serveImpersonated serves a request of an impersonation session, refusing
+// every method that could change something, and audits it
+func serveImpersonated(w http.ResponseWriter, r *http.Request, session *Session, next http.HandlerFunc) {
+	rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+	if isWriteMethod(r.Method) {
+		http.Error(rec, "Forbidden: impersonation is read-only", http.StatusForbidden)
+	} else {
+		ctx := context.WithValue(r.Context(), ImpersonationContextKey, session)
+		next(rec, r.WithContext(ctx))
+	}
+	auditImpersonation(session, r.Method, r.URL.RequestURI(), rec.status)
+}
+
+// startImpersonationHandler opens an impersonation of a student of the
+// course and sets its access token cookie in place of the admin's
+func startImpersonationHandler(w http.ResponseWriter, r *http.Request, cc *CourseContext) {
+	admin := cc.User
+	student, err := GetUserByID(r.PathValue("userID"))
+	if err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if student.ID == admin.ID || student.Disabled {
+		http.Error(w, "Only active students of the course can be impersonated", http.StatusBadRequest)
+		return
+	}
+
+	role, err := ResolveCourseRole(student, cc.Course)
+	if err != nil {
+		log.Printf("Error resolving the role of %s in course %s: %v", student.Username, cc.Course.CourseID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if role != RoleStudent {
+		http.Error(w, "Only active students of the course can be impersonated", http.StatusBadRequest)
+		return
+	}
+
+	// The refresh token is thrown away, so that impersonations cannot be
+	// extended
+	refreshToken, err := randomToken()
+	if err != nil {
+		log.Printf("Failed to generate token: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	now := time.Now()
+	session := Session{
+		UserID:             student.ID,
+		User:               *student,
+		RefreshTokenHash:   hashToken(refreshToken),
+		UserAgent:          truncate(r.UserAgent(), 255),
+		ExpiresAt:          now.Add(GetConfig().JWT.AccessTokenTTL),
+		LastUsedAt:         now,
+		CreatedAt:          now,
+		ImpersonatorID:     &admin.ID,
+		Impersonator:       admin,
+		ImpersonatedCourse: cc.Course.CourseID,
+	}
+	if err := DB.Omit("User", "Impersonator").Create(&session).Error; err != nil {
+		log.Printf("Failed to create impersonation session: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	token, err := jwtService.GenerateToken(student, session.ID)
+	if err != nil {
+		log.Printf("Failed to generate token: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	jwtService.SetTokenCookie(w, token, false)
+
+	auditImpersonation(&session, r.Method, r.URL.RequestURI(), http.StatusCreated)
+	log.Printf("User %s started impersonating %s in course %s", admin.Username, student.Username, cc.Course.CourseID)
+
+	user := userResponse(student)
+	user.Impersonation = impersonationResponse(&session)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(StartImpersonationResponse{
+		User:      user,
+		ExpiresIn: int(GetConfig().JWT.AccessTokenTTL.Seconds()),
+	}); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+// endImpersonationHandler ends the impersonation of the request and clears
+// its access token cookie; the admin's session is renewed at /auth/refresh.
+// It authenticates on its own, since impersonations are read-only for
+// AuthMiddleware.
+func endImpersonationHandler(w http.ResponseWriter, r *http.Request) {
+	tokenString, err := jwtService.ExtractToken(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	_, session, err := authenticateToken(tokenString)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if !isImpersonation(session) {
+		http.Error(w, "Not impersonating", http.StatusBadRequest)
+		return
+	}
+
+	if err := endImpersonation(r, session, http.StatusNoContent); err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	jwtService.ClearTokenCookie(w)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// endImpersonation revokes an impersonation session and audits the request
+// that ended it, answered with the given status
+func endImpersonation(r *http.Request, session *Session, status int) error {
+	if err := RevokeSession(session.ID); err != nil {
+		log.Printf("Failed to revoke session %s: %v", session.ID, err)
+		return err
+	}
+	auditImpersonation(session, r.Method, r.URL.RequestURI(), status)
+	log.Printf("User %s stopped impersonating %s in course %s", session.Impersonator.Username, session.User.Username, session.ImpersonatedCourse)
+	return nil
+}
+
+// listImpersonationLogHandler returns the latest entries of the
+// impersonation audit log of the course, newest first
+func listImpersonationLogHandler(w http.ResponseWriter, r *http.Request, cc *CourseContext) {
+	limit := 100
+	if value := r.URL.Query().Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > 1000 {
+			http.Error(w, "limit must be between 1 and 1000", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	var entries []struct {
+		ImpersonationLog
+		Impersonator string
+		Student      string
+	}
+	err := DB.Model(&ImpersonationLog{}).
+		Select("impersonation_logs.*, impersonators.username AS impersonator, students.username AS student").
+		Joins("LEFT JOIN users impersonators ON impersonators.id = impersonation_logs.impersonator_id").
+		Joins("LEFT JOIN users students ON students.id = impersonation_logs.user_id").
+		Where("impersonation_logs.course_id = ?", cc.Course.CourseID).
+		Order("impersonation_logs.created_at DESC").
+		Limit(limit).
+		Scan(&entries).Error
+	if err != nil {
+		log.Printf("Error listing impersonations of course %s: %v", cc.Course.CourseID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	response := make([]ImpersonationLogResponse, 0, len(entries))
+	for _, entry := range entries {
+		response = append(response, ImpersonationLogResponse{
+			SessionID:    entry.SessionID.String(),
+			Impersonator: entry.Impersonator,
+			Student:      entry.Student,
+			Method:       entry.Method,
+			Path:         entry.Path,
+			Status:       entry.Status,
+			CreatedAt:    entry.CreatedAt,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+// impersonatedCourseAllowed reports whether a request may reach a course:
+// impersonations only see the course they were opened in
+func impersonatedCourseAllowed(r *http.Request, courseID string) bool {
+	session := GetImpersonation(r)
+	return session == nil || session.ImpersonatedCourse == courseID
+}
+
+// errImpersonationWebDAV refuses impersonation sessions on WebDAV, which
+// has no read-only mode
+var errImpersonationWebDAV = errors.New("impersonation sessions cannot use WebDAV")
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
@@ -12,40 +13,66 @@ import (
 
 // JWTClaims represents the JWT token claims
 type JWTClaims struct {
-	UserID   uuid.UUID `json:"user_id"`
-	Username string    `json:"username"`
+	UserID    uuid.UUID `json:"user_id"`
+	Username  string    `json:"username"`
+	SessionID uuid.UUID `json:"sid"` // Session the token was issued for, see sessions.go
 	jwt.RegisteredClaims
 }
 
-// JWTService handles JWT token operations
+// jwtIssuer is the iss claim of the tokens
+const jwtIssuer = "ironsnake"
+
+// JWTService handles JWT token operations. Tokens are signed with the RS256
+// or EdDSA signing key if one is configured, with the HS256 secret otherwise.
 type JWTService struct {
-	config *JWTConfig
+	config  *JWTConfig
+	signing *jwtKey            // nil with the HS256 secret
+	keys    map[string]*jwtKey // Keys accepted for verification, by kid
 }
 
 // NewJWTService creates a new JWT service instance
-func NewJWTService(config *JWTConfig) *JWTService {
-	return &JWTService{
-		config: config,
+func NewJWTService(config *JWTConfig) (*JWTService, error) {
+	signing, keys, err := loadJWTKeys(config)
+	if err != nil {
+		return nil, err
 	}
+	if signing == nil && config.Secret == "" {
+		return nil, errors.New("JWT_SECRET or JWT_SIGNING_KEY is required")
+	}
+	return &JWTService{
+		config:  config,
+		signing: signing,
+		keys:    keys,
+	}, nil
 }
 
-// GenerateToken creates a new JWT token for a user
-func (s *JWTService) GenerateToken(user *User) (string, error) {
-	expirationTime := time.Now().Add(time.Duration(s.config.ExpirationHours) * time.Hour)
+// GenerateToken creates a new short-lived access token for a session of a
+// user
+func (s *JWTService) GenerateToken(user *User, sessionID uuid.UUID) (string, error) {
+	expirationTime := time.Now().Add(s.config.AccessTokenTTL)
 
 	claims := &JWTClaims{
-		UserID:   user.ID,
-		Username: user.Username,
+		UserID:    user.ID,
+		Username:  user.Username,
+		SessionID: sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			NotBefore: jwt.NewNumericDate(time.Now()),
-			Issuer:    "ironsnake",
+			Issuer:    jwtIssuer,
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString([]byte(s.config.Secret))
+	var tokenString string
+	var err error
+	if s.signing != nil {
+		token := jwt.NewWithClaims(s.signing.method, claims)
+		token.Header["kid"] = s.signing.kid
+		tokenString, err = token.SignedString(s.signing.private)
+	} else {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+		tokenString, err = token.SignedString([]byte(s.config.Secret))
+	}
 	if err != nil {
 		return "", fmt.Errorf("failed to sign token: %w", err)
 	}
@@ -57,13 +84,7 @@ func (s *JWTService) GenerateToken(user *User) (string, error) {
 func (s *JWTService) ValidateToken(tokenString string) (*JWTClaims, error) {
 	claims := &JWTClaims{}
 
-	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		// Verify signing method
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return []byte(s.config.Secret), nil
-	})
+	token, err := jwt.ParseWithClaims(tokenString, claims, s.verificationKey, jwt.WithIssuer(jwtIssuer))
 
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse token: %w", err)
@@ -76,6 +97,28 @@ func (s *JWTService) ValidateToken(tokenString string) (*JWTClaims, error) {
 	return claims, nil
 }
 
+// verificationKey returns the key a token must be verified with: the key of
+// its kid among the signing and previous keys, or the HS256 secret
+func (s *JWTService) verificationKey(token *jwt.Token) (interface{}, error) {
+	if s.signing == nil {
+		// Verify signing method
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return []byte(s.config.Secret), nil
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	key, ok := s.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+	return key.public, nil
+}
+
 // ExtractTokenFromCookie extracts the JWT token from the request cookie
 func (s *JWTService) ExtractTokenFromCookie(r *http.Request) (string, error) {
 	cookie, err := r.Cookie("auth_token")
@@ -125,7 +168,7 @@ func (s *JWTService) ExtractToken(r *http.Request) (string, error) {
 
 // SetTokenCookie sets the JWT token as an HTTP-only cookie
 func (s *JWTService) SetTokenCookie(w http.ResponseWriter, token string, secure bool) {
-	maxAge := s.config.ExpirationHours * 3600 // Convert hours to seconds
+	maxAge := int(s.config.AccessTokenTTL.Seconds())
 
 	http.SetCookie(w, &http.Cookie{
 		Name:     "auth_token",
@@ -149,3 +192,44 @@ func (s *JWTService) ClearTokenCookie(w http.ResponseWriter) {
 		SameSite: http.SameSiteStrictMode,
 	})
 }
+
+// refreshCookiePath restricts the refresh token cookie to the auth routes, as
+// seen by the browser behind the reverse proxy
+func refreshCookiePath() string {
+	return GetConfig().APIBasePath + "/auth"
+}
+
+// ExtractRefreshToken extracts the refresh token from its cookie
+func (s *JWTService) ExtractRefreshToken(r *http.Request) (string, error) {
+	cookie, err := r.Cookie("refresh_token")
+	if err != nil || cookie.Value == "" {
+		return "", fmt.Errorf("refresh token cookie not found")
+	}
+	return cookie.Value, nil
+}
+
+// SetRefreshTokenCookie sets the refresh token as an HTTP-only cookie, only
+// sent to the auth routes
+func (s *JWTService) SetRefreshTokenCookie(w http.ResponseWriter, token string, secure bool) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     "refresh_token",
+		Value:    token,
+		Path:     refreshCookiePath(),
+		MaxAge:   s.config.ExpirationHours * 3600,
+		HttpOnly: true,
+		Secure:   secure,
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+// ClearRefreshTokenCookie removes the refresh token cookie
+func (s *JWTService) ClearRefreshTokenCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     "refresh_token",
+		Value:    "",
+		Path:     refreshCookiePath(),
+		MaxAge:   -1,
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+	})
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"ironsnake/core/oidc"
+)
+
+// jwtKey is an asymmetric key of the JWT key set. Only the signing key has a
+// private key; previous keys are kept to verify tokens issued before a
+// rotation.
+type jwtKey struct {
+	kid     string
+	method  jwt.SigningMethod
+	private crypto.Signer
+	public  crypto.PublicKey
+	jwk     oidc.JSONWebKey
+}
+
+// loadJWTKey loads a PEM encoded RSA or Ed25519 key. Private keys may be in
+// PKCS #8 or PKCS #1 form; public keys in PKIX form are accepted for
+// verification only. The kid is the RFC 7638 thumbprint of the key.
+func loadJWTKey(path string) (*jwtKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read JWT key: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM key found in %s", path)
+	}
+
+	var parsed any
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q in %s", block.Type, path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid JWT key %s: %w", path, err)
+	}
+
+	key := &jwtKey{}
+	if signer, ok := parsed.(crypto.Signer); ok {
+		key.private = signer
+		key.public = signer.Public()
+	} else {
+		key.public = parsed
+	}
+
+	switch public := key.public.(type) {
+	case *rsa.PublicKey:
+		if public.N.BitLen() < 2048 {
+			return nil, fmt.Errorf("RSA key %s is too short, 2048 bits at least are required", path)
+		}
+		key.method = jwt.SigningMethodRS256
+	case ed25519.PublicKey:
+		key.method = jwt.SigningMethodEdDSA
+	default:
+		return nil, fmt.Errorf("unsupported key type %T in %s, use RSA or Ed25519", public, path)
+	}
+
+	key.jwk, err = oidc.NewJSONWebKey(key.public, "", key.method.Alg())
+	if err != nil {
+		return nil, err
+	}
+	if key.kid, err = key.jwk.Thumbprint(); err != nil {
+		return nil, err
+	}
+	key.jwk.Kid = key.kid
+	return key, nil
+}
+
+// loadJWTKeys loads the signing key and the previous keys of the
+// configuration. It returns no keys when tokens are signed with the HS256
+// secret.
+func loadJWTKeys(config *JWTConfig) (*jwtKey, map[string]*jwtKey, error) {
+	if config.SigningKeyFile == "" {
+		if len(config.PreviousKeyFiles) > 0 {
+			return nil, nil, errors.New("JWT_PREVIOUS_KEYS requires JWT_SIGNING_KEY")
+		}
+		return nil, nil, nil
+	}
+
+	signing, err := loadJWTKey(config.SigningKeyFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	if signing.private == nil {
+		return nil, nil, fmt.Errorf("JWT signing key %s is not a private key", config.SigningKeyFile)
+	}
+
+	keys := map[string]*jwtKey{signing.kid: signing}
+	for _, path := range config.PreviousKeyFiles {
+		key, err := loadJWTKey(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		key.private = nil // Never used to sign
+		keys[key.kid] = key
+	}
+	return signing, keys, nil
+}
+
+// jwksHandler publishes the public keys tokens are verified with, so that
+// other services can verify them without sharing a secret. The set is empty
+// when tokens are signed with the HS256 secret.
+func jwksHandler(w http.ResponseWriter, r *http.Request) {
+	set := oidc.JSONWebKeySet{Keys: []oidc.JSONWebKey{}}
+	if signing := jwtService.signing; signing != nil {
+		// The signing key first, then the previous keys
+		set.Keys = append(set.Keys, signing.jwk)
+		for kid, key := range jwtService.keys {
+			if kid != signing.kid {
+				set.Keys = append(set.Keys, key.jwk)
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	if err := json.NewEncoder(w).Encode(set); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		log.Printf("Error encoding response: %v", err)
+	}
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+
+	"ironsnake/core/oidc"
+)
+
+// testKeys are generated once, RSA keys are slow to generate
+var testKeys = struct {
+	rsa1, rsa2 *rsa.PrivateKey
+	ed1, ed2   ed25519.PrivateKey
+}{
+	rsa1: mustRSAKey(),
+	rsa2: mustRSAKey(),
+	ed1:  mustEd25519Key(),
+	ed2:  mustEd25519Key(),
+}
+
+func mustRSAKey() *rsa.PrivateKey {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+	return key
+}
+
+func mustEd25519Key() ed25519.PrivateKey {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	return key
+}
+
+// writeKeyFile writes a private key in PKCS #8 form, or its public key in
+// PKIX form, and returns its path
+func writeKeyFile(t *testing.T, key crypto.Signer, public bool) string {
+	t.Helper()
+	block := &pem.Block{Type: "PRIVATE KEY"}
+	var err error
+	if public {
+		block.Type = "PUBLIC KEY"
+		block.Bytes, err = x509.MarshalPKIXPublicKey(key.Public())
+	} else {
+		block.Bytes, err = x509.MarshalPKCS8PrivateKey(key)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "key.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(block), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func newTestJWTService(t *testing.T, signing crypto.Signer, previous ...crypto.Signer) *JWTService {
+	t.Helper()
+	config := &JWTConfig{SigningKeyFile: writeKeyFile(t, signing, false), AccessTokenTTL: time.Minute}
+	for i, key := range previous {
+		// Previous keys may be configured as private or public keys
+		config.PreviousKeyFiles = append(config.PreviousKeyFiles, writeKeyFile(t, key, i%2 == 1))
+	}
+	service, err := NewJWTService(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return service
+}
+
+// keyID returns the kid a key gets in the key set
+func keyID(t *testing.T, key crypto.Signer) string {
+	t.Helper()
+	loaded, err := loadJWTKey(writeKeyFile(t, key, true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return loaded.kid
+}
+
+// signTestToken signs valid claims with any method, kid and key
+func signTestToken(t *testing.T, method jwt.SigningMethod, kid string, key any) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, &JWTClaims{
+		UserID:    uuid.New(),
+		SessionID: uuid.New(),
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+			Issuer:    jwtIssuer,
+		},
+	})
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestJWTKeyRotation(t *testing.T) {
+	tests := []struct {
+		name     string
+		old, new crypto.Signer
+	}{
+		{"RSA", testKeys.rsa1, testKeys.rsa2},
+		{"Ed25519", testKeys.ed1, testKeys.ed2},
+		{"RSA to Ed25519", testKeys.rsa1, testKeys.ed1},
+		{"Ed25519 to RSA", testKeys.ed1, testKeys.rsa1},
+	}
+	user := &User{ID: uuid.New(), Username: "jdoe"}
+	sessionID := uuid.New()
+
+	for _, tt := range tests {
+		before := newTestJWTService(t, tt.old)
+		token, err := before.GenerateToken(user, sessionID)
+		if err != nil {
+			t.Fatalf("%s: GenerateToken() = %v", tt.name, err)
+		}
+
+		// The old key is kept as a previous key
+		after := newTestJWTService(t, tt.new, tt.old)
+		claims, err := after.ValidateToken(token)
+		if err != nil {
+			t.Errorf("%s: token of the previous key refused: %v", tt.name, err)
+		} else if claims.UserID != user.ID || claims.SessionID != sessionID {
+			t.Errorf("%s: claims = %+v", tt.name, claims)
+		}
+		newToken, err := after.GenerateToken(user, sessionID)
+		if err != nil {
+			t.Fatalf("%s: GenerateToken() = %v", tt.name, err)
+		}
+		if _, err := after.ValidateToken(newToken); err != nil {
+			t.Errorf("%s: token of the signing key refused: %v", tt.name, err)
+		}
+		if _, err := before.ValidateToken(newToken); err == nil {
+			t.Errorf("%s: token of the new key accepted before the rotation", tt.name)
+		}
+
+		// The old key is dropped
+		dropped := newTestJWTService(t, tt.new)
+		if _, err := dropped.ValidateToken(token); err == nil {
+			t.Errorf("%s: token of a dropped key accepted", tt.name)
+		}
+	}
+}
+
+func TestJWTVerificationKeyRejects(t *testing.T) {
+	service := newTestJWTService(t, testKeys.rsa1, testKeys.ed1)
+	rsaKid, edKid := keyID(t, testKeys.rsa1), keyID(t, testKeys.ed1)
+	publicPEM, err := os.ReadFile(writeKeyFile(t, testKeys.rsa1, true))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := service.ValidateToken(signTestToken(t, jwt.SigningMethodRS256, rsaKid, testKeys.rsa1)); err != nil {
+		t.Fatalf("valid token refused: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"unknown kid", signTestToken(t, jwt.SigningMethodRS256, keyID(t, testKeys.rsa2), testKeys.rsa2)},
+		{"unknown kid signed with a known key", signTestToken(t, jwt.SigningMethodRS256, "other", testKeys.rsa1)},
+		{"no kid", signTestToken(t, jwt.SigningMethodRS256, "", testKeys.rsa1)},
+		{"HS256 with the RSA public key as secret", signTestToken(t, jwt.SigningMethodHS256, rsaKid, publicPEM)},
+		{"HS256 without kid", signTestToken(t, jwt.SigningMethodHS256, "", []byte("secret"))},
+		{"EdDSA with the RSA kid", signTestToken(t, jwt.SigningMethodEdDSA, rsaKid, testKeys.ed1)},
+		{"RS256 with the Ed25519 kid", signTestToken(t, jwt.SigningMethodRS256, edKid, testKeys.rsa1)},
+		{"PS256 with the RSA kid", signTestToken(t, jwt.SigningMethodPS256, rsaKid, testKeys.rsa1)},
+		{"none with the RSA kid", signTestToken(t, jwt.SigningMethodNone, rsaKid, jwt.UnsafeAllowNoneSignatureType)},
+	}
+	for _, tt := range tests {
+		if _, err := service.ValidateToken(tt.token); err == nil {
+			t.Errorf("%s: token accepted", tt.name)
+		}
+	}
+
+	// With the HS256 secret, asymmetric tokens are refused
+	secret, err := NewJWTService(&JWTConfig{Secret: "secret", AccessTokenTTL: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := secret.ValidateToken(signTestToken(t, jwt.SigningMethodRS256, rsaKid, testKeys.rsa1)); err == nil {
+		t.Error("RS256 token accepted with the HS256 secret")
+	}
+}
+
+func TestJWKSHandler(t *testing.T) {
+	previous := jwtService
+	t.Cleanup(func() { jwtService = previous })
+
+	keySet := func() oidc.JSONWebKeySet {
+		t.Helper()
+		w := httptest.NewRecorder()
+		jwksHandler(w, httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil))
+		var set oidc.JSONWebKeySet
+		if err := json.NewDecoder(w.Body).Decode(&set); err != nil {
+			t.Fatal(err)
+		}
+		return set
+	}
+
+	jwtService = newTestJWTService(t, testKeys.ed2, testKeys.rsa1, testKeys.ed1)
+	set := keySet()
+	var kids []string
+	for _, key := range set.Keys {
+		kids = append(kids, key.Kid)
+	}
+	if len(kids) != 3 || kids[0] != keyID(t, testKeys.ed2) {
+		t.Fatalf("kids = %v, want the signing key first", kids)
+	}
+	for _, key := range []crypto.Signer{testKeys.rsa1, testKeys.ed1} {
+		if !slices.Contains(kids, keyID(t, key)) {
+			t.Errorf("kids = %v, missing previous key %s", kids, keyID(t, key))
+		}
+	}
+	for _, key := range set.Keys {
+		if key.Alg != "EdDSA" && key.Alg != "RS256" {
+			t.Errorf("key %s has alg %q", key.Kid, key.Alg)
+		}
+	}
+
+	jwtService, _ = NewJWTService(&JWTConfig{Secret: "secret"})
+	if set := keySet(); len(set.Keys) != 0 {
+		t.Errorf("keys = %v with the HS256 secret, want none", set.Keys)
+	}
+}
@@ -1,15 +1,23 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"strings"
 
 	"github.com/go-ldap/ldap/v3"
 )
 
+// ErrLDAPUserNotFound is returned for usernames not in the directory
+var ErrLDAPUserNotFound = errors.New("user not found")
+
+// ldapUserAttributes are the attributes read to build an LDAPUser
+var ldapUserAttributes = []string{"uid", "mail", "givenName", "sn", "cn"}
+
 // LDAPService handles LDAP authentication operations
 type LDAPService struct {
 	config *LDAPConfig
+	pool   *ldapPool
 }
 
 // LDAPUser represents a user retrieved from LDAP
@@ -21,20 +29,17 @@ type LDAPUser struct {
 	DN        string
 }
 
-// NewLDAPService creates a new LDAP service instance
-func NewLDAPService(config *LDAPConfig) *LDAPService {
-	return &LDAPService{
-		config: config,
-	}
-}
-
-// Connect establishes a connection to the LDAP server
-func (s *LDAPService) Connect() (*ldap.Conn, error) {
-	conn, err := ldap.DialURL(s.config.URL)
+// NewLDAPService creates a new LDAP service instance. Connections are
+// opened on first use.
+func NewLDAPService(config *LDAPConfig) (*LDAPService, error) {
+	pool, err := newLDAPPool(config)
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to LDAP server: %w", err)
+		return nil, err
 	}
-	return conn, nil
+	return &LDAPService{
+		config: config,
+		pool:   pool,
+	}, nil
 }
 
 // Authenticate validates user credentials against LDAP and returns user info
@@ -42,74 +47,58 @@ func (s *LDAPService) Authenticate(username, password string) (*LDAPUser, error)
 	// Sanitize username to prevent LDAP injection
 	username = sanitizeLDAPInput(username)
 
-	conn, err := s.Connect()
-	if err != nil {
-		return nil, err
-	}
-	defer conn.Close()
+	var ldapUser *LDAPUser
+	err := s.withConn(func(conn *ldap.Conn) error {
+		// Search for user
+		searchFilter := fmt.Sprintf(s.config.UserFilter, username)
+		searchRequest := ldap.NewSearchRequest(
+			s.config.UserBaseDN,
+			ldap.ScopeWholeSubtree,
+			ldap.NeverDerefAliases,
+			0,
+			0,
+			false,
+			searchFilter,
+			ldapUserAttributes,
+			nil,
+		)
 
-	// Bind with admin credentials
-	err = conn.Bind(s.config.BindDN, s.config.BindPassword)
-	if err != nil {
-		return nil, fmt.Errorf("failed to bind with admin credentials: %w", err)
-	}
-
-	// Search for user
-	searchFilter := fmt.Sprintf(s.config.UserFilter, username)
-	searchRequest := ldap.NewSearchRequest(
-		s.config.UserBaseDN,
-		ldap.ScopeWholeSubtree,
-		ldap.NeverDerefAliases,
-		0,
-		0,
-		false,
-		searchFilter,
-		[]string{"uid", "mail", "givenName", "sn", "cn"},
-		nil,
-	)
-
-	searchResult, err := conn.Search(searchRequest)
-	if err != nil {
-		return nil, fmt.Errorf("failed to search for user: %w", err)
-	}
+		searchResult, err := conn.Search(searchRequest)
+		if err != nil {
+			return fmt.Errorf("failed to search for user: %w", err)
+		}
 
-	if len(searchResult.Entries) == 0 {
-		return nil, fmt.Errorf("user not found")
-	}
+		if len(searchResult.Entries) == 0 {
+			return ErrLDAPUserNotFound
+		}
 
-	if len(searchResult.Entries) > 1 {
-		return nil, fmt.Errorf("multiple users found with same username")
-	}
+		if len(searchResult.Entries) > 1 {
+			return fmt.Errorf("multiple users found with same username")
+		}
 
-	userEntry := searchResult.Entries[0]
-	userDN := userEntry.DN
+		userEntry := searchResult.Entries[0]
+		userDN := userEntry.DN
 
-	// Attempt to bind as the user to verify password
-	err = conn.Bind(userDN, password)
-	if err != nil {
-		return nil, fmt.Errorf("invalid credentials")
-	}
+		// Attempt to bind as the user to verify password
+		userErr := conn.Bind(userDN, password)
 
-	// Extract user attributes
-	ldapUser := &LDAPUser{
-		DN:        userDN,
-		Username:  username,
-		Email:     userEntry.GetAttributeValue("mail"),
-		FirstName: userEntry.GetAttributeValue("givenName"),
-		LastName:  userEntry.GetAttributeValue("sn"),
-	}
+		// Bind as the service account again before the connection is reused
+		if err := conn.Bind(s.config.BindDN, s.config.BindPassword); err != nil {
+			conn.Close()
+			return fmt.Errorf("failed to bind with admin credentials: %w", err)
+		}
 
-	// Fallback to cn if givenName/sn not available
-	if ldapUser.FirstName == "" && ldapUser.LastName == "" {
-		cn := userEntry.GetAttributeValue("cn")
-		parts := strings.SplitN(cn, " ", 2)
-		ldapUser.FirstName = parts[0]
-		if len(parts) > 1 {
-			ldapUser.LastName = parts[1]
+		if userErr != nil {
+			if ldap.IsErrorWithCode(userErr, ldap.ErrorNetwork) {
+				return userErr
+			}
+			return ErrInvalidCredentials
 		}
-	}
 
-	return ldapUser, nil
+		ldapUser = newLDAPUser(userEntry, username)
+		return nil
+	})
+	return ldapUser, err
 }
 
 // GetUserAttributes retrieves user attributes from LDAP without authentication
@@ -117,44 +106,39 @@ func (s *LDAPService) GetUserAttributes(username string) (*LDAPUser, error) {
 	// Sanitize username to prevent LDAP injection
 	username = sanitizeLDAPInput(username)
 
-	conn, err := s.Connect()
-	if err != nil {
-		return nil, err
-	}
-	defer conn.Close()
-
-	// Bind with admin credentials
-	err = conn.Bind(s.config.BindDN, s.config.BindPassword)
-	if err != nil {
-		return nil, fmt.Errorf("failed to bind with admin credentials: %w", err)
-	}
+	var ldapUser *LDAPUser
+	err := s.withConn(func(conn *ldap.Conn) error {
+		// Search for user
+		searchFilter := fmt.Sprintf(s.config.UserFilter, username)
+		searchRequest := ldap.NewSearchRequest(
+			s.config.UserBaseDN,
+			ldap.ScopeWholeSubtree,
+			ldap.NeverDerefAliases,
+			0,
+			0,
+			false,
+			searchFilter,
+			ldapUserAttributes,
+			nil,
+		)
 
-	// Search for user
-	searchFilter := fmt.Sprintf(s.config.UserFilter, username)
-	searchRequest := ldap.NewSearchRequest(
-		s.config.UserBaseDN,
-		ldap.ScopeWholeSubtree,
-		ldap.NeverDerefAliases,
-		0,
-		0,
-		false,
-		searchFilter,
-		[]string{"uid", "mail", "givenName", "sn", "cn"},
-		nil,
-	)
-
-	searchResult, err := conn.Search(searchRequest)
-	if err != nil {
-		return nil, fmt.Errorf("failed to search for user: %w", err)
-	}
+		searchResult, err := conn.Search(searchRequest)
+		if err != nil {
+			return fmt.Errorf("failed to search for user: %w", err)
+		}
 
-	if len(searchResult.Entries) == 0 {
-		return nil, fmt.Errorf("user not found")
-	}
+		if len(searchResult.Entries) == 0 {
+			return ErrLDAPUserNotFound
+		}
 
-	userEntry := searchResult.Entries[0]
+		ldapUser = newLDAPUser(searchResult.Entries[0], username)
+		return nil
+	})
+	return ldapUser, err
+}
 
-	// Extract user attributes
+// newLDAPUser extracts the attributes of a user entry
+func newLDAPUser(userEntry *ldap.Entry, username string) *LDAPUser {
 	ldapUser := &LDAPUser{
 		DN:        userEntry.DN,
 		Username:  username,
@@ -173,7 +157,7 @@ func (s *LDAPService) GetUserAttributes(username string) (*LDAPUser, error) {
 		}
 	}
 
-	return ldapUser, nil
+	return ldapUser
 }
 
 // sanitizeLDAPInput sanitizes user input to prevent LDAP injection
@@ -188,3 +172,197 @@ func sanitizeLDAPInput(input string) string {
 	)
 	return replacer.Replace(input)
 }
+
+// GetAttributes retrieves the values of the given attributes of a user,
+// keyed by lowercase attribute name
+func (s *LDAPService) GetAttributes(username string, names []string) (map[string][]string, error) {
+	// Sanitize username to prevent LDAP injection
+	username = sanitizeLDAPInput(username)
+
+	var attributes map[string][]string
+	err := s.withConn(func(conn *ldap.Conn) error {
+		searchFilter := fmt.Sprintf(s.config.UserFilter, username)
+		searchRequest := ldap.NewSearchRequest(
+			s.config.UserBaseDN,
+			ldap.ScopeWholeSubtree,
+			ldap.NeverDerefAliases,
+			0,
+			0,
+			false,
+			searchFilter,
+			names,
+			nil,
+		)
+
+		searchResult, err := conn.Search(searchRequest)
+		if err != nil {
+			return fmt.Errorf("failed to search for user: %w", err)
+		}
+
+		if len(searchResult.Entries) == 0 {
+			return ErrLDAPUserNotFound
+		}
+
+		attributes = make(map[string][]string)
+		for _, attribute := range searchResult.Entries[0].Attributes {
+			name := strings.ToLower(attribute.Name)
+			attributes[name] = append(attributes[name], attribute.Values...)
+		}
+		return nil
+	})
+	return attributes, err
+}
+
+// GetGroupMembers retrieves the users of an LDAP group, found by name with
+// the group filter. Members are read from the member and uniqueMember DNs of
+// groupOfNames entries and from the memberUid of posixGroup entries.
+func (s *LDAPService) GetGroupMembers(group string) ([]*LDAPUser, error) {
+	var members []*LDAPUser
+	err := s.withConn(func(conn *ldap.Conn) error {
+		searchRequest := ldap.NewSearchRequest(
+			s.config.GroupBaseDN,
+			ldap.ScopeWholeSubtree,
+			ldap.NeverDerefAliases,
+			0,
+			0,
+			false,
+			fmt.Sprintf(s.config.GroupFilter, sanitizeLDAPInput(group)),
+			[]string{"member", "uniqueMember", "memberUid"},
+			nil,
+		)
+
+		searchResult, err := conn.Search(searchRequest)
+		if err != nil {
+			return fmt.Errorf("failed to search for group: %w", err)
+		}
+
+		if len(searchResult.Entries) == 0 {
+			return fmt.Errorf("group %q not found", group)
+		}
+
+		if len(searchResult.Entries) > 1 {
+			return fmt.Errorf("multiple groups found with name %q", group)
+		}
+
+		groupEntry := searchResult.Entries[0]
+
+		memberDNs := append(groupEntry.GetAttributeValues("member"), groupEntry.GetAttributeValues("uniqueMember")...)
+		for _, dn := range memberDNs {
+			entry, err := s.getEntry(conn, dn)
+			if err != nil {
+				return err
+			}
+			if entry == nil {
+				continue // groupOfNames placeholders and non-user members
+			}
+			members = append(members, newLDAPUser(entry, entry.GetAttributeValue("uid")))
+		}
+
+		for _, uid := range groupEntry.GetAttributeValues("memberUid") {
+			searchRequest := ldap.NewSearchRequest(
+				s.config.UserBaseDN,
+				ldap.ScopeWholeSubtree,
+				ldap.NeverDerefAliases,
+				0,
+				0,
+				false,
+				fmt.Sprintf(s.config.UserFilter, sanitizeLDAPInput(uid)),
+				ldapUserAttributes,
+				nil,
+			)
+			result, err := conn.Search(searchRequest)
+			if err != nil {
+				return fmt.Errorf("failed to search for user %s: %w", uid, err)
+			}
+			if len(result.Entries) == 1 {
+				members = append(members, newLDAPUser(result.Entries[0], uid))
+			}
+		}
+
+		return nil
+	})
+	return members, err
+}
+
+// getEntry reads the user entry of a DN, or nil if the DN is not a user
+// entry below the user base DN
+func (s *LDAPService) getEntry(conn *ldap.Conn, dn string) (*ldap.Entry, error) {
+	searchRequest := ldap.NewSearchRequest(
+		dn,
+		ldap.ScopeBaseObject,
+		ldap.NeverDerefAliases,
+		0,
+		0,
+		false,
+		"(uid=*)",
+		ldapUserAttributes,
+		nil,
+	)
+
+	result, err := conn.Search(searchRequest)
+	if ldap.IsErrorWithCode(err, ldap.LDAPResultNoSuchObject) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read member %s: %w", dn, err)
+	}
+	if len(result.Entries) == 0 {
+		return nil, nil
+	}
+	return result.Entries[0], nil
+}
+
+// GetUserGroups retrieves the groups a user entry belongs to, as DNs. With
+// the memberof membership, they are read from the memberOf attribute of the
+// user; otherwise the groups listing the user are searched.
+func (s *LDAPService) GetUserGroups(userDN, username string) ([]string, error) {
+	var groups []string
+	err := s.withConn(func(conn *ldap.Conn) error {
+		if s.config.GroupMembership == "memberof" {
+			searchRequest := ldap.NewSearchRequest(
+				userDN,
+				ldap.ScopeBaseObject,
+				ldap.NeverDerefAliases,
+				0,
+				0,
+				false,
+				"(objectClass=*)",
+				[]string{"memberOf"},
+				nil,
+			)
+			result, err := conn.Search(searchRequest)
+			if err != nil {
+				return fmt.Errorf("failed to read groups of %s: %w", userDN, err)
+			}
+			if len(result.Entries) == 0 {
+				return ErrLDAPUserNotFound
+			}
+			groups = result.Entries[0].GetAttributeValues("memberOf")
+			return nil
+		}
+
+		searchFilter := fmt.Sprintf("(|(member=%s)(uniqueMember=%s)(memberUid=%s))",
+			ldap.EscapeFilter(userDN), ldap.EscapeFilter(userDN), ldap.EscapeFilter(username))
+		searchRequest := ldap.NewSearchRequest(
+			s.config.GroupBaseDN,
+			ldap.ScopeWholeSubtree,
+			ldap.NeverDerefAliases,
+			0,
+			0,
+			false,
+			searchFilter,
+			[]string{"cn"},
+			nil,
+		)
+		result, err := conn.Search(searchRequest)
+		if err != nil {
+			return fmt.Errorf("failed to search for groups of %s: %w", userDN, err)
+		}
+		groups = make([]string, len(result.Entries))
+		for i, entry := range result.Entries {
+			groups[i] = entry.DN
+		}
+		return nil
+	})
+	return groups, err
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// ldapHealthCheckAfter is how long a connection may stay idle before it is
+// checked again when taken from the pool
+const ldapHealthCheckAfter = 30 * time.Second
+
+// ldapPool is a bounded pool of connections bound as the service account.
+// Connections are dialed to the first reachable server of LDAPConfig.URLs,
+// starting with the last one that worked.
+type ldapPool struct {
+	config    *LDAPConfig
+	tlsConfig *tls.Config
+
+	slots chan struct{}    // One per connection in use, bounds the pool
+	idle  chan *pooledConn // Connections ready for reuse
+
+	mu        sync.Mutex
+	preferred int // Index of the URL of the last successful dial
+}
+
+// pooledConn is a connection of the pool
+type pooledConn struct {
+	*ldap.Conn
+	url      string
+	lastUsed time.Time
+}
+
+// newLDAPTLSConfig builds the TLS configuration of LDAPS and StartTLS
+// connections, trusting the CA bundle of the configuration if any
+func newLDAPTLSConfig(config *LDAPConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		ServerName: config.TLSServerName,
+		MinVersion: tls.VersionTLS12,
+	}
+	if config.CACertFile == "" {
+		return tlsConfig, nil
+	}
+
+	pem, err := os.ReadFile(config.CACertFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read LDAP CA bundle: %w", err)
+	}
+	roots, err := x509.SystemCertPool()
+	if err != nil {
+		roots = x509.NewCertPool()
+	}
+	if !roots.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificate found in LDAP CA bundle %s", config.CACertFile)
+	}
+	tlsConfig.RootCAs = roots
+	return tlsConfig, nil
+}
+
+// newLDAPPool creates an empty pool; connections are dialed on demand
+func newLDAPPool(config *LDAPConfig) (*ldapPool, error) {
+	if len(config.URLs) == 0 {
+		return nil, errors.New("no LDAP server URL configured")
+	}
+	for _, rawURL := range config.URLs {
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid LDAP URL %q: %w", rawURL, err)
+		}
+		if u.Scheme != "ldap" && u.Scheme != "ldaps" {
+			return nil, fmt.Errorf("invalid LDAP URL %q: scheme must be ldap or ldaps", rawURL)
+		}
+	}
+
+	tlsConfig, err := newLDAPTLSConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	size := max(config.PoolSize, 1)
+	return &ldapPool{
+		config:    config,
+		tlsConfig: tlsConfig,
+		slots:     make(chan struct{}, size),
+		idle:      make(chan *pooledConn, size),
+	}, nil
+}
+
+// get returns a healthy connection bound as the service account, waiting
+// for one to be released when the pool is exhausted
+func (p *ldapPool) get() (*pooledConn, error) {
+	select {
+	case p.slots <- struct{}{}:
+	case <-time.After(p.config.RequestTimeout):
+		return nil, errors.New("timed out waiting for an LDAP connection")
+	}
+
+	for {
+		select {
+		case conn := <-p.idle:
+			if p.healthy(conn) {
+				return conn, nil
+			}
+			conn.Close()
+			continue
+		default:
+		}
+
+		conn, err := p.dial()
+		if err != nil {
+			<-p.slots
+			return nil, err
+		}
+		return conn, nil
+	}
+}
+
+// put gives a connection back to the pool. Broken connections are closed.
+func (p *ldapPool) put(conn *pooledConn, broken bool) {
+	defer func() { <-p.slots }()
+
+	if broken || conn.IsClosing() {
+		conn.Close()
+		return
+	}
+	conn.lastUsed = time.Now()
+	select {
+	case p.idle <- conn:
+	default:
+		conn.Close()
+	}
+}
+
+// healthy checks a connection taken from the pool. Recently used connections
+// are trusted; the others must answer a WhoAmI request.
+func (p *ldapPool) healthy(conn *pooledConn) bool {
+	if conn.IsClosing() {
+		return false
+	}
+	if time.Since(conn.lastUsed) < ldapHealthCheckAfter {
+		return true
+	}
+	if _, err := conn.WhoAmI(nil); err != nil {
+		log.Printf("Dropping LDAP connection to %s: %v", conn.url, err)
+		return false
+	}
+	return true
+}
+
+// dial connects to the first reachable server, starting with the preferred
+// one, and binds as the service account
+func (p *ldapPool) dial() (*pooledConn, error) {
+	p.mu.Lock()
+	start := p.preferred
+	p.mu.Unlock()
+
+	var errs []error
+	for i := range p.config.URLs {
+		index := (start + i) % len(p.config.URLs)
+		serverURL := p.config.URLs[index]
+
+		conn, err := p.dialURL(serverURL)
+		if err != nil {
+			log.Printf("LDAP server %s unavailable: %v", serverURL, err)
+			errs = append(errs, fmt.Errorf("%s: %w", serverURL, err))
+			continue
+		}
+
+		if index != start {
+			log.Printf("LDAP failover to %s", serverURL)
+			p.mu.Lock()
+			p.preferred = index
+			p.mu.Unlock()
+		}
+		return &pooledConn{Conn: conn, url: serverURL, lastUsed: time.Now()}, nil
+	}
+	return nil, fmt.Errorf("failed to connect to LDAP server: %w", errors.Join(errs...))
+}
+
+// dialURL connects to a server, upgrades the connection with StartTLS if
+// configured and binds as the service account
+func (p *ldapPool) dialURL(serverURL string) (*ldap.Conn, error) {
+	u, err := url.Parse(serverURL)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig := p.tlsConfig.Clone()
+	if tlsConfig.ServerName == "" {
+		tlsConfig.ServerName = u.Hostname()
+	}
+
+	conn, err := ldap.DialURL(serverURL,
+		ldap.DialWithDialer(&net.Dialer{Timeout: p.config.DialTimeout}),
+		ldap.DialWithTLSConfig(tlsConfig),
+	)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetTimeout(p.config.RequestTimeout)
+
+	if p.config.StartTLS && u.Scheme == "ldap" {
+		if err := conn.StartTLS(tlsConfig); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("StartTLS failed: %w", err)
+		}
+	}
+
+	if err := conn.Bind(p.config.BindDN, p.config.BindPassword); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to bind with admin credentials: %w", err)
+	}
+	return conn, nil
+}
+
+// withConn runs fn on a pooled connection bound as the service account. fn
+// must leave the connection bound as the service account, or close it. On
+// network errors, fn is retried once on a new connection, possibly to
+// another server.
+func (s *LDAPService) withConn(fn func(conn *ldap.Conn) error) error {
+	var err error
+	for attempt := 0; attempt < 2; attempt++ {
+		var conn *pooledConn
+		conn, err = s.pool.get()
+		if err != nil {
+			return err
+		}
+
+		err = fn(conn.Conn)
+		broken := ldap.IsErrorWithCode(err, ldap.ErrorNetwork)
+		s.pool.put(conn, broken)
+		if !broken {
+			return err
+		}
+		log.Printf("LDAP connection to %s failed: %v", conn.url, err)
+	}
+	return err
+}
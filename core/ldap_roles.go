@@ -0,0 +1,221 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	"gopkg.in/yaml.v3"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// LDAPRoleMapping gives a role to the members of an LDAP group: platform
+// administration, or a role in a course of the catalog
+type LDAPRoleMapping struct {
+	Group         string `yaml:"group"` // Group DN, or the cn of the group
+	PlatformAdmin bool   `yaml:"platform_admin"`
+	Course        string `yaml:"course"`
+	Role          string `yaml:"role"` // student, tutor or admin
+}
+
+// ldapRoleMappingFile is the content of LDAP_ROLE_MAPPING_FILE, e.g.
+//
+//	mappings:
+//	  - group: ironsnake-admins
+//	    platform_admin: true
+//	  - group: cn=algo-tas,ou=groups,dc=ironsnake,dc=local
+//	    course: algo
+//	    role: tutor
+type ldapRoleMappingFile struct {
+	Mappings []LDAPRoleMapping `yaml:"mappings"`
+}
+
+// ldapRoleMappings are the mappings loaded at startup
+var ldapRoleMappings []LDAPRoleMapping
+
+// LoadLDAPRoleMappings reads and checks the LDAP group mappings of a file
+func LoadLDAPRoleMappings(path string) ([]LDAPRoleMapping, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read LDAP role mappings: %w", err)
+	}
+
+	var file ldapRoleMappingFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse LDAP role mappings: %w", err)
+	}
+
+	for i, mapping := range file.Mappings {
+		if mapping.Group == "" {
+			return nil, fmt.Errorf("LDAP role mapping %d: group is required", i+1)
+		}
+		if mapping.PlatformAdmin {
+			if mapping.Course != "" || mapping.Role != "" {
+				return nil, fmt.Errorf("LDAP role mapping %d: platform_admin cannot be combined with a course role", i+1)
+			}
+			continue
+		}
+		if mapping.Course == "" {
+			return nil, fmt.Errorf("LDAP role mapping %d: course or platform_admin is required", i+1)
+		}
+		if role, ok := parseCourseRole(mapping.Role); !ok || role == RoleNone {
+			return nil, fmt.Errorf("LDAP role mapping %d: role must be student, tutor or admin, not %q", i+1, mapping.Role)
+		}
+	}
+	return file.Mappings, nil
+}
+
+// matches reports whether one of the group DNs is the group of the mapping
+func (m LDAPRoleMapping) matches(groups []string) bool {
+	for _, group := range groups {
+		if strings.EqualFold(group, m.Group) {
+			return true
+		}
+		dn, err := ldap.ParseDN(group)
+		if err != nil || len(dn.RDNs) == 0 {
+			continue
+		}
+		for _, attribute := range dn.RDNs[0].Attributes {
+			if strings.EqualFold(attribute.Type, "cn") && strings.EqualFold(attribute.Value, m.Group) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ldapGrants are the roles the LDAP groups of a user give
+type ldapGrants struct {
+	platformAdmin bool
+	courses       map[string]CourseRole // By course ID, the highest role
+}
+
+// resolveLDAPGrants applies the mappings to the group DNs of a user
+func resolveLDAPGrants(mappings []LDAPRoleMapping, groups []string) ldapGrants {
+	grants := ldapGrants{courses: make(map[string]CourseRole)}
+	for _, mapping := range mappings {
+		if !mapping.matches(groups) {
+			continue
+		}
+		if mapping.PlatformAdmin {
+			grants.platformAdmin = true
+			continue
+		}
+		if role, _ := parseCourseRole(mapping.Role); role > grants.courses[mapping.Course] {
+			grants.courses[mapping.Course] = role
+		}
+	}
+	return grants
+}
+
+// applyLDAPGrants replaces the roles a user got from LDAP groups. Roles and
+// enrollments from other sources are left untouched.
+func applyLDAPGrants(user *User, grants ldapGrants) error {
+	var students []string
+	var staff []CourseStaff
+	for courseID, role := range grants.courses {
+		if role == RoleStudent {
+			students = append(students, courseID)
+		} else {
+			staff = append(staff, CourseStaff{UserID: user.ID, CourseID: courseID, Role: role.String(), Source: "ldap"})
+		}
+	}
+
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if user.LDAPAdmin != grants.platformAdmin {
+			if err := tx.Model(user).Update("ldap_admin", grants.platformAdmin).Error; err != nil {
+				return fmt.Errorf("failed to update platform administration: %w", err)
+			}
+		}
+
+		stale := tx.Where("user_id = ? AND source = ?", user.ID, "ldap")
+		if len(students) > 0 {
+			stale = stale.Where("course_id NOT IN ?", students)
+		}
+		if err := stale.Delete(&Enrollment{}).Error; err != nil {
+			return fmt.Errorf("failed to remove enrollments: %w", err)
+		}
+		for _, courseID := range students {
+			enrollment := Enrollment{UserID: user.ID, CourseID: courseID, Source: "ldap"}
+			if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&enrollment).Error; err != nil {
+				return fmt.Errorf("failed to enroll in %s: %w", courseID, err)
+			}
+		}
+
+		if err := tx.Where("user_id = ? AND source = ?", user.ID, "ldap").Delete(&CourseStaff{}).Error; err != nil {
+			return fmt.Errorf("failed to remove staff roles: %w", err)
+		}
+		if len(staff) > 0 {
+			if err := tx.Create(&staff).Error; err != nil {
+				return fmt.Errorf("failed to add staff roles: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// SyncLDAPRoles re-evaluates the roles an LDAP user gets from their groups
+func SyncLDAPRoles(user *User, userDN string) error {
+	if len(ldapRoleMappings) == 0 {
+		return nil
+	}
+	groups, err := ldapService.GetUserGroups(userDN, user.Username)
+	if err != nil {
+		return fmt.Errorf("failed to get LDAP groups of %s: %w", user.Username, err)
+	}
+	return applyLDAPGrants(user, resolveLDAPGrants(ldapRoleMappings, groups))
+}
+
+// syncAllLDAPRoles re-evaluates the roles of every LDAP user. Users missing
+// from the directory keep their roles, they cannot log in anyway.
+func syncAllLDAPRoles() {
+	var users []User
+	if err := DB.Where("auth_provider = ? OR ldap_enabled = ?", "ldap", true).Find(&users).Error; err != nil {
+		log.Printf("LDAP role sync failed to list users: %v", err)
+		return
+	}
+
+	failed := 0
+	for i := range users {
+		user := &users[i]
+		ldapUser, err := ldapService.GetUserAttributes(user.Username)
+		if err == nil {
+			err = SyncLDAPRoles(user, ldapUser.DN)
+		}
+		if err != nil {
+			log.Printf("LDAP role sync of %s failed: %v", user.Username, err)
+			failed++
+		}
+	}
+	log.Printf("LDAP role sync done: %d users, %d failed", len(users), failed)
+}
+
+// StartLDAPRoleSync loads the LDAP group mappings and, if there are any,
+// synchronizes the roles of LDAP users in the background
+func StartLDAPRoleSync(config *LDAPConfig) error {
+	if config.RoleMappingFile == "" {
+		return nil
+	}
+	mappings, err := LoadLDAPRoleMappings(config.RoleMappingFile)
+	if err != nil {
+		return err
+	}
+	ldapRoleMappings = mappings
+	log.Printf("Loaded %d LDAP role mappings", len(mappings))
+
+	if config.SyncInterval <= 0 {
+		return nil
+	}
+	go func() {
+		ticker := time.NewTicker(config.SyncInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			syncAllLDAPRoles()
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"maps"
+	"testing"
+)
+
+func TestLDAPRoleMappingMatches(t *testing.T) {
+	groups := []string{
+		"cn=algo-tas,ou=groups,dc=ironsnake,dc=local",
+		"CN=IronSnake-Admins,OU=Groups,DC=ironsnake,DC=local",
+		"not a DN",
+	}
+	tests := []struct {
+		group string
+		want  bool
+	}{
+		{"cn=algo-tas,ou=groups,dc=ironsnake,dc=local", true},
+		{"CN=ALGO-TAS,OU=GROUPS,DC=IRONSNAKE,DC=LOCAL", true},
+		{"algo-tas", true},
+		{"ironsnake-admins", true},
+		{"not a DN", true},
+		{"groups", false}, // Only the cn of the group itself is matched
+		{"ironsnake", false},
+		{"algo", false},
+		{"cn=algo-tas,ou=groups,dc=other,dc=local", false},
+	}
+	for _, tt := range tests {
+		if got := (LDAPRoleMapping{Group: tt.group}).matches(groups); got != tt.want {
+			t.Errorf("matches(%q) = %v, want %v", tt.group, got, tt.want)
+		}
+	}
+
+	if (LDAPRoleMapping{Group: "algo-tas"}).matches(nil) {
+		t.Error("matches() of a user without groups = true, want false")
+	}
+}
+
+func TestResolveLDAPGrants(t *testing.T) {
+	mappings := []LDAPRoleMapping{
+		{Group: "ironsnake-admins", PlatformAdmin: true},
+		{Group: "algo-students", Course: "algo", Role: "student"},
+		{Group: "algo-tas", Course: "algo", Role: "tutor"},
+		{Group: "cn=algo-teachers,ou=groups,dc=ironsnake,dc=local", Course: "algo", Role: "admin"},
+		{Group: "python-students", Course: "python", Role: "student"},
+	}
+	tests := []struct {
+		name          string
+		groups        []string
+		platformAdmin bool
+		courses       map[string]CourseRole
+	}{
+		{"no groups", nil, false, map[string]CourseRole{}},
+		{"unmapped group", []string{"cn=staff,ou=groups,dc=ironsnake,dc=local"}, false, map[string]CourseRole{}},
+		{"platform admin", []string{"cn=ironsnake-admins,ou=groups,dc=ironsnake,dc=local"}, true, map[string]CourseRole{}},
+		{
+			"student of two courses",
+			[]string{"cn=algo-students,ou=groups,dc=ironsnake,dc=local", "cn=python-students,ou=groups,dc=ironsnake,dc=local"},
+			false,
+			map[string]CourseRole{"algo": RoleStudent, "python": RoleStudent},
+		},
+		{
+			"highest role wins, in any order",
+			[]string{
+				"cn=algo-teachers,ou=groups,dc=ironsnake,dc=local",
+				"cn=algo-students,ou=groups,dc=ironsnake,dc=local",
+				"cn=algo-tas,ou=groups,dc=ironsnake,dc=local",
+			},
+			false,
+			map[string]CourseRole{"algo": RoleAdmin},
+		},
+		{
+			"platform admin and tutor",
+			[]string{"cn=ironsnake-admins,ou=groups,dc=ironsnake,dc=local", "cn=algo-tas,ou=groups,dc=ironsnake,dc=local"},
+			true,
+			map[string]CourseRole{"algo": RoleTutor},
+		},
+	}
+	for _, tt := range tests {
+		grants := resolveLDAPGrants(mappings, tt.groups)
+		if grants.platformAdmin != tt.platformAdmin {
+			t.Errorf("%s: platformAdmin = %v, want %v", tt.name, grants.platformAdmin, tt.platformAdmin)
+		}
+		if !maps.Equal(grants.courses, tt.courses) {
+			t.Errorf("%s: courses = %v, want %v", tt.name, grants.courses, tt.courses)
+		}
+	}
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// LoginThrottle counts the failed logins of a username or a client address.
+// Usernames are counted whether they exist or not, so that throttling does
+// not reveal which accounts exist. Rows keyed by mail:<user ID> only record
+// the last email sent to an account (see allowAccountMail).
+type LoginThrottle struct {
+	Key         string     `gorm:"type:varchar(320);primaryKey"` // user:<username>, ip:<address> or mail:<user ID>
+	Failures    int        `gorm:"not null;default:0"`
+	LastAttempt time.Time  `gorm:"type:timestamp;not null"`
+	LockedUntil *time.Time `gorm:"type:timestamp"`
+}
+
+// LoginThrottledError is returned for logins attempted before the backoff
+// delay or lockout of their username or address ended
+type LoginThrottledError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LoginThrottledError) Error() string {
+	return fmt.Sprintf("too many failed logins, retry after %s", e.RetryAfter)
+}
+
+// loginAttempt is a login counted as failed until it succeeds
+type loginAttempt struct {
+	userKey string
+	ipKey   string
+}
+
+// userThrottleKey returns the throttle key of a username
+func userThrottleKey(username string) string {
+	return "user:" + strings.ToLower(strings.TrimSpace(username))
+}
+
+// clientIP returns the address of the client of a request. Behind trusted
+// reverse proxies, it is the last address of X-Forwarded-For that is not a
+// trusted proxy; other clients could forge the header.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	trusted := func(address string) bool {
+		ip := net.ParseIP(address)
+		return ip != nil && slices.ContainsFunc(GetConfig().TrustedProxies, func(n *net.IPNet) bool { return n.Contains(ip) })
+	}
+	if !trusted(host) {
+		return host
+	}
+
+	forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		address := strings.TrimSpace(forwarded[i])
+		if address == "" {
+			continue
+		}
+		if net.ParseIP(address) == nil {
+			break
+		}
+		host = address
+		if !trusted(address) {
+			break
+		}
+	}
+	return host
+}
+
+// backoffDelay returns how long to wait after a failure, given the failures
+// counted so far
+func backoffDelay(failures, free int, config *LoginThrottleConfig) time.Duration {
+	if failures < free {
+		return 0
+	}
+	exponent := failures - free
+	if exponent > 30 {
+		return config.MaxDelay
+	}
+	return min(time.Duration(float64(config.BaseDelay)*math.Pow(2, float64(exponent))), config.MaxDelay)
+}
+
+// beginLogin counts a login attempt of a username from an address before the
+// credentials are checked, so that parallel attempts are throttled too. It
+// returns LoginThrottledError if the attempt must wait.
+func beginLogin(username, ip string) (*loginAttempt, error) {
+	config := &GetConfig().LoginThrottle
+	attempt := &loginAttempt{userKey: userThrottleKey(username), ipKey: "ip:" + ip}
+	keys := []string{attempt.ipKey, attempt.userKey}
+	slices.Sort(keys) // Lock rows in the same order in every transaction
+
+	var retryAfter time.Duration
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		throttles := make(map[string]*LoginThrottle, len(keys))
+		for _, key := range keys {
+			err := tx.Clauses(clause.OnConflict{DoNothing: true}).
+				Create(&LoginThrottle{Key: key, LastAttempt: now}).Error
+			if err != nil {
+				return err
+			}
+			var throttle LoginThrottle
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("key = ?", key).First(&throttle).Error; err != nil {
+				return err
+			}
+			if now.Sub(throttle.LastAttempt) > config.FailureWindow {
+				throttle.Failures = 0
+			}
+			throttles[key] = &throttle
+		}
+
+		for key, throttle := range throttles {
+			free := config.FreeAttempts
+			if key == attempt.ipKey {
+				free = config.IPFreeAttempts
+			}
+			wait := throttle.LastAttempt.Add(backoffDelay(throttle.Failures, free, config)).Sub(now)
+			if throttle.LockedUntil != nil {
+				wait = max(wait, throttle.LockedUntil.Sub(now))
+			}
+			retryAfter = max(retryAfter, wait)
+		}
+		if retryAfter > 0 {
+			return nil
+		}
+
+		for key, throttle := range throttles {
+			updates := map[string]interface{}{"failures": throttle.Failures + 1, "last_attempt": now}
+			if key == attempt.userKey && config.LockoutThreshold > 0 && throttle.Failures+1 >= config.LockoutThreshold {
+				updates["locked_until"] = now.Add(config.LockoutDuration)
+				updates["failures"] = 0 // Back off from scratch after the lockout
+			}
+			if err := tx.Model(throttle).Updates(updates).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if retryAfter > 0 {
+		return nil, &LoginThrottledError{RetryAfter: retryAfter}
+	}
+	return attempt, nil
+}
+
+// succeeded forgets the failures of the username and does not count the
+// attempt against the address
+func (a *loginAttempt) succeeded() {
+	if err := DB.Where("key = ?", a.userKey).Delete(&LoginThrottle{}).Error; err != nil {
+		log.Printf("Failed to reset login throttle of %s: %v", a.userKey, err)
+	}
+	a.uncount(a.ipKey)
+}
+
+// aborted does not count an attempt that failed for another reason than the
+// credentials, e.g. an unreachable LDAP server
+func (a *loginAttempt) aborted() {
+	a.uncount(a.userKey)
+	a.uncount(a.ipKey)
+}
+
+func (a *loginAttempt) uncount(key string) {
+	err := DB.Model(&LoginThrottle{}).Where("key = ? AND failures > 0", key).
+		Update("failures", gorm.Expr("failures - 1")).Error
+	if err != nil {
+		log.Printf("Failed to update login throttle of %s: %v", key, err)
+	}
+}
+
+// isCredentialError reports whether an authentication error is the fault of
+// the credentials, and so counts as a failed attempt
+func isCredentialError(err error) bool {
+	return errors.Is(err, ErrInvalidCredentials) || errors.Is(err, ErrLDAPUserNotFound) ||
+		errors.Is(err, ErrUserDisabled)
+}
+
+// authenticateThrottled checks credentials like authenticateCredentials,
+// throttling the attempts per username and client address
+func authenticateThrottled(username, password, ip string) (*User, error) {
+	attempt, err := beginLogin(username, ip)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := authenticateCredentials(username, password)
+	switch {
+	case err == nil, errors.Is(err, ErrEmailNotVerified):
+		attempt.succeeded()
+	case !isCredentialError(err):
+		attempt.aborted()
+	}
+	return user, err
+}
+
+// writeLoginThrottled rejects a throttled login with 429 Too Many Requests
+func writeLoginThrottled(w http.ResponseWriter, throttled *LoginThrottledError) {
+	seconds := int(math.Ceil(throttled.RetryAfter.Seconds()))
+	w.Header().Set("Retry-After", fmt.Sprint(seconds))
+	http.Error(w, fmt.Sprintf("Too many failed login attempts, try again in %d seconds", seconds), http.StatusTooManyRequests)
+}
+
+// StartLoginThrottleCleanup periodically deletes the counters of usernames
+// and addresses without recent attempts
+func StartLoginThrottleCleanup(config *LoginThrottleConfig) {
+	if config.FailureWindow <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(config.FailureWindow)
+		defer ticker.Stop()
+		for range ticker.C {
+			now := time.Now()
+			err := DB.Where("last_attempt < ? AND (locked_until IS NULL OR locked_until < ?)", now.Add(-config.FailureWindow), now).
+				Delete(&LoginThrottle{}).Error
+			if err != nil {
+				log.Printf("Failed to clean up login throttles: %v", err)
+			}
+		}
+	}()
+}
+
+// adminUnlockUserHandler lifts the lockout and backoff of a user
+func adminUnlockUserHandler(w http.ResponseWriter, r *http.Request) {
+	admin, err := GetUserFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	user, err := GetUserByID(r.PathValue("userID"))
+	if err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	if err := DB.Where("key = ?", userThrottleKey(user.Username)).Delete(&LoginThrottle{}).Error; err != nil {
+		log.Printf("Error unlocking user %s: %v", user.Username, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Platform administrator %s unlocked user %s", admin.Username, user.Username)
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestClientIP(t *testing.T) {
+	proxies, err := parseNetworks("127.0.0.1,::1,10.0.0.0/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := config
+	config = &Config{TrustedProxies: proxies}
+	t.Cleanup(func() { config = previous })
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  []string
+		want       string
+	}{
+		{"direct client", "203.0.113.7:4242", nil, "203.0.113.7"},
+		{"untrusted client forging the header", "203.0.113.7:4242", []string{"198.51.100.1"}, "203.0.113.7"},
+		{"trusted proxy", "127.0.0.1:4242", []string{"198.51.100.1"}, "198.51.100.1"},
+		{"IPv6 trusted proxy", "[::1]:4242", []string{"2001:db8::1"}, "2001:db8::1"},
+		{"trusted proxy without header", "127.0.0.1:4242", nil, "127.0.0.1"},
+		{"chain of trusted proxies", "127.0.0.1:4242", []string{"198.51.100.1, 10.0.0.2, 10.0.0.3"}, "198.51.100.1"},
+		{"client forging the start of the chain", "127.0.0.1:4242", []string{"192.0.2.99, 198.51.100.1"}, "198.51.100.1"},
+		{"several headers", "127.0.0.1:4242", []string{"192.0.2.99", "198.51.100.1"}, "198.51.100.1"},
+		{"invalid address in the chain", "127.0.0.1:4242", []string{"198.51.100.1, garbage, 10.0.0.2"}, "10.0.0.2"},
+		{"empty entries", "127.0.0.1:4242", []string{"198.51.100.1, ,"}, "198.51.100.1"},
+		{"remote address without port", "203.0.113.7", nil, "203.0.113.7"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("POST", "/auth/login", nil)
+		r.RemoteAddr = tt.remoteAddr
+		for _, value := range tt.forwarded {
+			r.Header.Add("X-Forwarded-For", value)
+		}
+		if got := clientIP(r); got != tt.want {
+			t.Errorf("%s: clientIP() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestBackoffDelay(t *testing.T) {
+	throttle := &LoginThrottleConfig{BaseDelay: time.Second, MaxDelay: 5 * time.Minute}
+	tests := []struct {
+		failures int
+		free     int
+		want     time.Duration
+	}{
+		{0, 3, 0},
+		{2, 3, 0},
+		{3, 3, time.Second},
+		{4, 3, 2 * time.Second},
+		{5, 3, 4 * time.Second},
+		{11, 3, 256 * time.Second},
+		{12, 3, 5 * time.Minute},
+		{33, 3, 5 * time.Minute},
+		{34, 3, 5 * time.Minute},
+		{1000, 3, 5 * time.Minute},
+		{0, 0, time.Second},
+	}
+	for _, tt := range tests {
+		if got := backoffDelay(tt.failures, tt.free, throttle); got != tt.want {
+			t.Errorf("backoffDelay(%d, %d) = %s, want %s", tt.failures, tt.free, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,220 @@
+// Package mail sends plain text emails through a pluggable backend: an SMTP
+// server, the log or a directory of .eml files for development and tests.
+package mail
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Message is a plain text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer sends emails
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// Config selects and configures a backend
+type Config struct {
+	Backend string // smtp, log or file
+	From    string // Sender address, optionally with a name
+
+	// SMTP backend
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string // Authenticates with PLAIN if set
+	SMTPPassword string
+	SMTPTLS      bool // Implicit TLS (SMTPS), usually on port 465; STARTTLS is used whenever offered otherwise
+
+	// File backend
+	Dir string
+}
+
+// New creates the mailer of the backend of config
+func New(config Config) (Mailer, error) {
+	if _, err := mail.ParseAddress(config.From); err != nil {
+		return nil, fmt.Errorf("invalid sender address %q: %w", config.From, err)
+	}
+
+	switch config.Backend {
+	case "smtp":
+		if config.SMTPHost == "" {
+			return nil, errors.New("SMTP host is required")
+		}
+		return &SMTPMailer{config: config}, nil
+	case "log", "":
+		return &LogMailer{from: config.From}, nil
+	case "file":
+		if err := os.MkdirAll(config.Dir, 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create mail directory: %w", err)
+		}
+		return &FileMailer{from: config.From, dir: config.Dir}, nil
+	}
+	return nil, fmt.Errorf("unknown mail backend %q, use smtp, log or file", config.Backend)
+}
+
+// Format encodes a message as an RFC 5322 email with a quoted-printable UTF-8
+// body
+func Format(from string, msg Message, date time.Time) ([]byte, error) {
+	if _, err := mail.ParseAddress(msg.To); err != nil {
+		return nil, fmt.Errorf("invalid recipient %q: %w", msg.To, err)
+	}
+	if strings.ContainsAny(msg.Subject, "\r\n") {
+		return nil, errors.New("subject contains a line break")
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "Message-ID: <%s@%s>\r\n", randomID(), domain(from))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+
+	body := quotedprintable.NewWriter(&buf)
+	if _, err := body.Write([]byte(strings.ReplaceAll(msg.Body, "\n", "\r\n"))); err != nil {
+		return nil, err
+	}
+	if err := body.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// SMTPMailer sends emails to an SMTP server
+type SMTPMailer struct {
+	config Config
+}
+
+// Send delivers a message to the SMTP server
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+	data, err := Format(m.config.From, msg, time.Now())
+	if err != nil {
+		return err
+	}
+	from, _ := mail.ParseAddress(m.config.From)
+	to, _ := mail.ParseAddress(msg.To)
+
+	addr := net.JoinHostPort(m.config.SMTPHost, fmt.Sprint(m.config.SMTPPort))
+	tlsConfig := &tls.Config{ServerName: m.config.SMTPHost, MinVersion: tls.VersionTLS12}
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+
+	var conn net.Conn
+	if m.config.SMTPTLS {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: tlsConfig}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to connect to SMTP server: %w", err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	} else {
+		conn.SetDeadline(time.Now().Add(time.Minute))
+	}
+
+	client, err := smtp.NewClient(conn, m.config.SMTPHost)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("SMTP handshake failed: %w", err)
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok && !m.config.SMTPTLS {
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("STARTTLS failed: %w", err)
+		}
+	}
+	if m.config.SMTPUsername != "" {
+		// PlainAuth refuses to send the password without TLS, except to localhost
+		auth := smtp.PlainAuth("", m.config.SMTPUsername, m.config.SMTPPassword, m.config.SMTPHost)
+		if err := client.Auth(auth); err != nil {
+			return fmt.Errorf("SMTP authentication failed: %w", err)
+		}
+	}
+
+	if err := client.Mail(from.Address); err != nil {
+		return fmt.Errorf("SMTP sender refused: %w", err)
+	}
+	if err := client.Rcpt(to.Address); err != nil {
+		return fmt.Errorf("SMTP recipient refused: %w", err)
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("SMTP server refused the message: %w", err)
+	}
+	return client.Quit()
+}
+
+// LogMailer writes emails to the log instead of sending them
+type LogMailer struct {
+	from string
+}
+
+// Send logs a message
+func (m *LogMailer) Send(ctx context.Context, msg Message) error {
+	log.Printf("Email from %s to %s: %s\n%s", m.from, msg.To, msg.Subject, msg.Body)
+	return nil
+}
+
+// FileMailer writes each email to an .eml file of a directory
+type FileMailer struct {
+	from string
+	dir  string
+}
+
+// Send writes a message to a new file
+func (m *FileMailer) Send(ctx context.Context, msg Message) error {
+	now := time.Now()
+	data, err := Format(m.from, msg, now)
+	if err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%s.eml", now.UTC().Format("20060102T150405.000000000"), randomID()[:8])
+	return os.WriteFile(filepath.Join(m.dir, name), data, 0o644)
+}
+
+func randomID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// domain returns the domain of an address, for message IDs
+func domain(address string) string {
+	if addr, err := mail.ParseAddress(address); err == nil {
+		if _, d, ok := strings.Cut(addr.Address, "@"); ok {
+			return d
+		}
+	}
+	return "localhost"
+}
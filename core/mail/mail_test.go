@@ -0,0 +1,214 @@
+package mail_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	netmail "net/mail"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"ironsnake/core/mail"
+)
+
+func TestFormat(t *testing.T) {
+	msg := mail.Message{
+		To:      "Ada Lovelace <ada@example.com>",
+		Subject: "Réinitialisation du mot de passe",
+		Body:    "Bonjour,\nvoici le lien : https://example.com/reset?token=abc\n",
+	}
+	data, err := mail.Format("IronSnake <noreply@example.com>", msg, time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("Format failed: %v", err)
+	}
+
+	parsed, err := netmail.ReadMessage(strings.NewReader(string(data)))
+	if err != nil {
+		t.Fatalf("formatted message does not parse: %v", err)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject"))
+	if err != nil || subject != msg.Subject {
+		t.Errorf("Subject = %q (%v), want %q", subject, err, msg.Subject)
+	}
+	if got := parsed.Header.Get("To"); got != msg.To {
+		t.Errorf("To = %q, want %q", got, msg.To)
+	}
+	body, err := io.ReadAll(quotedprintable.NewReader(parsed.Body))
+	if err != nil {
+		t.Fatalf("body is not quoted-printable: %v", err)
+	}
+	if want := strings.ReplaceAll(msg.Body, "\n", "\r\n"); string(body) != want {
+		t.Errorf("body = %q, want %q", body, want)
+	}
+}
+
+func TestFormatRefusesHeaderInjection(t *testing.T) {
+	for name, msg := range map[string]mail.Message{
+		"recipient": {To: "a@example.com\r\nBcc: b@example.com", Subject: "Hello"},
+		"subject":   {To: "a@example.com", Subject: "Hello\r\nBcc: b@example.com"},
+	} {
+		if _, err := mail.Format("noreply@example.com", msg, time.Now()); err == nil {
+			t.Errorf("%s: line break accepted", name)
+		}
+	}
+}
+
+func TestNew(t *testing.T) {
+	if _, err := mail.New(mail.Config{Backend: "log", From: "not an address"}); err == nil {
+		t.Error("invalid sender accepted")
+	}
+	if _, err := mail.New(mail.Config{Backend: "pigeon", From: "noreply@example.com"}); err == nil {
+		t.Error("unknown backend accepted")
+	}
+	if _, err := mail.New(mail.Config{Backend: "smtp", From: "noreply@example.com"}); err == nil {
+		t.Error("SMTP backend without host accepted")
+	}
+}
+
+func TestFileMailer(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "mail")
+	mailer, err := mail.New(mail.Config{Backend: "file", From: "noreply@example.com", Dir: dir})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	for range 2 {
+		if err := mailer.Send(context.Background(), mail.Message{To: "ada@example.com", Subject: "Hello", Body: "Hi"}); err != nil {
+			t.Fatalf("Send failed: %v", err)
+		}
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if len(files) != 2 {
+		t.Fatalf("got %d files, want 2", len(files))
+	}
+	data, _ := os.ReadFile(files[0])
+	if !strings.Contains(string(data), "To: ada@example.com\r\n") {
+		t.Errorf("unexpected message:\n%s", data)
+	}
+}
+
+func TestSMTPMailer(t *testing.T) {
+	server := newSMTPServer(t)
+	mailer, err := mail.New(mail.Config{
+		Backend:      "smtp",
+		From:         "IronSnake <noreply@example.com>",
+		SMTPHost:     "127.0.0.1",
+		SMTPPort:     server.port,
+		SMTPUsername: "mailer",
+		SMTPPassword: "secret",
+	})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	msg := mail.Message{To: "Ada <ada@example.com>", Subject: "Hello", Body: "Hi Ada"}
+	if err := mailer.Send(context.Background(), msg); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+
+	received := <-server.received
+	if received.auth != "\x00mailer\x00secret" {
+		t.Errorf("AUTH = %q", received.auth)
+	}
+	if received.from != "<noreply@example.com>" || received.to != "<ada@example.com>" {
+		t.Errorf("envelope = %s -> %s", received.from, received.to)
+	}
+	if !strings.Contains(received.data, "Subject: Hello\r\n") || !strings.Contains(received.data, "Hi Ada") {
+		t.Errorf("unexpected message:\n%s", received.data)
+	}
+}
+
+// smtpServer is a minimal SMTP server accepting a single message
+type smtpServer struct {
+	port     int
+	received chan smtpMessage
+}
+
+type smtpMessage struct {
+	auth, from, to, data string
+}
+
+func newSMTPServer(t *testing.T) *smtpServer {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	server := &smtpServer{
+		port:     listener.Addr().(*net.TCPAddr).Port,
+		received: make(chan smtpMessage, 1),
+	}
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		r := bufio.NewReader(conn)
+		reply := func(s string) { conn.Write([]byte(s + "\r\n")) }
+		var msg smtpMessage
+
+		reply("220 test ESMTP")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = strings.TrimRight(line, "\r\n")
+			verb, arg, _ := strings.Cut(line, " ")
+			switch strings.ToUpper(verb) {
+			case "EHLO":
+				reply("250-test")
+				reply("250 AUTH PLAIN")
+			case "AUTH":
+				_, initial, _ := strings.Cut(arg, " ")
+				decoded, _ := base64.StdEncoding.DecodeString(initial)
+				msg.auth = string(decoded)
+				reply("235 authenticated")
+			case "MAIL":
+				msg.from = strings.TrimPrefix(arg, "FROM:")
+				if i := strings.Index(msg.from, " "); i >= 0 {
+					msg.from = msg.from[:i]
+				}
+				reply("250 ok")
+			case "RCPT":
+				msg.to = strings.TrimPrefix(arg, "TO:")
+				reply("250 ok")
+			case "DATA":
+				reply("354 go ahead")
+				var data strings.Builder
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if line == ".\r\n" {
+						break
+					}
+					data.WriteString(line)
+				}
+				msg.data = data.String()
+				reply("250 queued")
+				server.received <- msg
+			case "QUIT":
+				reply("221 bye")
+				return
+			default:
+				reply("502 " + strconv.Quote(verb) + " not implemented")
+			}
+		}
+	}()
+	return server
+}
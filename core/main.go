@@ -4,6 +4,9 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 )
 
 func main() {
@@ -20,42 +23,115 @@ func main() {
 	InitAuthServices(config)
 	log.Println("Authentication services initialized")
 
+	if err := BootstrapPlatformAdmins(config); err != nil {
+		log.Printf("Failed to bootstrap platform administrators: %v", err)
+	}
+	if err := StartLDAPRoleSync(&config.LDAP); err != nil {
+		log.Fatalf("Failed to start LDAP role sync: %v", err)
+	}
+	StartLoginThrottleCleanup(&config.LoginThrottle)
+
+	// Load course catalog
+	InitCourseCatalog()
+	log.Printf("Loaded %d courses", len(courseCatalog.List()))
+	reloadCoursesOnSignal()
+
 	// Public routes
 	http.HandleFunc("/", helloWorld)
 	http.HandleFunc("/auth/login", loginHandler)
 	http.HandleFunc("/auth/logout", logoutHandler)
+	http.HandleFunc("POST /auth/refresh", refreshHandler)
+	http.HandleFunc("GET /.well-known/jwks.json", jwksHandler)
+	http.HandleFunc("GET /auth/oidc/providers", oidcProvidersHandler)
+	http.HandleFunc("GET /auth/oidc/{provider}/login", oidcLoginHandler)
+	http.HandleFunc("GET /auth/oidc/{provider}/callback", oidcCallbackHandler)
+	http.HandleFunc("POST /auth/register", registerHandler)
+	http.HandleFunc("POST /auth/verify-email", verifyEmailHandler)
+	http.HandleFunc("POST /auth/password/forgot", forgotPasswordHandler)
+	http.HandleFunc("POST /auth/password/reset", resetPasswordHandler)
+	http.HandleFunc("DELETE /auth/impersonation", endImpersonationHandler)
 
 	// Protected routes (require authentication)
 	http.HandleFunc("/auth/me", AuthMiddleware(getMeHandler))
-	http.HandleFunc("/courses", AuthMiddleware(getCoursesHandler))
-	http.HandleFunc("/run", AuthMiddleware(runCodeHandler))
-
-	// Task routes need to be registered before course routes due to path matching
-	http.HandleFunc("/courses/", AuthMiddleware(func(w http.ResponseWriter, r *http.Request) {
-		// Check if this is a task request
-		if len(r.URL.Path) > len("/courses/") {
-			remaining := r.URL.Path[len("/courses/"):]
-			for i := 0; i < len(remaining)-6; i++ {
-				if remaining[i:i+7] == "/tasks/" {
-					// Route based on HTTP method
-					if r.Method == http.MethodPost || r.Method == http.MethodOptions {
-						submitMCQHandler(w, r)
-					} else {
-						getTaskByIDHandler(w, r)
-					}
-					return
-				}
-			}
-		}
-		// Otherwise, it's a course request
-		getCourseByIDHandler(w, r)
-	}))
+	http.HandleFunc("POST /auth/logout-all", AuthMiddleware(RequireSession(logoutAllHandler)))
+	http.HandleFunc("POST /auth/password", AuthMiddleware(RequireSession(changePasswordHandler)))
+	http.HandleFunc("/courses", AuthMiddleware(RequireScope("courses", getCoursesHandler)))
+	http.HandleFunc("/run", AuthMiddleware(RequireScope("submissions", runCodeHandler)))
+
+	// Personal access tokens, managed from a session only
+	http.HandleFunc("GET /auth/tokens", AuthMiddleware(RequireSession(listTokensHandler)))
+	http.HandleFunc("POST /auth/tokens", AuthMiddleware(RequireSession(createTokenHandler)))
+	http.HandleFunc("DELETE /auth/tokens/{tokenID}", AuthMiddleware(RequireSession(deleteTokenHandler)))
+
+	// WebDAV access to course files (authenticates on its own, see webdav.go)
+	http.Handle(webdavPrefix, NewWebDAVService(courseCatalog))
+
+	// Course and task routes
+	http.HandleFunc("GET /courses/{courseID}", AuthMiddleware(RequireCoursePermission(PermViewCourse, getCourseByIDHandler)))
+	http.HandleFunc("GET /courses/{courseID}/tasks/{taskID}", AuthMiddleware(RequireCoursePermission(PermReadTasks, getTaskByIDHandler)))
+	http.HandleFunc("GET /courses/{courseID}/syllabus/chapters/{path...}", AuthMiddleware(RequireCoursePermission(PermReadTasks, getSyllabusChapterHandler)))
+	http.HandleFunc("GET /courses/{courseID}/syllabus/assets/{path...}", AuthMiddleware(RequireCoursePermission(PermReadTasks, getSyllabusAssetHandler)))
+	http.HandleFunc("GET /courses/{courseID}/search", AuthMiddleware(RequireCoursePermission(PermReadTasks, searchCourseHandler)))
+	http.HandleFunc("POST /courses/{courseID}/register", AuthMiddleware(RequireCoursePermission(PermViewCourse, registerCourseHandler)))
+	http.HandleFunc("POST /courses/{courseID}/unregister", AuthMiddleware(RequireCoursePermission(PermViewCourse, unregisterCourseHandler)))
+	http.HandleFunc("POST /courses/{courseID}/tasks/{taskID}", AuthMiddleware(RequireCoursePermission(PermSubmit, submitMCQHandler)))
+	http.HandleFunc("OPTIONS /courses/{courseID}/tasks/{taskID}", AuthMiddleware(RequireCoursePermission(PermSubmit, submitMCQHandler)))
+	http.HandleFunc("GET /courses/{courseID}/tasks/{taskID}/submissions", AuthMiddleware(RequireCoursePermission(PermSubmit, listSubmissionsHandler)))
+
+	// Group routes
+	http.HandleFunc("GET /courses/{courseID}/groups", AuthMiddleware(RequireCoursePermission(PermSubmit, listGroupsHandler)))
+	http.HandleFunc("POST /courses/{courseID}/groups", AuthMiddleware(RequireCoursePermission(PermManageGroups, createGroupHandler)))
+	http.HandleFunc("PUT /courses/{courseID}/groups/{groupID}", AuthMiddleware(RequireCoursePermission(PermManageGroups, updateGroupHandler)))
+	http.HandleFunc("DELETE /courses/{courseID}/groups/{groupID}", AuthMiddleware(RequireCoursePermission(PermManageGroups, deleteGroupHandler)))
+	http.HandleFunc("POST /courses/{courseID}/groups/{groupID}/join", AuthMiddleware(RequireCoursePermission(PermSubmit, joinGroupHandler)))
+	http.HandleFunc("POST /courses/{courseID}/groups/leave", AuthMiddleware(RequireCoursePermission(PermSubmit, leaveGroupHandler)))
+
+	// Task authoring routes
+	http.HandleFunc("POST /courses/{courseID}/tasks", AuthMiddleware(RequireCoursePermission(PermEditTask, createTaskHandler)))
+	http.HandleFunc("GET /courses/{courseID}/tasks/{taskID}/source", AuthMiddleware(RequireCoursePermission(PermEditTask, getTaskSourceHandler)))
+	http.HandleFunc("PUT /courses/{courseID}/tasks/{taskID}", AuthMiddleware(RequireCoursePermission(PermEditTask, updateTaskHandler)))
+	http.HandleFunc("DELETE /courses/{courseID}/tasks/{taskID}", AuthMiddleware(RequireCoursePermission(PermEditTask, deleteTaskHandler)))
+	http.HandleFunc("POST /courses/{courseID}/tasks/{taskID}/problems", AuthMiddleware(RequireCoursePermission(PermEditTask, createProblemHandler)))
+	http.HandleFunc("PUT /courses/{courseID}/tasks/{taskID}/problems/{problemID}", AuthMiddleware(RequireCoursePermission(PermEditTask, updateProblemHandler)))
+	http.HandleFunc("DELETE /courses/{courseID}/tasks/{taskID}/problems/{problemID}", AuthMiddleware(RequireCoursePermission(PermEditTask, deleteProblemHandler)))
+
+	// Course archives
+	http.HandleFunc("POST /courses/import", AuthMiddleware(RequireScope("courses", importCourseHandler)))
+	http.HandleFunc("GET /courses/{courseID}/export", AuthMiddleware(RequireCoursePermission(PermManageCourse, exportCourseHandler)))
+
+	// Course admins see the course as a student, read-only and audited
+	http.HandleFunc("POST /courses/{courseID}/students/{userID}/impersonate", AuthMiddleware(RequireSession(RequireCoursePermission(PermManageCourse, startImpersonationHandler))))
+	http.HandleFunc("GET /courses/{courseID}/impersonations", AuthMiddleware(RequireSession(RequireCoursePermission(PermManageCourse, listImpersonationLogHandler))))
+
+	// Platform administration routes
+	http.HandleFunc("GET /admin/users", AuthMiddleware(RequirePlatformAdmin(adminListUsersHandler)))
+	http.HandleFunc("POST /admin/users", AuthMiddleware(RequirePlatformAdmin(adminCreateUserHandler)))
+	http.HandleFunc("POST /admin/users/import", AuthMiddleware(RequirePlatformAdmin(adminImportUsersHandler)))
+	http.HandleFunc("POST /admin/users/provision-ldap", AuthMiddleware(RequirePlatformAdmin(adminProvisionLDAPHandler)))
+	http.HandleFunc("PATCH /admin/users/{userID}", AuthMiddleware(RequirePlatformAdmin(adminUpdateUserHandler)))
+	http.HandleFunc("POST /admin/users/{userID}/unlock", AuthMiddleware(RequirePlatformAdmin(adminUnlockUserHandler)))
+	http.HandleFunc("GET /admin/courses", AuthMiddleware(RequirePlatformAdmin(adminListCoursesHandler)))
 
 	port := ":8080"
 	fmt.Printf("Server starting on port %s\n", port)
 	log.Fatal(http.ListenAndServe(port, nil))
 }
 
+// reloadCoursesOnSignal reloads the course catalog on SIGHUP, e.g. after
+// courses were imported with the command line tool
+func reloadCoursesOnSignal() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	go func() {
+		for range signals {
+			if err := courseCatalog.Load(); err != nil {
+				log.Printf("Some courses failed to reload: %v", err)
+			}
+			log.Printf("Reloaded %d courses", len(courseCatalog.List()))
+		}
+	}()
+}
+
 func helloWorld(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprintf(w, "IronSnake API is running!")
 }
@@ -23,26 +23,24 @@ func AuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
 			return
 		}
 
-		// Validate token
-		claims, err := jwtService.ValidateToken(tokenString)
+		// Validate the session or personal access token, then load the user
+		user, scopes, session, err := authenticateBearer(tokenString)
 		if err != nil {
-			log.Printf("Failed to validate token: %v", err)
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
-			return
-		}
-
-		// Load user from database
-		user, err := GetUserByID(claims.UserID.String())
-		if err != nil {
-			log.Printf("Failed to load user: %v", err)
+			log.Printf("Failed to authenticate token: %v", err)
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
 
 		// Add user to request context
 		ctx := context.WithValue(r.Context(), UserContextKey, user)
+		ctx = withTokenScopes(ctx, scopes)
 		r = r.WithContext(ctx)
 
+		if isImpersonation(session) {
+			serveImpersonated(w, r, session, next)
+			return
+		}
+
 		// Call next handler
 		next(w, r)
 	}
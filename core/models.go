@@ -15,10 +15,79 @@ type User struct {
 	LastName     string    `gorm:"type:varchar(255)"`
 	AuthProvider string    `gorm:"type:varchar(50);default:'local'"`
 	LDAPEnabled  bool      `gorm:"default:false"`
+	OIDCSubject  string    `gorm:"type:varchar(255);index"` // Subject at the OIDC provider of AuthProvider
+	IsAdmin      bool      `gorm:"default:false"`           // Platform administrator
+	LDAPAdmin    bool      `gorm:"default:false"`           // Platform administrator through an LDAP group mapping
+	Disabled     bool      `gorm:"default:false"`           // Disabled users cannot log in
+	Unverified   bool      `gorm:"default:false"`           // Self-registered, cannot log in until the email is verified
 	CreatedAt    time.Time `gorm:"type:timestamp;default:now()"`
 	Tasks        []Task    `gorm:"foreignKey:UserID"`
 }
 
+// Session is a login of a user on a device. Its short-lived access tokens
+// are renewed with a refresh token, rotated on each use, until the session
+// expires or is revoked.
+type Session struct {
+	ID                uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	UserID            uuid.UUID  `gorm:"type:uuid;not null;index"`
+	User              User       `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
+	RefreshTokenHash  string     `gorm:"type:varchar(64);not null;uniqueIndex"` // SHA-256 of the current refresh token
+	PreviousTokenHash string     `gorm:"type:varchar(64);index"`                // Refresh token replaced by the current one, to detect reuse
+	UserAgent         string     `gorm:"type:varchar(255)"`
+	ExpiresAt         time.Time  `gorm:"type:timestamp;not null"`
+	RevokedAt         *time.Time `gorm:"type:timestamp"`
+	LastUsedAt        time.Time  `gorm:"type:timestamp;default:now()"`
+	CreatedAt         time.Time  `gorm:"type:timestamp;default:now()"`
+
+	// Impersonations are read-only sessions of a student opened by an
+	// admin of one of their courses, see impersonation.go
+	ImpersonatorID     *uuid.UUID `gorm:"type:uuid;index"`
+	Impersonator       *User      `gorm:"foreignKey:ImpersonatorID;constraint:OnDelete:CASCADE"`
+	ImpersonatedCourse string     `gorm:"type:varchar(255)"`
+}
+
+// ImpersonationLog records a request made while impersonating a student,
+// including the start and end of the impersonation and refused requests
+type ImpersonationLog struct {
+	ID             uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	SessionID      uuid.UUID `gorm:"type:uuid;not null;index"`
+	ImpersonatorID uuid.UUID `gorm:"type:uuid;not null;index"`
+	UserID         uuid.UUID `gorm:"type:uuid;not null"` // Impersonated student
+	CourseID       string    `gorm:"type:varchar(255);not null;index"`
+	Method         string    `gorm:"type:varchar(16);not null"`
+	Path           string    `gorm:"type:varchar(2048);not null"`
+	Status         int       `gorm:"not null"`
+	CreatedAt      time.Time `gorm:"type:timestamp;default:now()"`
+}
+
+// PersonalAccessToken is a named, scoped and expiring API token of a user,
+// for scripts and command line clients. Only its hash is stored.
+type PersonalAccessToken struct {
+	ID         uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	UserID     uuid.UUID  `gorm:"type:uuid;not null;index"`
+	User       User       `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
+	Name       string     `gorm:"type:varchar(100);not null"`
+	TokenHash  string     `gorm:"type:varchar(64);not null;uniqueIndex"` // SHA-256 of the token
+	Prefix     string     `gorm:"type:varchar(20);not null"`             // Start of the token, to recognize it
+	Scopes     string     `gorm:"type:text;not null"`                    // Space separated
+	ExpiresAt  time.Time  `gorm:"type:timestamp;not null"`
+	LastUsedAt *time.Time `gorm:"type:timestamp"`
+	CreatedAt  time.Time  `gorm:"type:timestamp;default:now()"`
+}
+
+// UserToken is a single use token sent by email to verify an address or
+// reset a password. Only its hash is stored.
+type UserToken struct {
+	ID        uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	UserID    uuid.UUID  `gorm:"type:uuid;not null;index"`
+	User      User       `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
+	Purpose   string     `gorm:"type:varchar(50);not null"`             // verify_email or reset_password
+	TokenHash string     `gorm:"type:varchar(64);not null;uniqueIndex"` // SHA-256 of the token
+	ExpiresAt time.Time  `gorm:"type:timestamp;not null"`
+	UsedAt    *time.Time `gorm:"type:timestamp"`
+	CreatedAt time.Time  `gorm:"type:timestamp;default:now()"`
+}
+
 type Task struct {
 	ID        uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
 	UserID    uuid.UUID `gorm:"type:uuid;not null"`
@@ -50,3 +119,65 @@ type Role struct {
 	ID   uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
 	Name string    `gorm:"type:varchar(255);not null;unique"`
 }
+
+// Enrollment registers a user as a student of a course of the catalog
+type Enrollment struct {
+	UserID    uuid.UUID `gorm:"type:uuid;not null;primaryKey"`
+	CourseID  string    `gorm:"type:varchar(255);not null;primaryKey"`
+	User      User      `gorm:"foreignKey:UserID"`
+	Source    string    `gorm:"type:varchar(50);not null;default:'self'"` // self, import or ldap
+	CreatedAt time.Time `gorm:"type:timestamp;default:now()"`
+}
+
+// CourseStaff gives a user a staff role in a course of the catalog outside
+// of the course configuration. It is maintained by the LDAP group mappings.
+type CourseStaff struct {
+	UserID    uuid.UUID `gorm:"type:uuid;not null;primaryKey"`
+	CourseID  string    `gorm:"type:varchar(255);not null;primaryKey"`
+	Role      string    `gorm:"type:varchar(50);not null"` // tutor or admin
+	Source    string    `gorm:"type:varchar(50);not null;default:'ldap'"`
+	CreatedAt time.Time `gorm:"type:timestamp;default:now()"`
+}
+
+// Group is a team of students of a course of the catalog
+type Group struct {
+	ID        uuid.UUID     `gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	CourseID  string        `gorm:"type:varchar(255);not null;index"`
+	Name      string        `gorm:"type:varchar(255);not null"`
+	Size      int           `gorm:"not null"` // Maximum number of members
+	Members   []GroupMember `gorm:"foreignKey:GroupID;constraint:OnDelete:CASCADE"`
+	Tutors    []GroupTutor  `gorm:"foreignKey:GroupID;constraint:OnDelete:CASCADE"`
+	CreatedAt time.Time     `gorm:"type:timestamp;default:now()"`
+}
+
+// GroupMember puts a student in a group. A student is in at most one group
+// per course.
+type GroupMember struct {
+	GroupID  uuid.UUID `gorm:"type:uuid;not null;primaryKey"`
+	UserID   uuid.UUID `gorm:"type:uuid;not null;primaryKey;uniqueIndex:idx_group_member_course_user,priority:2"`
+	CourseID string    `gorm:"type:varchar(255);not null;uniqueIndex:idx_group_member_course_user,priority:1"`
+	User     User      `gorm:"foreignKey:UserID"`
+}
+
+// GroupTutor assigns a course tutor to a group
+type GroupTutor struct {
+	GroupID uuid.UUID `gorm:"type:uuid;not null;primaryKey"`
+	UserID  uuid.UUID `gorm:"type:uuid;not null;primaryKey"`
+	User    User      `gorm:"foreignKey:UserID"`
+}
+
+// Submission is an answer to a task. Submissions to group tasks belong to
+// the group of the submitter and are shared by all its members.
+type Submission struct {
+	ID        uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	CourseID  string     `gorm:"type:varchar(255);not null;index:idx_submission_task,priority:1"`
+	TaskID    string     `gorm:"type:varchar(255);not null;index:idx_submission_task,priority:2"`
+	UserID    uuid.UUID  `gorm:"type:uuid;not null;index"`
+	User      User       `gorm:"foreignKey:UserID"`
+	GroupID   *uuid.UUID `gorm:"type:uuid;index"`
+	Answers   string     `gorm:"type:text"` // JSON encoded answers
+	Score     float64    `gorm:"not null"`
+	Correct   int        `gorm:"not null"`
+	Total     int        `gorm:"not null"`
+	CreatedAt time.Time  `gorm:"type:timestamp;default:now()"`
+}
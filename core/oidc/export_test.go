@@ -0,0 +1,8 @@
+package oidc
+
+import "time"
+
+// SetJWKSRefreshInterval changes how often unknown keys trigger a fetch
+func SetJWKSRefreshInterval(d time.Duration) {
+	jwksRefreshInterval = d
+}
@@ -0,0 +1,76 @@
+package oidc_test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+
+	"ironsnake/core/oidc"
+)
+
+func TestJSONWebKeyRoundTrip(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edPublic, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for alg, public := range map[string]crypto.PublicKey{
+		"RS256": &rsaKey.PublicKey,
+		"ES256": &ecKey.PublicKey,
+		"EdDSA": edPublic,
+	} {
+		t.Run(alg, func(t *testing.T) {
+			jwk, err := oidc.NewJSONWebKey(public, "key-1", alg)
+			if err != nil {
+				t.Fatalf("NewJSONWebKey failed: %v", err)
+			}
+			decoded, err := jwk.PublicKey()
+			if err != nil {
+				t.Fatalf("PublicKey failed: %v", err)
+			}
+			if !decoded.(interface{ Equal(crypto.PublicKey) bool }).Equal(public) {
+				t.Error("decoded key differs from the original key")
+			}
+
+			// The thumbprint depends on the key only
+			other, _ := oidc.NewJSONWebKey(public, "key-2", "")
+			first, err := jwk.Thumbprint()
+			if err != nil {
+				t.Fatalf("Thumbprint failed: %v", err)
+			}
+			if second, _ := other.Thumbprint(); first != second {
+				t.Errorf("thumbprints differ: %s and %s", first, second)
+			}
+		})
+	}
+}
+
+func TestThumbprint(t *testing.T) {
+	// Example of RFC 7638, section 3.1
+	jwk := oidc.JSONWebKey{
+		Kty: "RSA",
+		N:   "0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw",
+		E:   "AQAB",
+		Kid: "2011-04-29",
+		Alg: "RS256",
+	}
+	thumbprint, err := jwk.Thumbprint()
+	if err != nil {
+		t.Fatalf("Thumbprint failed: %v", err)
+	}
+	if want := "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs"; thumbprint != want {
+		t.Errorf("thumbprint = %s, want %s", thumbprint, want)
+	}
+}
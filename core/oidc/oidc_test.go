@@ -0,0 +1,208 @@
+package oidc_test
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"ironsnake/core/oidc"
+	"ironsnake/core/oidc/oidctest"
+)
+
+const redirectURL = "http://app.test/auth/oidc/mock/callback"
+
+func newProvider(t *testing.T, issuer *oidctest.Issuer, secret string) *oidc.Provider {
+	t.Helper()
+	provider, err := oidc.NewProvider(oidc.Config{
+		Issuer:       issuer.URL,
+		ClientID:     issuer.ClientID,
+		ClientSecret: secret,
+		RedirectURL:  redirectURL,
+		Scopes:       []string{"openid", "email", "profile"},
+	}, issuer.Client())
+	if err != nil {
+		t.Fatalf("failed to create provider: %v", err)
+	}
+	return provider
+}
+
+// login follows the authorization URL and returns the code and state the
+// issuer redirects back with
+func login(t *testing.T, issuer *oidctest.Issuer, provider *oidc.Provider, state, nonce, verifier string) (code, returnedState string) {
+	t.Helper()
+	authURL, err := provider.AuthCodeURL(context.Background(), state, nonce, verifier)
+	if err != nil {
+		t.Fatalf("failed to build authorization URL: %v", err)
+	}
+	if !strings.HasPrefix(authURL, issuer.URL+"/authorize?") {
+		t.Fatalf("unexpected authorization URL %s", authURL)
+	}
+
+	client := issuer.Client()
+	client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	resp, err := client.Get(authURL)
+	if err != nil {
+		t.Fatalf("authorization request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("expected a redirect, got %s", resp.Status)
+	}
+
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatalf("invalid redirect: %v", err)
+	}
+	if got := location.Scheme + "://" + location.Host + location.Path; got != redirectURL {
+		t.Fatalf("redirected to %s, expected %s", got, redirectURL)
+	}
+	return location.Query().Get("code"), location.Query().Get("state")
+}
+
+func TestAuthorizationCodeFlow(t *testing.T) {
+	issuer := oidctest.NewIssuer("ironsnake", "secret")
+	defer issuer.Close()
+	issuer.SetClaims(map[string]any{"sub": "42", "email": "alice@school.test", "preferred_username": "alice"})
+	provider := newProvider(t, issuer, "secret")
+
+	state, nonce, verifier := oidc.RandomString(), oidc.RandomString(), oidc.RandomString()
+	code, returnedState := login(t, issuer, provider, state, nonce, verifier)
+	if returnedState != state {
+		t.Errorf("expected state %q, got %q", state, returnedState)
+	}
+
+	claims, err := provider.Exchange(context.Background(), code, verifier, nonce)
+	if err != nil {
+		t.Fatalf("exchange failed: %v", err)
+	}
+	if claims.Subject() != "42" || claims.String("email") != "alice@school.test" || claims.String("preferred_username") != "alice" {
+		t.Errorf("unexpected claims %v", claims)
+	}
+
+	// Codes are single use
+	if _, err := provider.Exchange(context.Background(), code, verifier, nonce); err == nil {
+		t.Error("expected a redeemed code to be refused")
+	}
+}
+
+func TestExchangeFailures(t *testing.T) {
+	issuer := oidctest.NewIssuer("ironsnake", "secret")
+	defer issuer.Close()
+
+	tests := []struct {
+		name   string
+		secret string
+		mutate func(verifier, nonce string) (string, string)
+	}{
+		{"wrong verifier", "secret", func(verifier, nonce string) (string, string) { return verifier + "x", nonce }},
+		{"wrong nonce", "secret", func(verifier, nonce string) (string, string) { return verifier, nonce + "x" }},
+		{"wrong client secret", "guess", func(verifier, nonce string) (string, string) { return verifier, nonce }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := newProvider(t, issuer, tt.secret)
+			nonce, verifier := oidc.RandomString(), oidc.RandomString()
+			code, _ := login(t, issuer, provider, "state", nonce, verifier)
+
+			verifier, nonce = tt.mutate(verifier, nonce)
+			if _, err := provider.Exchange(context.Background(), code, verifier, nonce); err == nil {
+				t.Error("expected the exchange to fail")
+			}
+		})
+	}
+}
+
+func TestVerify(t *testing.T) {
+	issuer := oidctest.NewIssuer("ironsnake", "secret")
+	defer issuer.Close()
+	provider := newProvider(t, issuer, "secret")
+
+	now := time.Now()
+	valid := func() map[string]any {
+		return map[string]any{
+			"iss":   issuer.URL,
+			"aud":   "ironsnake",
+			"sub":   "42",
+			"nonce": "n",
+			"iat":   now.Unix(),
+			"exp":   now.Add(time.Minute).Unix(),
+		}
+	}
+	with := func(name string, value any) map[string]any {
+		claims := valid()
+		if value == nil {
+			delete(claims, name)
+		} else {
+			claims[name] = value
+		}
+		return claims
+	}
+
+	tests := []struct {
+		name   string
+		claims map[string]any
+		ok     bool
+	}{
+		{"valid", valid(), true},
+		{"expired", with("exp", now.Add(-time.Hour).Unix()), false},
+		{"no expiry", with("exp", nil), false},
+		{"other issuer", with("iss", "https://evil.test"), false},
+		{"other audience", with("aud", "other"), false},
+		{"several audiences", with("aud", []string{"ironsnake", "other"}), false},
+		{"several audiences with azp", func() map[string]any {
+			claims := with("aud", []string{"ironsnake", "other"})
+			claims["azp"] = "ironsnake"
+			return claims
+		}(), true},
+		{"other nonce", with("nonce", "m"), false},
+		{"no nonce", with("nonce", nil), false},
+		{"no subject", with("sub", nil), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := provider.Verify(context.Background(), issuer.SignIDToken(tt.claims), "n")
+			if tt.ok && err != nil {
+				t.Errorf("expected a valid token, got %v", err)
+			}
+			if !tt.ok && err == nil {
+				t.Error("expected an invalid token")
+			}
+		})
+	}
+
+	t.Run("HMAC", func(t *testing.T) {
+		token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims(valid())).SignedString([]byte("secret"))
+		if _, err := provider.Verify(context.Background(), token, "n"); err == nil {
+			t.Error("expected HMAC tokens to be refused")
+		}
+	})
+	t.Run("none", func(t *testing.T) {
+		token, _ := jwt.NewWithClaims(jwt.SigningMethodNone, jwt.MapClaims(valid())).SignedString(jwt.UnsafeAllowNoneSignatureType)
+		if _, err := provider.Verify(context.Background(), token, "n"); err == nil {
+			t.Error("expected unsigned tokens to be refused")
+		}
+	})
+}
+
+func TestKeyRotation(t *testing.T) {
+	oidc.SetJWKSRefreshInterval(0)
+	defer oidc.SetJWKSRefreshInterval(time.Minute)
+
+	issuer := oidctest.NewIssuer("ironsnake", "secret")
+	defer issuer.Close()
+	provider := newProvider(t, issuer, "secret")
+
+	for i := 0; i < 2; i++ {
+		nonce, verifier := oidc.RandomString(), oidc.RandomString()
+		code, _ := login(t, issuer, provider, "state", nonce, verifier)
+		if _, err := provider.Exchange(context.Background(), code, verifier, nonce); err != nil {
+			t.Fatalf("exchange %d failed: %v", i+1, err)
+		}
+		issuer.RotateKey()
+	}
+}
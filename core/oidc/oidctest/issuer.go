@@ -0,0 +1,218 @@
+// Package oidctest provides a local OpenID provider to test relying parties
+// without a real identity server.
+package oidctest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"ironsnake/core/oidc"
+)
+
+// Issuer is a local OpenID provider serving discovery, keys, authorization
+// and token endpoints. Its authorization endpoint logs in the user of
+// SetClaims without asking anything and redirects back with a code.
+type Issuer struct {
+	*httptest.Server
+
+	ClientID     string
+	ClientSecret string
+
+	mu      sync.Mutex
+	claims  map[string]any // Claims of the user that logs in
+	key     *rsa.PrivateKey
+	kid     string
+	retired []oidc.JSONWebKey // Rotated keys still published
+	codes   map[string]authRequest
+}
+
+// authRequest is an authorization code waiting to be redeemed
+type authRequest struct {
+	clientID    string
+	redirectURI string
+	nonce       string
+	challenge   string
+}
+
+// NewIssuer starts an issuer for one client. Close it when done.
+func NewIssuer(clientID, clientSecret string) *Issuer {
+	issuer := &Issuer{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		claims:       map[string]any{"sub": "user-1"},
+		codes:        make(map[string]authRequest),
+	}
+	issuer.RotateKey()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", issuer.discovery)
+	mux.HandleFunc("GET /jwks", issuer.jwks)
+	mux.HandleFunc("GET /authorize", issuer.authorize)
+	mux.HandleFunc("POST /token", issuer.token)
+	issuer.Server = httptest.NewServer(mux)
+	return issuer
+}
+
+// SetClaims sets the claims of the user that logs in next, such as sub,
+// email or preferred_username
+func (i *Issuer) SetClaims(claims map[string]any) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.claims = maps.Clone(claims)
+}
+
+// RotateKey signs the next tokens with a new key. The previous keys are
+// still published, as providers do during rotations.
+func (i *Issuer) RotateKey() {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.key != nil {
+		jwk, _ := oidc.NewJSONWebKey(&i.key.PublicKey, i.kid, "RS256")
+		i.retired = append(i.retired, jwk)
+	}
+	i.key = key
+	i.kid = oidc.RandomString()[:8]
+}
+
+// SignIDToken signs arbitrary claims with the current key, to test the
+// verification of invalid tokens
+func (i *Issuer) SignIDToken(claims map[string]any) string {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.sign(claims)
+}
+
+func (i *Issuer) sign(claims map[string]any) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims(claims))
+	token.Header["kid"] = i.kid
+	signed, err := token.SignedString(i.key)
+	if err != nil {
+		panic(err)
+	}
+	return signed
+}
+
+func (i *Issuer) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"issuer":                                i.URL,
+		"authorization_endpoint":                i.URL + "/authorize",
+		"token_endpoint":                        i.URL + "/token",
+		"jwks_uri":                              i.URL + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+func (i *Issuer) jwks(w http.ResponseWriter, r *http.Request) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	current, _ := oidc.NewJSONWebKey(&i.key.PublicKey, i.kid, "RS256")
+	writeJSON(w, http.StatusOK, oidc.JSONWebKeySet{Keys: append([]oidc.JSONWebKey{current}, i.retired...)})
+}
+
+func (i *Issuer) authorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	redirectURI, err := url.Parse(query.Get("redirect_uri"))
+	if err != nil || query.Get("redirect_uri") == "" {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+	if query.Get("client_id") != i.ClientID || query.Get("response_type") != "code" {
+		http.Error(w, "invalid client or response type", http.StatusBadRequest)
+		return
+	}
+	if query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" {
+		http.Error(w, "PKCE with S256 is required", http.StatusBadRequest)
+		return
+	}
+
+	code := oidc.RandomString()
+	i.mu.Lock()
+	i.codes[code] = authRequest{
+		clientID:    i.ClientID,
+		redirectURI: query.Get("redirect_uri"),
+		nonce:       query.Get("nonce"),
+		challenge:   query.Get("code_challenge"),
+	}
+	i.mu.Unlock()
+
+	params := redirectURI.Query()
+	params.Set("code", code)
+	params.Set("state", query.Get("state"))
+	redirectURI.RawQuery = params.Encode()
+	http.Redirect(w, r, redirectURI.String(), http.StatusFound)
+}
+
+func (i *Issuer) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	clientID, clientSecret, ok := r.BasicAuth()
+	if !ok {
+		clientID, clientSecret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	if clientID != i.ClientID || clientSecret != i.ClientSecret {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	code := r.PostForm.Get("code")
+	request, ok := i.codes[code]
+	delete(i.codes, code) // Codes are single use
+	if !ok || r.PostForm.Get("grant_type") != "authorization_code" || r.PostForm.Get("redirect_uri") != request.redirectURI {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if base64.RawURLEncoding.EncodeToString(sum[:]) != request.challenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant", "error_description": "PKCE verification failed"})
+		return
+	}
+
+	now := time.Now()
+	claims := maps.Clone(i.claims)
+	claims["iss"] = i.URL
+	claims["aud"] = request.clientID
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(5 * time.Minute).Unix()
+	if request.nonce != "" {
+		claims["nonce"] = request.nonce
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"access_token": oidc.RandomString(),
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"id_token":     i.sign(claims),
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,324 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
+	"ironsnake/core/oidc"
+)
+
+// oidcLoginTimeout is how long a user has to log in at the provider
+const oidcLoginTimeout = 10 * time.Minute
+
+// oidcStateCookie binds a pending login to the browser that started it
+const oidcStateCookie = "oidc_state"
+
+// oidcProvider is a configured OpenID Connect provider
+type oidcProvider struct {
+	config   OIDCProviderConfig
+	provider *oidc.Provider
+}
+
+// authProvider is the AuthProvider of the users of the provider
+func (p *oidcProvider) authProvider() string {
+	return "oidc:" + p.config.ID
+}
+
+// oidcLogin is a login started at a provider and not completed yet
+type oidcLogin struct {
+	providerID string
+	nonce      string
+	verifier   string
+	redirect   string // Path of the frontend to return to
+	expires    time.Time
+}
+
+var (
+	oidcProviders = map[string]*oidcProvider{}
+
+	oidcLoginsMu sync.Mutex
+	oidcLogins   = map[string]oidcLogin{} // By state
+)
+
+// InitOIDCProviders sets up the configured OpenID Connect providers. Their
+// configuration is only discovered on the first login.
+func InitOIDCProviders(configs []OIDCProviderConfig) error {
+	for _, config := range configs {
+		provider, err := oidc.NewProvider(oidc.Config{
+			Issuer:       config.Issuer,
+			ClientID:     config.ClientID,
+			ClientSecret: config.ClientSecret,
+			RedirectURL:  config.RedirectURL,
+			Scopes:       config.Scopes,
+		}, nil)
+		if err != nil {
+			return fmt.Errorf("OIDC provider %s: %w", config.ID, err)
+		}
+		oidcProviders[config.ID] = &oidcProvider{config: config, provider: provider}
+	}
+	return nil
+}
+
+// storeOIDCLogin keeps a pending login, dropping the expired ones
+func storeOIDCLogin(state string, login oidcLogin) {
+	oidcLoginsMu.Lock()
+	defer oidcLoginsMu.Unlock()
+
+	now := time.Now()
+	for s, l := range oidcLogins {
+		if now.After(l.expires) {
+			delete(oidcLogins, s)
+		}
+	}
+	oidcLogins[state] = login
+}
+
+// takeOIDCLogin returns and forgets a pending login, so that a state can be
+// used only once
+func takeOIDCLogin(state string) (oidcLogin, bool) {
+	oidcLoginsMu.Lock()
+	defer oidcLoginsMu.Unlock()
+
+	login, ok := oidcLogins[state]
+	delete(oidcLogins, state)
+	if !ok || time.Now().After(login.expires) {
+		return oidcLogin{}, false
+	}
+	return login, true
+}
+
+// safeRedirect returns path if it is a local path of the frontend, "/"
+// otherwise, so that logins cannot redirect to other sites. Browsers drop
+// control characters from URLs, which would turn "/\t/host" into "//host".
+func safeRedirect(path string) string {
+	if !strings.HasPrefix(path, "/") || strings.HasPrefix(path, "//") || strings.HasPrefix(path, "/\\") {
+		return "/"
+	}
+	if strings.ContainsFunc(path, func(r rune) bool { return r < 0x20 || r == 0x7f }) {
+		return "/"
+	}
+	return path
+}
+
+// oidcProvidersHandler lists the providers users can log in with
+func oidcProvidersHandler(w http.ResponseWriter, r *http.Request) {
+	response := make([]OIDCProviderResponse, 0, len(oidcProviders))
+	for _, config := range GetConfig().OIDCProviders {
+		response = append(response, OIDCProviderResponse{
+			ID:       config.ID,
+			Name:     config.Name,
+			LoginURL: GetConfig().APIBasePath + "/auth/oidc/" + config.ID + "/login",
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+// oidcLoginHandler redirects the browser to the provider to log in. The
+// optional ?redirect= path is where the frontend resumes afterwards.
+func oidcLoginHandler(w http.ResponseWriter, r *http.Request) {
+	p, ok := oidcProviders[r.PathValue("provider")]
+	if !ok {
+		http.Error(w, "Unknown login provider", http.StatusNotFound)
+		return
+	}
+
+	state, nonce, verifier := oidc.RandomString(), oidc.RandomString(), oidc.RandomString()
+	authURL, err := p.provider.AuthCodeURL(r.Context(), state, nonce, verifier)
+	if err != nil {
+		log.Printf("OIDC provider %s unavailable: %v", p.config.ID, err)
+		http.Error(w, "Login provider unavailable", http.StatusBadGateway)
+		return
+	}
+
+	storeOIDCLogin(state, oidcLogin{
+		providerID: p.config.ID,
+		nonce:      nonce,
+		verifier:   verifier,
+		redirect:   safeRedirect(r.URL.Query().Get("redirect")),
+		expires:    time.Now().Add(oidcLoginTimeout),
+	})
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     "/",
+		MaxAge:   int(oidcLoginTimeout.Seconds()),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode, // Sent on the redirect back from the provider
+	})
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// oidcCallbackHandler completes a login: it redeems the code, provisions the
+// user and sets the auth token cookie before returning to the frontend
+func oidcCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	p, ok := oidcProviders[r.PathValue("provider")]
+	if !ok {
+		http.Error(w, "Unknown login provider", http.StatusNotFound)
+		return
+	}
+
+	query := r.URL.Query()
+	if errorCode := query.Get("error"); errorCode != "" {
+		log.Printf("OIDC login at %s failed: %s: %s", p.config.ID, errorCode, query.Get("error_description"))
+		http.Error(w, "Login failed at the provider", http.StatusUnauthorized)
+		return
+	}
+
+	state := query.Get("state")
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil || state == "" || cookie.Value != state {
+		http.Error(w, "Invalid login state, please try again", http.StatusBadRequest)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: oidcStateCookie, Path: "/", MaxAge: -1, HttpOnly: true})
+
+	login, ok := takeOIDCLogin(state)
+	if !ok || login.providerID != p.config.ID {
+		http.Error(w, "Login expired, please try again", http.StatusBadRequest)
+		return
+	}
+
+	claims, err := p.provider.Exchange(r.Context(), query.Get("code"), login.verifier, login.nonce)
+	if err != nil {
+		log.Printf("OIDC login at %s failed: %v", p.config.ID, err)
+		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+		return
+	}
+
+	user, err := SyncUserFromOIDC(p, claims)
+	if errors.Is(err, errEmailNotVerified) {
+		log.Printf("OIDC login at %s of %s refused: %v", p.config.ID, claims.Subject(), err)
+		http.Error(w, "Verify your email address at the login provider first", http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		log.Printf("OIDC login at %s of %s failed: %v", p.config.ID, claims.Subject(), err)
+		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+		return
+	}
+	if user.Disabled {
+		log.Printf("OIDC login of disabled user %s refused", user.Username)
+		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+		return
+	}
+
+	if _, err := StartSession(w, r, user); err != nil {
+		log.Printf("Failed to start session: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, login.redirect, http.StatusFound)
+}
+
+// oidcUsername returns the username of an account of a provider. Providers
+// choose their usernames freely, so they are suffixed with the provider ID:
+// course roles and PLATFORM_ADMINS name users by username, and a partner's
+// user must not get the roles of a local teacher who shares their name.
+func oidcUsername(p *oidcProvider, name string) string {
+	return name + "@" + p.config.ID
+}
+
+// errEmailNotVerified is returned when the provider has not verified the
+// email of a user
+var errEmailNotVerified = errors.New("email not verified by the provider")
+
+// oidcEmail returns the email of an ID token. Unless the provider is trusted
+// with unverified emails, it must be verified: accounts are identified by
+// email elsewhere, for password resets for instance.
+func oidcEmail(p *oidcProvider, claims oidc.Claims) (string, error) {
+	email := claims.String(p.config.EmailClaim)
+	if email == "" {
+		return "", fmt.Errorf("claim %q is missing", p.config.EmailClaim)
+	}
+	if !p.config.TrustUnverifiedEmail && !claims.Bool("email_verified") {
+		return "", fmt.Errorf("%w: %s", errEmailNotVerified, email)
+	}
+	return email, nil
+}
+
+// SyncUserFromOIDC creates or updates the user of a verified ID token. Users
+// are matched by provider and subject, never by username, so that accounts
+// of other providers cannot be taken over.
+func SyncUserFromOIDC(p *oidcProvider, claims oidc.Claims) (*User, error) {
+	email, err := oidcEmail(p, claims)
+	if err != nil {
+		return nil, err
+	}
+	firstName := claims.String(p.config.FirstNameClaim)
+	lastName := claims.String(p.config.LastNameClaim)
+
+	var user User
+	err = DB.Where("auth_provider = ? AND oidc_subject = ?", p.authProvider(), claims.Subject()).First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		name := claims.String(p.config.UsernameClaim)
+		if name == "" {
+			return nil, fmt.Errorf("claim %q is missing", p.config.UsernameClaim)
+		}
+		username := oidcUsername(p, name)
+		if len(username) > 255 {
+			return nil, fmt.Errorf("claim %q is too long", p.config.UsernameClaim)
+		}
+
+		var taken int64
+		if err := DB.Model(&User{}).Where("username = ? OR email = ?", username, email).Count(&taken).Error; err != nil {
+			return nil, err
+		}
+		if taken > 0 {
+			return nil, fmt.Errorf("username %s or email %s is already used by another account", username, email)
+		}
+
+		user = User{
+			Username:     username,
+			Email:        email,
+			FirstName:    firstName,
+			LastName:     lastName,
+			AuthProvider: p.authProvider(),
+			OIDCSubject:  claims.Subject(),
+		}
+		if err := DB.Create(&user).Error; err != nil {
+			return nil, fmt.Errorf("failed to create user: %w", err)
+		}
+
+		log.Printf("Created new OIDC user: %s (%s) from %s", user.Username, user.Email, p.config.ID)
+		return &user, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// User exists, update with the claims of the provider. An email taken
+	// by another account since is not copied, the unique index would refuse
+	// the whole update.
+	if email != user.Email {
+		var taken int64
+		if err := DB.Model(&User{}).Where("LOWER(email) = LOWER(?) AND id <> ?", email, user.ID).Count(&taken).Error; err != nil {
+			return nil, err
+		}
+		if taken > 0 {
+			log.Printf("OIDC user %s keeps email %s: %s is used by another account", user.Username, user.Email, email)
+		} else {
+			user.Email = email
+		}
+	}
+	if firstName != "" || lastName != "" {
+		user.FirstName = firstName
+		user.LastName = lastName
+	}
+	if err := DB.Save(&user).Error; err != nil {
+		return nil, fmt.Errorf("failed to update user: %w", err)
+	}
+	return &user, nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"ironsnake/core/oidc"
+)
+
+func TestSafeRedirect(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"", "/"},
+		{"/", "/"},
+		{"/courses/algo", "/courses/algo"},
+		{"/courses/algo?tab=tasks#task01", "/courses/algo?tab=tasks#task01"},
+		{"/search?q=%2F%2Fexample.com", "/search?q=%2F%2Fexample.com"},
+
+		// Other sites
+		{"https://evil.example", "/"},
+		{"//evil.example", "/"},
+		{"//evil.example/courses", "/"},
+		{"/\\evil.example", "/"},
+		{"javascript:alert(1)", "/"},
+		{"courses/algo", "/"},
+
+		// Control characters that browsers drop
+		{"/\t/evil.example", "/"},
+		{"/\n/evil.example", "/"},
+		{"/\r/evil.example", "/"},
+		{"/courses\x00", "/"},
+		{"/courses\x7f", "/"},
+	}
+	for _, tt := range tests {
+		if got := safeRedirect(tt.path); got != tt.want {
+			t.Errorf("safeRedirect(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestOIDCEmail(t *testing.T) {
+	strict := &oidcProvider{config: OIDCProviderConfig{ID: "partner", EmailClaim: "email"}}
+	trusting := &oidcProvider{config: OIDCProviderConfig{ID: "partner", EmailClaim: "email", TrustUnverifiedEmail: true}}
+
+	tests := []struct {
+		name       string
+		provider   *oidcProvider
+		claims     oidc.Claims
+		wantErr    bool
+		unverified bool
+	}{
+		{"verified", strict, oidc.Claims{"email": "jdoe@example.com", "email_verified": true}, false, false},
+		{"verified as a string", strict, oidc.Claims{"email": "jdoe@example.com", "email_verified": "true"}, false, false},
+		{"unverified", strict, oidc.Claims{"email": "jdoe@example.com", "email_verified": false}, true, true},
+		{"verification missing", strict, oidc.Claims{"email": "jdoe@example.com"}, true, true},
+		{"email missing", strict, oidc.Claims{"email_verified": true}, true, false},
+		{"unverified, trusted provider", trusting, oidc.Claims{"email": "jdoe@example.com"}, false, false},
+	}
+	for _, tt := range tests {
+		email, err := oidcEmail(tt.provider, tt.claims)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: oidcEmail() error = %v, want error %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if errors.Is(err, errEmailNotVerified) != tt.unverified {
+			t.Errorf("%s: oidcEmail() error = %v, want errEmailNotVerified %v", tt.name, err, tt.unverified)
+		}
+		if err == nil && email != "jdoe@example.com" {
+			t.Errorf("%s: oidcEmail() = %q", tt.name, email)
+		}
+	}
+}
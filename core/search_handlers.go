@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"ironsnake/core/courseparser"
+)
+
+// Search result limits
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+)
+
+// searchHitLink returns the API path of the resource a hit was found in
+func searchHitLink(courseID string, hit courseparser.SearchHit) string {
+	base := "/courses/" + url.PathEscape(courseID)
+	switch hit.Kind {
+	case courseparser.SearchChapter:
+		parts := strings.Split(hit.ChapterPath, "/")
+		for i, part := range parts {
+			parts[i] = url.PathEscape(part)
+		}
+		link := base + "/syllabus/chapters/" + strings.Join(parts, "/")
+		if hit.Anchor != "" {
+			link += "#" + hit.Anchor
+		}
+		return link
+	case courseparser.SearchProblem:
+		return base + "/tasks/" + url.PathEscape(hit.TaskID) + "#" + url.PathEscape(hit.ProblemID)
+	}
+	return base + "/tasks/" + url.PathEscape(hit.TaskID)
+}
+
+// searchCourseHandler searches the syllabus, tasks and problems of a course.
+// Students only find tasks that are currently accessible.
+func searchCourseHandler(w http.ResponseWriter, r *http.Request, cc *CourseContext) {
+	courseID := cc.Course.CourseID
+
+	index, ok := courseCatalog.Index(courseID)
+	if !ok {
+		http.Error(w, "Course not found", http.StatusNotFound)
+		return
+	}
+
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query == "" {
+		http.Error(w, "Query parameter q is required", http.StatusBadRequest)
+		return
+	}
+
+	limit := defaultSearchLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		var err error
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		if limit > maxSearchLimit {
+			limit = maxSearchLimit
+		}
+	}
+
+	var visible func(taskID string) bool
+	if !cc.Staff() {
+		now := time.Now()
+		visible = func(taskID string) bool {
+			return cc.CanSeeTask(taskID, now)
+		}
+	}
+
+	hits := index.Search(query, limit, visible)
+	response := SearchResponse{
+		Query: query,
+		Hits:  make([]SearchHitResponse, len(hits)),
+	}
+	for i, hit := range hits {
+		response.Hits[i] = SearchHitResponse{
+			Kind:        string(hit.Kind),
+			Title:       hit.Title,
+			TaskID:      hit.TaskID,
+			ProblemID:   hit.ProblemID,
+			ChapterPath: hit.ChapterPath,
+			Anchor:      hit.Anchor,
+			Link:        searchHitLink(courseID, hit),
+			Snippet:     hit.Snippet,
+			Score:       hit.Score,
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		log.Printf("Error encoding response: %v", err)
+	}
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// refreshReuseGrace is how long the refresh token replaced by a rotation is
+// still refused without revoking the session. Tabs refreshing at the same
+// time present the same token; only the first one rotates it.
+const refreshReuseGrace = 10 * time.Second
+
+var (
+	// ErrSessionRevoked is returned for tokens of sessions that were revoked
+	// or expired
+	ErrSessionRevoked = errors.New("session revoked or expired")
+
+	// ErrRefreshTokenReused is returned when a refresh token replaced by a
+	// rotation is presented again, which means it was stolen. The session is
+	// revoked.
+	ErrRefreshTokenReused = errors.New("refresh token reused")
+
+	// errRefreshTokenRotated is returned for a refresh token replaced within
+	// refreshReuseGrace. The cookies hold the new one already.
+	errRefreshTokenRotated = errors.New("refresh token just rotated")
+)
+
+// RefreshRequest represents the request body of /auth/refresh for clients
+// that do not use cookies
+type RefreshRequest struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+// hashToken returns the SHA-256 of a refresh token, as stored in sessions.
+// Refresh tokens are random, so they need no salt nor slow hash.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// randomToken returns a random URL-safe token, for refresh and access tokens
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// sessionExpiry returns the expiry of a session refreshed now
+func sessionExpiry() time.Time {
+	return time.Now().Add(time.Duration(GetConfig().JWT.ExpirationHours) * time.Hour)
+}
+
+// StartSession opens a session for a user who just logged in, sets the access
+// and refresh token cookies and returns the login response
+func StartSession(w http.ResponseWriter, r *http.Request, user *User) (*LoginResponse, error) {
+	refreshToken, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	session := Session{
+		UserID:           user.ID,
+		RefreshTokenHash: hashToken(refreshToken),
+		UserAgent:        truncate(r.UserAgent(), 255),
+		ExpiresAt:        sessionExpiry(),
+		LastUsedAt:       now,
+		CreatedAt:        now,
+	}
+	if err := DB.Create(&session).Error; err != nil {
+		return nil, fmt.Errorf("failed to create session: %w", err)
+	}
+
+	// Forget the ended sessions of the user
+	if err := DB.Where("user_id = ? AND (expires_at < ? OR revoked_at IS NOT NULL)", user.ID, now).Delete(&Session{}).Error; err != nil {
+		log.Printf("Failed to delete ended sessions of %s: %v", user.Username, err)
+	}
+
+	return issueTokens(w, user, session.ID, refreshToken)
+}
+
+// issueTokens generates an access token for a session and sets the cookies
+func issueTokens(w http.ResponseWriter, user *User, sessionID uuid.UUID, refreshToken string) (*LoginResponse, error) {
+	token, err := jwtService.GenerateToken(user, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Set secure cookies (use Secure=true in production with HTTPS)
+	jwtService.SetTokenCookie(w, token, false)
+	jwtService.SetRefreshTokenCookie(w, refreshToken, false)
+
+	return &LoginResponse{
+		User:         userResponse(user),
+		Token:        token,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(GetConfig().JWT.AccessTokenTTL.Seconds()),
+	}, nil
+}
+
+// rotateRefreshToken redeems a refresh token: it replaces it by a new one
+// and extends the session. The session is revoked if the token was already
+// replaced.
+func rotateRefreshToken(refreshToken string) (*Session, string, error) {
+	newToken, err := randomToken()
+	if err != nil {
+		return nil, "", err
+	}
+
+	hash := hashToken(refreshToken)
+	var session Session
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Preload("User").
+			Where("refresh_token_hash = ? OR previous_token_hash = ?", hash, hash).
+			First(&session).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrSessionRevoked
+		}
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		if err := checkRefreshToken(&session, hash, now); err != nil {
+			return err
+		}
+
+		return tx.Model(&session).Updates(map[string]interface{}{
+			"refresh_token_hash":  hashToken(newToken),
+			"previous_token_hash": hash,
+			"expires_at":          sessionExpiry(),
+			"last_used_at":        now,
+		}).Error
+	})
+	if errors.Is(err, ErrRefreshTokenReused) {
+		log.Printf("Refresh token of session %s of %s reused, revoking the session", session.ID, session.User.Username)
+		if err := RevokeSession(session.ID); err != nil {
+			log.Printf("Failed to revoke session %s: %v", session.ID, err)
+		}
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return &session, newToken, nil
+}
+
+// checkRefreshToken reports whether the refresh token with the given hash
+// may rotate a session at a given time. A replaced token presented again
+// within refreshReuseGrace is refused without revoking the session.
+func checkRefreshToken(session *Session, hash string, now time.Time) error {
+	if session.RevokedAt != nil || now.After(session.ExpiresAt) || session.User.Disabled {
+		return ErrSessionRevoked
+	}
+	if session.RefreshTokenHash != hash {
+		if now.Sub(session.LastUsedAt) < refreshReuseGrace {
+			return errRefreshTokenRotated
+		}
+		return ErrRefreshTokenReused
+	}
+	return nil
+}
+
+// authenticateToken validates an access token and returns its user and
+// session. The session of the token must still be active, so that revoked
+// sessions and disabled users lose access without waiting for the token to
+// expire.
+func authenticateToken(tokenString string) (*User, *Session, error) {
+	claims, err := jwtService.ValidateToken(tokenString)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var session Session
+	err = DB.Preload("User").Preload("Impersonator").
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL AND expires_at > ?", claims.SessionID, claims.UserID, time.Now()).
+		First(&session).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil, ErrSessionRevoked
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if session.User.Disabled || (session.Impersonator != nil && session.Impersonator.Disabled) {
+		return nil, nil, ErrUserDisabled
+	}
+	return &session.User, &session, nil
+}
+
+// RevokeSession ends a session; its access tokens are refused from now on
+func RevokeSession(sessionID uuid.UUID) error {
+	return DB.Model(&Session{}).
+		Where("id = ? AND revoked_at IS NULL", sessionID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// RevokeUserSessions ends all the sessions of a user, including the
+// impersonations they opened, and returns how many were active
+func RevokeUserSessions(userID uuid.UUID) (int64, error) {
+	result := DB.Model(&Session{}).
+		Where("(user_id = ? OR impersonator_id = ?) AND revoked_at IS NULL AND expires_at > ?", userID, userID, time.Now()).
+		Update("revoked_at", time.Now())
+	return result.RowsAffected, result.Error
+}
+
+// refreshHandler renews the access token of a session with its refresh
+// token, taken from its cookie or from the request body
+func refreshHandler(w http.ResponseWriter, r *http.Request) {
+	refreshToken, err := jwtService.ExtractRefreshToken(r)
+	if err != nil {
+		var request RefreshRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.RefreshToken == "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		refreshToken = request.RefreshToken
+	}
+
+	session, newToken, err := rotateRefreshToken(refreshToken)
+	if errors.Is(err, errRefreshTokenRotated) {
+		// Another request refreshed the session concurrently, keep its cookies
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		if !errors.Is(err, ErrSessionRevoked) && !errors.Is(err, ErrRefreshTokenReused) {
+			log.Printf("Failed to refresh session: %v", err)
+		}
+		jwtService.ClearTokenCookie(w)
+		jwtService.ClearRefreshTokenCookie(w)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	response, err := issueTokens(w, &session.User, session.ID, newToken)
+	if err != nil {
+		log.Printf("Failed to generate token: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// logoutAllHandler revokes all the sessions of the current user, on every
+// device
+func logoutAllHandler(w http.ResponseWriter, r *http.Request) {
+	user, err := GetUserFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	revoked, err := RevokeUserSessions(user.ID)
+	if err != nil {
+		log.Printf("Failed to revoke sessions of %s: %v", user.Username, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("User %s logged out of %d sessions", user.Username, revoked)
+
+	jwtService.ClearTokenCookie(w)
+	jwtService.ClearRefreshTokenCookie(w)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"message": "Logged out everywhere", "sessions": revoked})
+}
+
+// truncate cuts s to at most n bytes, without splitting a character
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return strings.ToValidUTF8(s[:n], "")
+	}
+	return s
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestCheckRefreshToken(t *testing.T) {
+	now := time.Now()
+	current, previous := hashToken("current"), hashToken("previous")
+	active := Session{
+		RefreshTokenHash:  current,
+		PreviousTokenHash: previous,
+		ExpiresAt:         now.Add(time.Hour),
+		LastUsedAt:        now.Add(-time.Minute),
+	}
+
+	tests := []struct {
+		name   string
+		modify func(*Session)
+		hash   string
+		want   error
+	}{
+		{"current token", func(*Session) {}, current, nil},
+		{"previous token after the grace window", func(*Session) {}, previous, ErrRefreshTokenReused},
+		{"previous token within the grace window", func(s *Session) { s.LastUsedAt = now.Add(-2 * time.Second) }, previous, errRefreshTokenRotated},
+		{"previous token just after the grace window", func(s *Session) { s.LastUsedAt = now.Add(-refreshReuseGrace) }, previous, ErrRefreshTokenReused},
+		{"revoked session", func(s *Session) { s.RevokedAt = &now }, current, ErrSessionRevoked},
+		{"revoked session, previous token", func(s *Session) { s.RevokedAt = &now }, previous, ErrSessionRevoked},
+		{"expired session", func(s *Session) { s.ExpiresAt = now.Add(-time.Second) }, current, ErrSessionRevoked},
+		{"disabled user", func(s *Session) { s.User.Disabled = true }, current, ErrSessionRevoked},
+	}
+	for _, tt := range tests {
+		session := active
+		tt.modify(&session)
+		if err := checkRefreshToken(&session, tt.hash, now); !errors.Is(err, tt.want) {
+			t.Errorf("%s: checkRefreshToken() = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+// testDatabase connects DB to the PostgreSQL database of TEST_DATABASE_URL
+// for the duration of a test, which is skipped when it is not set
+func testDatabase(t *testing.T) {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := DB
+	DB = db
+	t.Cleanup(func() { DB = previous })
+	if err := RunMigrations(); err != nil {
+		t.Fatal(err)
+	}
+
+	previousConfig, previousService := config, jwtService
+	config = &Config{JWT: JWTConfig{Secret: "test secret", ExpirationHours: 1, AccessTokenTTL: time.Minute}}
+	jwtService, err = NewJWTService(&config.JWT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { config, jwtService = previousConfig, previousService })
+}
+
+// createTestUser creates a user deleted with their sessions after the test
+func createTestUser(t *testing.T) *User {
+	t.Helper()
+	name := "test-" + uuid.NewString()
+	user := &User{Username: name, Email: name + "@example.com"}
+	if err := DB.Create(user).Error; err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { DB.Delete(user) })
+	return user
+}
+
+// startTestSession opens a session of a user and returns its tokens
+func startTestSession(t *testing.T, user *User) *LoginResponse {
+	t.Helper()
+	response, err := StartSession(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/auth/login", nil), user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return response
+}
+
+func sessionRevoked(t *testing.T, refreshToken string) bool {
+	t.Helper()
+	var session Session
+	hash := hashToken(refreshToken)
+	if err := DB.Where("refresh_token_hash = ? OR previous_token_hash = ?", hash, hash).First(&session).Error; err != nil {
+		t.Fatal(err)
+	}
+	return session.RevokedAt != nil
+}
+
+func TestRotateRefreshTokenReuse(t *testing.T) {
+	testDatabase(t)
+	user := createTestUser(t)
+	first := startTestSession(t, user).RefreshToken
+
+	session, second, err := rotateRefreshToken(first)
+	if err != nil {
+		t.Fatalf("rotateRefreshToken() = %v", err)
+	}
+
+	// Another tab refreshing at the same time
+	if _, _, err := rotateRefreshToken(first); !errors.Is(err, errRefreshTokenRotated) {
+		t.Fatalf("reuse within the grace window = %v, want errRefreshTokenRotated", err)
+	}
+	if sessionRevoked(t, second) {
+		t.Fatal("reuse within the grace window revoked the session")
+	}
+
+	// A stolen token replayed later
+	lastUsed := time.Now().Add(-refreshReuseGrace - time.Second)
+	if err := DB.Model(session).Update("last_used_at", lastUsed).Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := rotateRefreshToken(first); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("reuse after the grace window = %v, want ErrRefreshTokenReused", err)
+	}
+	if !sessionRevoked(t, second) {
+		t.Fatal("reuse after the grace window did not revoke the session")
+	}
+	if _, _, err := rotateRefreshToken(second); !errors.Is(err, ErrSessionRevoked) {
+		t.Fatalf("rotateRefreshToken() of a revoked session = %v, want ErrSessionRevoked", err)
+	}
+}
+
+func TestAuthMiddlewareRejectsEndedSessions(t *testing.T) {
+	testDatabase(t)
+	handler := AuthMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	status := func(token string) int {
+		r := httptest.NewRequest(http.MethodGet, "/auth/me", nil)
+		r.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		handler(w, r)
+		return w.Code
+	}
+
+	user := createTestUser(t)
+	revoked := startTestSession(t, user)
+	disabled := startTestSession(t, user)
+	for _, login := range []*LoginResponse{revoked, disabled} {
+		if got := status(login.Token); got != http.StatusNoContent {
+			t.Fatalf("active session: status %d, want %d", got, http.StatusNoContent)
+		}
+	}
+
+	var session Session
+	if err := DB.Where("refresh_token_hash = ?", hashToken(revoked.RefreshToken)).First(&session).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := RevokeSession(session.ID); err != nil {
+		t.Fatal(err)
+	}
+	if got := status(revoked.Token); got != http.StatusUnauthorized {
+		t.Errorf("revoked session: status %d, want %d", got, http.StatusUnauthorized)
+	}
+	if got := status(disabled.Token); got != http.StatusNoContent {
+		t.Errorf("other session: status %d, want %d", got, http.StatusNoContent)
+	}
+
+	if err := DB.Model(user).Update("disabled", true).Error; err != nil {
+		t.Fatal(err)
+	}
+	if got := status(disabled.Token); got != http.StatusUnauthorized {
+		t.Errorf("disabled user: status %d, want %d", got, http.StatusUnauthorized)
+	}
+}
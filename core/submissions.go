@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// errNoGroup is returned when a student submits a group task without a group
+var errNoGroup = errors.New("this task is submitted as a group: join a group first")
+
+// isGroupTask reports whether a task is submitted once for a whole group
+func isGroupTask(cc *CourseContext, taskID string) bool {
+	return cc.Course.Access.DispenserData.Config[taskID].GroupSubmission
+}
+
+// submissionGroup returns the group a submission to a task belongs to: the
+// group of the student for group tasks, nil otherwise. Staff always submit
+// on their own.
+func submissionGroup(cc *CourseContext, taskID string) (*uuid.UUID, error) {
+	if !isGroupTask(cc, taskID) || cc.Staff() {
+		return nil, nil
+	}
+	groupID, err := GetUserGroupID(cc.Course.CourseID, cc.User.ID)
+	if err != nil {
+		return nil, err
+	}
+	if groupID == nil {
+		return nil, errNoGroup
+	}
+	return groupID, nil
+}
+
+// storeSubmission records a graded submission in the history of the user, or
+// of their group
+func storeSubmission(cc *CourseContext, taskID string, groupID *uuid.UUID, answers interface{}, result *MCQSubmissionResponse) error {
+	data, err := json.Marshal(answers)
+	if err != nil {
+		return fmt.Errorf("failed to encode answers: %w", err)
+	}
+
+	submission := Submission{
+		CourseID: cc.Course.CourseID,
+		TaskID:   taskID,
+		UserID:   cc.User.ID,
+		GroupID:  groupID,
+		Answers:  string(data),
+		Score:    result.Score,
+		Correct:  result.Correct,
+		Total:    result.Total,
+	}
+	if err := DB.Create(&submission).Error; err != nil {
+		return fmt.Errorf("failed to store submission: %w", err)
+	}
+	return nil
+}
+
+// submissionHistory returns the query selecting the submissions of the
+// current user to a task: those of their group for group tasks, their own
+// otherwise
+func submissionHistory(cc *CourseContext, taskID string) (*gorm.DB, error) {
+	query := DB.Preload("User").Where("course_id = ? AND task_id = ?", cc.Course.CourseID, taskID)
+	groupID, err := submissionGroup(cc, taskID)
+	switch {
+	case errors.Is(err, errNoGroup):
+		return query.Where("user_id = ?", cc.User.ID), nil
+	case err != nil:
+		return nil, err
+	case groupID != nil:
+		return query.Where("group_id = ?", *groupID), nil
+	}
+	return query.Where("user_id = ?", cc.User.ID), nil
+}
+
+// latestSubmission returns the newest submission of the current user to a
+// task, or nil if they have not submitted it yet
+func latestSubmission(cc *CourseContext, taskID string) (*SubmissionResponse, error) {
+	query, err := submissionHistory(cc, taskID)
+	if err != nil {
+		return nil, err
+	}
+	var submission Submission
+	err = query.Order("created_at DESC").First(&submission).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	response := submissionResponse(&submission)
+	return &response, nil
+}
+
+// submissionResponse converts a stored submission for the API
+func submissionResponse(submission *Submission) SubmissionResponse {
+	response := SubmissionResponse{
+		ID:        submission.ID.String(),
+		TaskID:    submission.TaskID,
+		Submitter: submission.User.Username,
+		Score:     submission.Score,
+		Correct:   submission.Correct,
+		Total:     submission.Total,
+		CreatedAt: submission.CreatedAt,
+	}
+	if submission.GroupID != nil {
+		response.GroupID = submission.GroupID.String()
+	}
+	return response
+}
+
+// listSubmissionsHandler returns the submission history of the current user
+// for a task, newest first. For group tasks, this is the history of the
+// user's group, whoever of its members submitted.
+func listSubmissionsHandler(w http.ResponseWriter, r *http.Request, cc *CourseContext) {
+	taskID := r.PathValue("taskID")
+	if _, ok := cc.Course.Tasks[taskID]; !ok {
+		http.Error(w, "Task not found", http.StatusNotFound)
+		return
+	}
+
+	query, err := submissionHistory(cc, taskID)
+	if err != nil {
+		log.Printf("Error listing submissions of %s: %v", cc.User.Username, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	var submissions []Submission
+	if err := query.Order("created_at DESC").Find(&submissions).Error; err != nil {
+		log.Printf("Error listing submissions of %s: %v", cc.User.Username, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	response := make([]SubmissionResponse, len(submissions))
+	for i, submission := range submissions {
+		response[i] = submissionResponse(&submission)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		log.Printf("Error encoding response: %v", err)
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"ironsnake/core/courseparser"
+)
+
+// Chapters change whenever a teacher edits them, so clients must revalidate;
+// assets are rarely replaced and may be cached for a while
+const (
+	chapterCacheControl = "private, no-cache"
+	assetCacheControl   = "private, max-age=3600"
+)
+
+// hasSyllabus reports whether the course has a syllabus. It writes the error
+// response otherwise.
+func hasSyllabus(w http.ResponseWriter, course *courseparser.ParsedCourse) bool {
+	if course.Syllabus == nil {
+		http.Error(w, "Course has no syllabus", http.StatusNotFound)
+		return false
+	}
+	return true
+}
+
+// syllabusAssetURL returns the public URL of a syllabus file
+func syllabusAssetURL(courseID, name string) string {
+	parts := strings.Split(name, "/")
+	for i, part := range parts {
+		parts[i] = url.PathEscape(part)
+	}
+	return GetConfig().APIBasePath + "/courses/" + url.PathEscape(courseID) + "/syllabus/assets/" + strings.Join(parts, "/")
+}
+
+// writeSyllabusError maps chapter and asset errors to HTTP responses. Paths
+// outside the syllabus are reported as missing so they cannot be probed.
+// Chapters that fail to preprocess or render are reported with the reason.
+func writeSyllabusError(w http.ResponseWriter, err error) {
+	var parseErr *courseparser.ParseError
+	switch {
+	case errors.As(err, &parseErr):
+		// Broken includes and the like, reported so teachers can fix them
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+	case errors.Is(err, os.ErrNotExist), errors.Is(err, courseparser.ErrPathOutsideRoot):
+		http.Error(w, "Not found", http.StatusNotFound)
+	default:
+		log.Printf("Error serving syllabus: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+// getSyllabusChapterHandler returns a chapter's Markdown and rendered HTML
+func getSyllabusChapterHandler(w http.ResponseWriter, r *http.Request, cc *CourseContext) {
+	course := cc.Course
+	if !hasSyllabus(w, course) {
+		return
+	}
+
+	chapter, err := course.Syllabus.Chapter(r.PathValue("path"), courseparser.RenderOptions{
+		AssetURL: func(name string) string {
+			return syllabusAssetURL(course.CourseID, name)
+		},
+		Tasks: course.Tasks,
+		TaskURL: func(taskID string) string {
+			return "/courses/" + url.PathEscape(course.CourseID) + "/tasks/" + url.PathEscape(taskID)
+		},
+		Runnable: isRunnableLanguage,
+	})
+	if err != nil {
+		writeSyllabusError(w, err)
+		return
+	}
+
+	response := ChapterResponse{
+		Path:     chapter.Path,
+		Title:    chapter.Title,
+		Markdown: chapter.Markdown,
+		HTML:     chapter.HTML,
+		Tasks:    make([]EmbeddedTaskResponse, 0, len(chapter.Tasks)),
+		Snippets: make([]SnippetResponse, len(chapter.Snippets)),
+	}
+
+	now := time.Now()
+	for _, taskID := range chapter.Tasks {
+		embedded, ok := embeddedTaskResponse(cc, taskID, now)
+		if !ok {
+			continue
+		}
+		if embedded.TaskResponse != nil {
+			embedded.LastSubmission, err = latestSubmission(cc, taskID)
+			if err != nil {
+				log.Printf("Error loading submissions of %s: %v", cc.User.Username, err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+		}
+		response.Tasks = append(response.Tasks, embedded)
+	}
+	for i, snippet := range chapter.Snippets {
+		response.Snippets[i] = SnippetResponse{Language: snippet.Language, Code: snippet.Code}
+	}
+
+	// The embedded tasks depend on the time and on the user's submissions,
+	// so the ETag covers the whole response rather than the chapter alone
+	body, err := json.Marshal(response)
+	if err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		log.Printf("Error encoding response: %v", err)
+		return
+	}
+	etag := computeETag(body)
+	w.Header().Set("Cache-Control", chapterCacheControl)
+	w.Header().Set("ETag", etag)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
+
+// embeddedTaskResponse describes a task embedded in a chapter. Tasks the user
+// may not see yet are reduced to their ID, status and deadline. It returns
+// false if the course has no such task.
+func embeddedTaskResponse(cc *CourseContext, taskID string, now time.Time) (EmbeddedTaskResponse, bool) {
+	task, ok := cc.Course.Tasks[taskID]
+	if !ok {
+		return EmbeddedTaskResponse{}, false
+	}
+	access := cc.Course.Access.DispenserData.Config[taskID].Accessibility
+	embedded := EmbeddedTaskResponse{
+		ID:     taskID,
+		Status: string(access.Status(now)),
+	}
+	if access.DateRange != nil {
+		embedded.Deadline = &access.DateRange.Deadline
+	}
+	if cc.CanSeeTask(taskID, now) {
+		response := taskResponse(cc.Course, taskID, &task, cc.Staff())
+		embedded.TaskResponse = &response
+	}
+	return embedded, true
+}
+
+// getSyllabusAssetHandler serves images and other files of the syllabus
+func getSyllabusAssetHandler(w http.ResponseWriter, r *http.Request, cc *CourseContext) {
+	course := cc.Course
+	if !hasSyllabus(w, course) {
+		return
+	}
+
+	path, err := course.Syllabus.ResolvePath(r.PathValue("path"))
+	if err != nil {
+		writeSyllabusError(w, err)
+		return
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		writeSyllabusError(w, err)
+		return
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		writeSyllabusError(w, err)
+		return
+	}
+	if info.IsDir() {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+
+	// Assets are served from the application origin: keep browsers from
+	// sniffing types or running scripts embedded in SVG or HTML files
+	w.Header().Set("Cache-Control", assetCacheControl)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; img-src 'self'; style-src 'unsafe-inline'; sandbox")
+	http.ServeContent(w, r, info.Name(), info.ModTime(), file)
+}
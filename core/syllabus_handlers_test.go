@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"ironsnake/core/courseparser"
+)
+
+func TestEmbeddedTaskResponse(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	upcoming := courseparser.TaskAccessibility{DateRange: &courseparser.AccessibilityDateRange{
+		Start:    now.Add(24 * time.Hour),
+		Deadline: now.Add(48 * time.Hour),
+	}}
+	course := &courseparser.ParsedCourse{
+		CourseID: "CS01",
+		Access: courseparser.AccessConfig{DispenserData: courseparser.DispenserData{
+			Config: map[string]courseparser.TaskAccessConfig{
+				"open":     {Accessibility: courseparser.TaskAccessibility{IsBoolean: true, BoolValue: true}},
+				"upcoming": {Accessibility: upcoming},
+			},
+		}},
+		Tasks: map[string]courseparser.TaskConfig{
+			"open":     {Name: "Open task"},
+			"upcoming": {Name: "Upcoming task"},
+			"closed":   {Name: "Closed task"},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		role    CourseRole
+		taskID  string
+		visible bool
+		status  string
+	}{
+		{"student, open task", RoleStudent, "open", true, "open"},
+		{"student, upcoming task", RoleStudent, "upcoming", false, "upcoming"},
+		{"student, closed task", RoleStudent, "closed", false, "closed"},
+		{"tutor, upcoming task", RoleTutor, "upcoming", true, "upcoming"},
+		{"admin, closed task", RoleAdmin, "closed", true, "closed"},
+	}
+	for _, tt := range tests {
+		cc := &CourseContext{Course: course, Role: tt.role, Access: CourseMember}
+		got, ok := embeddedTaskResponse(cc, tt.taskID, now)
+		if !ok {
+			t.Fatalf("%s: task not found", tt.name)
+		}
+		if got.ID != tt.taskID || got.Status != tt.status {
+			t.Errorf("%s: got %s %s, want %s %s", tt.name, got.ID, got.Status, tt.taskID, tt.status)
+		}
+		if visible := got.TaskResponse != nil; visible != tt.visible {
+			t.Errorf("%s: task details shown = %v, want %v", tt.name, visible, tt.visible)
+		}
+	}
+
+	if _, ok := embeddedTaskResponse(&CourseContext{Course: course, Role: RoleStudent}, "missing", now); ok {
+		t.Error("embeddedTaskResponse() found a missing task")
+	}
+}
+
+func TestHiddenEmbeddedTaskJSON(t *testing.T) {
+	deadline := time.Date(2026, 3, 3, 12, 0, 0, 0, time.UTC)
+	data, err := json.Marshal(EmbeddedTaskResponse{ID: "task01", Status: "upcoming", Deadline: &deadline})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"id":"task01","status":"upcoming","deadline":"2026-03-03T12:00:00Z"}`
+	if string(data) != want {
+		t.Errorf("json = %s, want %s", data, want)
+	}
+
+	data, err = json.Marshal(EmbeddedTaskResponse{
+		TaskResponse: &TaskResponse{ID: "task01", Name: "Task"},
+		ID:           "task01",
+		Status:       "open",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(data, &fields); err != nil {
+		t.Fatal(err)
+	}
+	if fields["id"] != "task01" || fields["name"] != "Task" {
+		t.Errorf("json = %s, want the task details", data)
+	}
+}
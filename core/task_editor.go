@@ -0,0 +1,556 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"ironsnake/core/courseparser"
+)
+
+// courseEditLocks serializes task writes per course so that the ETag check
+// and the write happen atomically with respect to other API edits
+var courseEditLocks sync.Map // Course ID -> *sync.Mutex
+
+func courseEditLock(courseID string) *sync.Mutex {
+	lock, _ := courseEditLocks.LoadOrStore(courseID, &sync.Mutex{})
+	return lock.(*sync.Mutex)
+}
+
+// taskFilePath returns the task.yaml path of a task
+func taskFilePath(course *courseparser.ParsedCourse, taskID string) string {
+	return filepath.Join(course.DirPath, taskFileName(taskID))
+}
+
+// taskFileName returns the task.yaml path relative to the course directory,
+// used in error messages so that server paths are not exposed
+func taskFileName(taskID string) string {
+	return filepath.Join("tasks", taskID, "task.yaml")
+}
+
+// readTaskFile reads and parses a task.yaml from disk, returning its ETag
+func readTaskFile(course *courseparser.ParsedCourse, taskID string) (*courseparser.TaskConfig, string, error) {
+	path := taskFilePath(course, taskID)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, "", err
+	}
+
+	task, err := courseparser.ParseTaskConfigData(taskFileName(taskID), data)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return task, computeETag(data), nil
+}
+
+// writeTaskFile validates a task and atomically replaces its task.yaml. The
+// course is reloaded afterwards and the ETag of the new content is returned.
+func writeTaskFile(course *courseparser.ParsedCourse, taskID string, task *courseparser.TaskConfig) (string, error) {
+	path := taskFilePath(course, taskID)
+	name := taskFileName(taskID)
+
+	if err := task.Validate(name); err != nil {
+		return "", err
+	}
+	if err := course.Config.ValidateTaskTags(name, task); err != nil {
+		return "", err
+	}
+
+	// Keep comments and formatting of the current file
+	original, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+
+	data, err := courseparser.UpdateTaskConfig(original, task)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode task: %w", err)
+	}
+
+	// Make sure what we write is what the loader will read back
+	if _, err := courseparser.ParseTaskConfigData(name, data); err != nil {
+		return "", err
+	}
+
+	if err := courseparser.WriteFileAtomic(path, data, 0644); err != nil {
+		return "", fmt.Errorf("failed to write task: %w", err)
+	}
+
+	if err := courseCatalog.Reload(course.CourseID); err != nil {
+		log.Printf("Failed to reload course %s after editing task %s: %v", course.CourseID, taskID, err)
+	}
+
+	return computeETag(data), nil
+}
+
+// computeETag returns a strong ETag for file content
+func computeETag(data []byte) string {
+	sum := sha256.Sum256(data)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// checkIfMatch enforces optimistic concurrency: modifications must send the
+// ETag they last read in If-Match. It writes the error response and returns
+// false when the precondition fails.
+func checkIfMatch(w http.ResponseWriter, r *http.Request, etag string) bool {
+	ifMatch := strings.Join(r.Header.Values("If-Match"), ",")
+	if strings.TrimSpace(ifMatch) == "" {
+		http.Error(w, "If-Match header is required", http.StatusPreconditionRequired)
+		return false
+	}
+	if !etagListMatches(ifMatch, etag) {
+		w.Header().Set("ETag", etag)
+		http.Error(w, "Task was modified by someone else", http.StatusPreconditionFailed)
+		return false
+	}
+	return true
+}
+
+// etagListMatches reports whether an If-Match value, "*" or a comma-separated
+// list of entity tags (RFC 9110), contains etag. Weak tags match too: proxies
+// weaken the ETag of the responses they compress, and task files are only
+// ever compared as a whole.
+func etagListMatches(list, etag string) bool {
+	if strings.TrimSpace(list) == "*" {
+		return true
+	}
+	for {
+		list = strings.TrimLeft(list, " \t,")
+		if list == "" {
+			return false
+		}
+		list = strings.TrimPrefix(list, "W/")
+		if !strings.HasPrefix(list, `"`) {
+			return false
+		}
+		end := strings.IndexByte(list[1:], '"')
+		if end < 0 {
+			return false
+		}
+		if list[:end+2] == etag {
+			return true
+		}
+		list = list[end+2:]
+	}
+}
+
+// writeEditError maps task loading and validation errors to HTTP responses
+func writeEditError(w http.ResponseWriter, err error) {
+	var parseErr *courseparser.ParseError
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		http.Error(w, "Task not found", http.StatusNotFound)
+	case errors.As(err, &parseErr):
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+	default:
+		log.Printf("Error editing task: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+// writeTaskSource writes a task as JSON together with its ETag
+func writeTaskSource(w http.ResponseWriter, status int, taskID string, task *courseparser.TaskConfig, etag string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", etag)
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(taskSourceFromConfig(taskID, task)); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+// getTaskSourceHandler returns the editable content of a task, answers included
+func getTaskSourceHandler(w http.ResponseWriter, r *http.Request, cc *CourseContext) {
+	course := cc.Course
+
+	taskID := r.PathValue("taskID")
+	if !courseparser.ValidID(taskID) {
+		http.Error(w, "Task not found", http.StatusNotFound)
+		return
+	}
+
+	task, etag, err := readTaskFile(course, taskID)
+	if err != nil {
+		writeEditError(w, err)
+		return
+	}
+
+	writeTaskSource(w, http.StatusOK, taskID, task, etag)
+}
+
+// createTaskHandler creates a new task directory with its task.yaml
+func createTaskHandler(w http.ResponseWriter, r *http.Request, cc *CourseContext) {
+	course := cc.Course
+
+	var source TaskSource
+	if err := json.NewDecoder(r.Body).Decode(&source); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if !courseparser.ValidID(source.ID) {
+		http.Error(w, "Invalid task ID", http.StatusBadRequest)
+		return
+	}
+
+	task, err := source.toConfig(nil)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	lock := courseEditLock(course.CourseID)
+	lock.Lock()
+	defer lock.Unlock()
+
+	taskDir := filepath.Dir(taskFilePath(course, source.ID))
+	if _, err := os.Stat(taskDir); err == nil {
+		http.Error(w, "Task already exists", http.StatusConflict)
+		return
+	}
+	if err := os.MkdirAll(taskDir, 0755); err != nil {
+		writeEditError(w, err)
+		return
+	}
+
+	etag, err := writeTaskFile(course, source.ID, task)
+	if err != nil {
+		os.RemoveAll(taskDir)
+		writeEditError(w, err)
+		return
+	}
+
+	log.Printf("Task %s created in course %s", source.ID, course.CourseID)
+	writeTaskSource(w, http.StatusCreated, source.ID, task, etag)
+}
+
+// updateTaskHandler replaces the content of a task
+func updateTaskHandler(w http.ResponseWriter, r *http.Request, cc *CourseContext) {
+	course := cc.Course
+
+	taskID := r.PathValue("taskID")
+	if !courseparser.ValidID(taskID) {
+		http.Error(w, "Task not found", http.StatusNotFound)
+		return
+	}
+
+	var source TaskSource
+	if err := json.NewDecoder(r.Body).Decode(&source); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if source.ID != "" && source.ID != taskID {
+		http.Error(w, "Task ID cannot be changed", http.StatusBadRequest)
+		return
+	}
+
+	lock := courseEditLock(course.CourseID)
+	lock.Lock()
+	defer lock.Unlock()
+
+	current, etag, err := readTaskFile(course, taskID)
+	if err != nil {
+		writeEditError(w, err)
+		return
+	}
+	if !checkIfMatch(w, r, etag) {
+		return
+	}
+
+	task, err := source.toConfig(current)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	etag, err = writeTaskFile(course, taskID, task)
+	if err != nil {
+		writeEditError(w, err)
+		return
+	}
+
+	writeTaskSource(w, http.StatusOK, taskID, task, etag)
+}
+
+// deleteTaskHandler removes a task directory
+func deleteTaskHandler(w http.ResponseWriter, r *http.Request, cc *CourseContext) {
+	course := cc.Course
+
+	taskID := r.PathValue("taskID")
+	if !courseparser.ValidID(taskID) {
+		http.Error(w, "Task not found", http.StatusNotFound)
+		return
+	}
+
+	lock := courseEditLock(course.CourseID)
+	lock.Lock()
+	defer lock.Unlock()
+
+	_, etag, err := readTaskFile(course, taskID)
+	if err != nil {
+		writeEditError(w, err)
+		return
+	}
+	if !checkIfMatch(w, r, etag) {
+		return
+	}
+
+	if err := os.RemoveAll(filepath.Dir(taskFilePath(course, taskID))); err != nil {
+		writeEditError(w, err)
+		return
+	}
+
+	if err := courseCatalog.Reload(course.CourseID); err != nil {
+		log.Printf("Failed to reload course %s after deleting task %s: %v", course.CourseID, taskID, err)
+	}
+
+	log.Printf("Task %s deleted from course %s", taskID, course.CourseID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// createProblemHandler appends a problem to a task
+func createProblemHandler(w http.ResponseWriter, r *http.Request, cc *CourseContext) {
+	editProblem(w, r, cc, func(task *courseparser.TaskConfig, source *ProblemSource) (int, error) {
+		if !courseparser.ValidID(source.ID) {
+			return http.StatusBadRequest, fmt.Errorf("invalid problem ID")
+		}
+		if _, exists := task.Problems.Get(source.ID); exists {
+			return http.StatusConflict, fmt.Errorf("problem %s already exists", source.ID)
+		}
+
+		problem, err := source.toProblem()
+		if err != nil {
+			return http.StatusUnprocessableEntity, err
+		}
+		task.Problems.Set(source.ID, problem)
+		return http.StatusCreated, nil
+	})
+}
+
+// updateProblemHandler replaces a problem of a task, keeping its position
+func updateProblemHandler(w http.ResponseWriter, r *http.Request, cc *CourseContext) {
+	editProblem(w, r, cc, func(task *courseparser.TaskConfig, source *ProblemSource) (int, error) {
+		problemID := r.PathValue("problemID")
+		if source.ID != "" && source.ID != problemID {
+			return http.StatusBadRequest, fmt.Errorf("problem ID cannot be changed")
+		}
+		if _, exists := task.Problems.Get(problemID); !exists {
+			return http.StatusNotFound, fmt.Errorf("problem not found")
+		}
+
+		problem, err := source.toProblem()
+		if err != nil {
+			return http.StatusUnprocessableEntity, err
+		}
+		task.Problems.Set(problemID, problem)
+		return http.StatusOK, nil
+	})
+}
+
+// deleteProblemHandler removes a problem from a task
+func deleteProblemHandler(w http.ResponseWriter, r *http.Request, cc *CourseContext) {
+	editProblem(w, r, cc, func(task *courseparser.TaskConfig, _ *ProblemSource) (int, error) {
+		if !task.Problems.Delete(r.PathValue("problemID")) {
+			return http.StatusNotFound, fmt.Errorf("problem not found")
+		}
+		return http.StatusOK, nil
+	})
+}
+
+// editProblem runs a problem modification on the current task.yaml: it checks
+// the ETag, applies edit and writes the task back. The body is only decoded
+// for POST and PUT requests.
+func editProblem(w http.ResponseWriter, r *http.Request, cc *CourseContext, edit func(*courseparser.TaskConfig, *ProblemSource) (int, error)) {
+	course := cc.Course
+
+	taskID := r.PathValue("taskID")
+	if !courseparser.ValidID(taskID) {
+		http.Error(w, "Task not found", http.StatusNotFound)
+		return
+	}
+
+	var source ProblemSource
+	if r.Method == http.MethodPost || r.Method == http.MethodPut {
+		if err := json.NewDecoder(r.Body).Decode(&source); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+
+	lock := courseEditLock(course.CourseID)
+	lock.Lock()
+	defer lock.Unlock()
+
+	task, etag, err := readTaskFile(course, taskID)
+	if err != nil {
+		writeEditError(w, err)
+		return
+	}
+	if !checkIfMatch(w, r, etag) {
+		return
+	}
+
+	status, err := edit(task, &source)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	etag, err = writeTaskFile(course, taskID, task)
+	if err != nil {
+		writeEditError(w, err)
+		return
+	}
+
+	writeTaskSource(w, status, taskID, task, etag)
+}
+
+// taskSourceFromConfig converts a parsed task into its editable representation
+func taskSourceFromConfig(taskID string, task *courseparser.TaskConfig) TaskSource {
+	source := TaskSource{
+		ID:                    taskID,
+		Name:                  task.Name,
+		Author:                task.Author,
+		ContactURL:            task.ContactURL,
+		Context:               task.Context,
+		EnvironmentID:         task.EnvironmentID,
+		EnvironmentType:       task.EnvironmentType,
+		RunCmd:                task.EnvironmentParameters.RunCmd,
+		File:                  task.File,
+		NetworkGrading:        task.NetworkGrading,
+		InputRandom:           task.InputRandom,
+		RegenerateInputRandom: task.RegenerateInputRandom,
+		Tags:                  task.Categories,
+		Problems:              make([]ProblemSource, 0, task.Problems.Len()),
+	}
+
+	if limits := task.EnvironmentParameters.Limits; limits != nil {
+		source.Limits = &EnvironmentLimits{
+			Time:     limits.Time,
+			HardTime: limits.HardTime,
+			Memory:   limits.Memory,
+		}
+	}
+
+	for _, op := range task.Problems.Problems {
+		ps := ProblemSource{
+			ID:     op.ID,
+			Type:   op.Problem.GetType(),
+			Name:   op.Problem.GetName(),
+			Header: op.Problem.GetHeader(),
+		}
+
+		switch p := op.Problem.(type) {
+		case *courseparser.CodeProblem:
+			ps.Language = p.Language
+			ps.Default = p.Default
+		case *courseparser.MultipleChoiceProblem:
+			ps.Choices = make([]ChoiceSource, len(p.Choices))
+			for i, c := range p.Choices {
+				ps.Choices[i] = ChoiceSource{Text: c.Text, Valid: c.Valid}
+			}
+			ps.Limit = p.Limit
+		case *courseparser.MatchProblem:
+			ps.Answer = p.Answer
+		}
+
+		source.Problems = append(source.Problems, ps)
+	}
+
+	return source
+}
+
+// toConfig converts an editable task into a TaskConfig. Fields that the API
+// does not expose are carried over from current when it is not nil.
+func (s *TaskSource) toConfig(current *courseparser.TaskConfig) (*courseparser.TaskConfig, error) {
+	task := &courseparser.TaskConfig{}
+	if current != nil {
+		*task = *current
+	}
+
+	task.Name = s.Name
+	task.Author = s.Author
+	task.ContactURL = s.ContactURL
+	task.Context = s.Context
+	task.EnvironmentID = s.EnvironmentID
+	task.EnvironmentType = s.EnvironmentType
+	task.EnvironmentParameters.RunCmd = s.RunCmd
+	task.File = s.File
+	task.NetworkGrading = s.NetworkGrading
+	task.InputRandom = s.InputRandom
+	task.RegenerateInputRandom = s.RegenerateInputRandom
+	task.Categories = s.Tags
+
+	task.EnvironmentParameters.Limits = nil
+	if s.Limits != nil {
+		task.EnvironmentParameters.Limits = &courseparser.EnvironmentLimits{
+			Time:     s.Limits.Time,
+			HardTime: s.Limits.HardTime,
+			Memory:   s.Limits.Memory,
+		}
+	}
+
+	task.Problems = courseparser.ProblemMap{}
+	for i := range s.Problems {
+		ps := &s.Problems[i]
+		if !courseparser.ValidID(ps.ID) {
+			return nil, fmt.Errorf("problem %d: invalid problem ID %q", i, ps.ID)
+		}
+		if _, exists := task.Problems.Get(ps.ID); exists {
+			return nil, fmt.Errorf("problem %s: duplicate problem ID", ps.ID)
+		}
+
+		problem, err := ps.toProblem()
+		if err != nil {
+			return nil, err
+		}
+		task.Problems.Set(ps.ID, problem)
+	}
+
+	return task, nil
+}
+
+// toProblem converts an editable problem into the courseparser type matching its type
+func (s *ProblemSource) toProblem() (courseparser.Problem, error) {
+	base := courseparser.BaseProblem{
+		Type:   s.Type,
+		Name:   s.Name,
+		Header: s.Header,
+	}
+
+	switch s.Type {
+	case "code":
+		return &courseparser.CodeProblem{
+			BaseProblem: base,
+			Language:    s.Language,
+			Default:     s.Default,
+		}, nil
+
+	case "multiple_choice":
+		choices := make([]courseparser.Choice, len(s.Choices))
+		for i, c := range s.Choices {
+			choices[i] = courseparser.Choice{Text: c.Text, Valid: c.Valid}
+		}
+		return &courseparser.MultipleChoiceProblem{
+			BaseProblem: base,
+			Choices:     choices,
+			Limit:       s.Limit,
+		}, nil
+
+	case "match":
+		return &courseparser.MatchProblem{
+			BaseProblem: base,
+			Answer:      s.Answer,
+		}, nil
+	}
+
+	return nil, fmt.Errorf("problem %s: unknown type %q", s.ID, s.Type)
+}
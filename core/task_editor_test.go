@@ -0,0 +1,284 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"ironsnake/core/courseparser"
+)
+
+// taskWithProblems lists its problems out of alphabetical order, so that
+// tests notice when the order is lost
+const taskWithProblems = `name: Quiz # The comment stays
+problems:
+  zeta:
+    type: match
+    name: Zeta
+    header: First
+    answer: "1"
+  alpha:
+    type: match
+    name: Alpha
+    header: Second
+    answer: "2"
+  mid:
+    type: match
+    name: Mid
+    header: Third
+    answer: "3"
+`
+
+// setupTaskEditor loads a test course with the quiz task in the global
+// catalog, and returns the admin context of the course
+func setupTaskEditor(t *testing.T) *CourseContext {
+	t.Helper()
+
+	coursesDir := writeTestCourse(t)
+	if err := os.MkdirAll(filepath.Join(coursesDir, "CS01", "tasks", "quiz"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(coursesDir, "CS01", "tasks", "quiz", "task.yaml"), []byte(taskWithProblems), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	previous := courseCatalog
+	courseCatalog = courseparser.NewCatalog(coursesDir)
+	t.Cleanup(func() { courseCatalog = previous })
+	if err := courseCatalog.Load(); err != nil {
+		t.Fatal(err)
+	}
+	course, _ := courseCatalog.Get("CS01")
+	return &CourseContext{Course: course, Role: RoleAdmin, Access: CourseMember}
+}
+
+// editRequest builds a request to a task editor handler
+func editRequest(method, ifMatch string, body interface{}, pathValues ...string) *http.Request {
+	var data []byte
+	if body != nil {
+		data, _ = json.Marshal(body)
+	}
+	r := httptest.NewRequest(method, "/courses/CS01/tasks", bytes.NewReader(data))
+	if ifMatch != "" {
+		r.Header.Set("If-Match", ifMatch)
+	}
+	for i := 0; i+1 < len(pathValues); i += 2 {
+		r.SetPathValue(pathValues[i], pathValues[i+1])
+	}
+	return r
+}
+
+// readTask returns the task.yaml of a task and its ETag
+func readTask(t *testing.T, cc *CourseContext, taskID string) ([]byte, string) {
+	t.Helper()
+	data, err := os.ReadFile(taskFilePath(cc.Course, taskID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data, computeETag(data)
+}
+
+// problemIDs returns the problem IDs of a task source response
+func problemIDs(t *testing.T, w *httptest.ResponseRecorder) []string {
+	t.Helper()
+	var source TaskSource
+	if err := json.NewDecoder(w.Body).Decode(&source); err != nil {
+		t.Fatalf("invalid response %q: %v", w.Body.String(), err)
+	}
+	ids := make([]string, len(source.Problems))
+	for i, p := range source.Problems {
+		ids[i] = p.ID
+	}
+	return ids
+}
+
+func TestTaskEditorPreconditions(t *testing.T) {
+	cc := setupTaskEditor(t)
+	original, etag := readTask(t, cc, "quiz")
+	problem := ProblemSource{Type: "match", Name: "Zeta", Header: "First", Answer: "one"}
+
+	tests := []struct {
+		name       string
+		ifMatch    string
+		wantStatus int
+	}{
+		{"missing", "", http.StatusPreconditionRequired},
+		{"stale", `"0123456789abcdef0123456789abcdef"`, http.StatusPreconditionFailed},
+		{"unquoted", strings.Trim(etag, `"`), http.StatusPreconditionFailed},
+		{"list without the current ETag", `"a", "b"`, http.StatusPreconditionFailed},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		updateProblemHandler(w, editRequest(http.MethodPut, tt.ifMatch, problem, "taskID", "quiz", "problemID", "zeta"), cc)
+		if w.Code != tt.wantStatus {
+			t.Errorf("%s: status = %d, want %d", tt.name, w.Code, tt.wantStatus)
+		}
+		if tt.wantStatus == http.StatusPreconditionFailed && w.Header().Get("ETag") != etag {
+			t.Errorf("%s: ETag = %q, want the current %q", tt.name, w.Header().Get("ETag"), etag)
+		}
+		if data, _ := readTask(t, cc, "quiz"); string(data) != string(original) {
+			t.Errorf("%s: task.yaml changed", tt.name)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	deleteTaskHandler(w, editRequest(http.MethodDelete, "", nil, "taskID", "quiz"), cc)
+	if w.Code != http.StatusPreconditionRequired {
+		t.Errorf("delete without If-Match: status = %d, want %d", w.Code, http.StatusPreconditionRequired)
+	}
+}
+
+func TestETagListMatches(t *testing.T) {
+	const etag = `"abc"`
+	tests := []struct {
+		list string
+		want bool
+	}{
+		{`"abc"`, true},
+		{`*`, true},
+		{` * `, true},
+		{`W/"abc"`, true},
+		{`"x", "abc"`, true},
+		{`"x",W/"abc"`, true},
+		{`"x" ,	"y", "abc" `, true},
+		{`"abcd"`, false},
+		{`"ab"`, false},
+		{`abc`, false},
+		{`"x", "y"`, false},
+		{`"x", abc`, false},
+		{`"abc`, false},
+		{`*, "x"`, false},
+	}
+	for _, tt := range tests {
+		if got := etagListMatches(tt.list, etag); got != tt.want {
+			t.Errorf("etagListMatches(%q) = %v, want %v", tt.list, got, tt.want)
+		}
+	}
+}
+
+func TestTaskEditorKeepsProblemOrder(t *testing.T) {
+	cc := setupTaskEditor(t)
+	_, etag := readTask(t, cc, "quiz")
+
+	steps := []struct {
+		name    string
+		handler CourseHandlerFunc
+		method  string
+		body    interface{}
+		problem string
+		want    []string
+	}{
+		{"create", createProblemHandler, http.MethodPost,
+			ProblemSource{ID: "beta", Type: "match", Name: "Beta", Header: "Fourth", Answer: "4"},
+			"", []string{"zeta", "alpha", "mid", "beta"}},
+		{"update", updateProblemHandler, http.MethodPut,
+			ProblemSource{Type: "match", Name: "Alpha", Header: "Second, edited", Answer: "2"},
+			"alpha", []string{"zeta", "alpha", "mid", "beta"}},
+		{"delete", deleteProblemHandler, http.MethodDelete, nil,
+			"zeta", []string{"alpha", "mid", "beta"}},
+	}
+	for _, step := range steps {
+		w := httptest.NewRecorder()
+		step.handler(w, editRequest(step.method, etag, step.body, "taskID", "quiz", "problemID", step.problem), cc)
+		if w.Code >= 300 {
+			t.Fatalf("%s: status = %d %q", step.name, w.Code, w.Body.String())
+		}
+		if etag = w.Header().Get("ETag"); etag == "" {
+			t.Fatalf("%s: no ETag", step.name)
+		}
+		if got := problemIDs(t, w); !slices.Equal(got, step.want) {
+			t.Errorf("%s: problems = %v, want %v", step.name, got, step.want)
+		}
+
+		// The file is read back in the same order
+		task, diskETag, err := readTaskFile(cc.Course, "quiz")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := task.Problems.IDs(); !slices.Equal(got, step.want) {
+			t.Errorf("%s: problems on disk = %v, want %v", step.name, got, step.want)
+		}
+		if diskETag != etag {
+			t.Errorf("%s: ETag = %s, want the ETag of the file %s", step.name, etag, diskETag)
+		}
+	}
+
+	data, _ := readTask(t, cc, "quiz")
+	if !strings.Contains(string(data), "# The comment stays") {
+		t.Errorf("comment lost:\n%s", data)
+	}
+	if !strings.Contains(string(data), "Second, edited") {
+		t.Errorf("update lost:\n%s", data)
+	}
+}
+
+func TestCreateTaskKeepsProblemOrder(t *testing.T) {
+	cc := setupTaskEditor(t)
+
+	source := TaskSource{ID: "new", Name: "New", Problems: []ProblemSource{
+		{ID: "second", Type: "match", Name: "B", Header: "B", Answer: "b"},
+		{ID: "first", Type: "match", Name: "A", Header: "A", Answer: "a"},
+	}}
+	w := httptest.NewRecorder()
+	createTaskHandler(w, editRequest(http.MethodPost, "", source), cc)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("status = %d %q, want %d", w.Code, w.Body.String(), http.StatusCreated)
+	}
+	want := []string{"second", "first"}
+	if got := problemIDs(t, w); !slices.Equal(got, want) {
+		t.Errorf("problems = %v, want %v", got, want)
+	}
+	course, _ := courseCatalog.Get("CS01")
+	task := course.Tasks["new"]
+	if got := task.Problems.IDs(); !slices.Equal(got, want) {
+		t.Errorf("problems of the reloaded course = %v, want %v", got, want)
+	}
+}
+
+func TestTaskEditorValidationKeepsFile(t *testing.T) {
+	cc := setupTaskEditor(t)
+	original, etag := readTask(t, cc, "quiz")
+
+	tests := []struct {
+		name    string
+		handler CourseHandlerFunc
+		method  string
+		body    interface{}
+		problem string
+	}{
+		{"empty task name", updateTaskHandler, http.MethodPut,
+			TaskSource{Name: " ", Problems: []ProblemSource{}}, ""},
+		{"unknown tag", updateTaskHandler, http.MethodPut,
+			TaskSource{Name: "Quiz", Tags: []string{"recursion"}}, ""},
+		{"duplicate problem", updateTaskHandler, http.MethodPut,
+			TaskSource{Name: "Quiz", Problems: []ProblemSource{
+				{ID: "a", Type: "match", Name: "A", Answer: "a"},
+				{ID: "a", Type: "match", Name: "A", Answer: "a"},
+			}}, ""},
+		{"problem without choices", createProblemHandler, http.MethodPost,
+			ProblemSource{ID: "mcq", Type: "multiple_choice", Name: "MCQ"}, ""},
+		{"match without answer", updateProblemHandler, http.MethodPut,
+			ProblemSource{Type: "match", Name: "Alpha"}, "alpha"},
+		{"unknown problem type", updateProblemHandler, http.MethodPut,
+			ProblemSource{Type: "essay", Name: "Alpha"}, "alpha"},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		tt.handler(w, editRequest(tt.method, etag, tt.body, "taskID", "quiz", "problemID", tt.problem), cc)
+		if w.Code != http.StatusUnprocessableEntity {
+			t.Errorf("%s: status = %d %q, want %d", tt.name, w.Code, w.Body.String(), http.StatusUnprocessableEntity)
+		}
+		if strings.Contains(w.Body.String(), cc.Course.DirPath) {
+			t.Errorf("%s: error exposes the server path: %q", tt.name, w.Body.String())
+		}
+		if data, _ := readTask(t, cc, "quiz"); string(data) != string(original) {
+			t.Errorf("%s: task.yaml changed:\n%s", tt.name, data)
+		}
+	}
+}
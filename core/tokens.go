@@ -0,0 +1,323 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// personalAccessTokenPrefix starts every personal access token, to tell them
+// apart from JWTs and to let secret scanners find leaked ones
+const personalAccessTokenPrefix = "isk_"
+
+// maxTokenLifetimeDays bounds the lifetime of personal access tokens
+const maxTokenLifetimeDays = 365
+
+// TokenScopesContextKey is the key for storing the scopes of the personal
+// access token of a request in its context. There are none for sessions,
+// which are not restricted.
+const TokenScopesContextKey contextKey = "token scopes"
+
+// Token scopes are <resource>:read, allowing safe methods only, or
+// <resource>:write, allowing every method
+const (
+	ScopeCoursesRead      = "courses:read"      // Courses, tasks and the syllabus
+	ScopeCoursesWrite     = "courses:write"     // Registration, authoring, groups and course files
+	ScopeSubmissionsRead  = "submissions:read"  // Submissions and grades
+	ScopeSubmissionsWrite = "submissions:write" // Submitting answers and running code
+	ScopeAdminRead        = "admin:read"        // Platform administration
+	ScopeAdminWrite       = "admin:write"
+)
+
+var tokenScopes = []string{
+	ScopeCoursesRead, ScopeCoursesWrite,
+	ScopeSubmissionsRead, ScopeSubmissionsWrite,
+	ScopeAdminRead, ScopeAdminWrite,
+}
+
+// permissionResources are the scope resources of the course permissions
+var permissionResources = map[Permission]string{
+	PermViewCourse:      "courses",
+	PermReadTasks:       "courses",
+	PermEditTask:        "courses",
+	PermManageGroups:    "courses",
+	PermManageCourse:    "courses",
+	PermSubmit:          "submissions",
+	PermViewSubmissions: "submissions",
+	PermGrade:           "submissions",
+}
+
+// CreateTokenRequest represents the request body to create a personal access
+// token
+type CreateTokenRequest struct {
+	Name          string   `json:"name"`
+	Scopes        []string `json:"scopes"`
+	ExpiresInDays int      `json:"expiresInDays"` // 30 if zero
+}
+
+// isPersonalAccessToken reports whether a bearer token is a personal access
+// token rather than a JWT
+func isPersonalAccessToken(token string) bool {
+	return strings.HasPrefix(token, personalAccessTokenPrefix)
+}
+
+// authenticateBearer authenticates a JWT or a personal access token and
+// returns its user and, for personal access tokens, its scopes or, for JWTs,
+// its session
+func authenticateBearer(tokenString string) (*User, []string, *Session, error) {
+	if !isPersonalAccessToken(tokenString) {
+		user, session, err := authenticateToken(tokenString)
+		return user, nil, session, err
+	}
+
+	var token PersonalAccessToken
+	err := DB.Preload("User").Where("token_hash = ?", hashToken(tokenString)).First(&token).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil, nil, errors.New("unknown personal access token")
+	}
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	now := time.Now()
+	if now.After(token.ExpiresAt) {
+		return nil, nil, nil, fmt.Errorf("personal access token %s expired", token.Prefix)
+	}
+	if token.User.Disabled {
+		return nil, nil, nil, ErrUserDisabled
+	}
+
+	// Record the last use, at most once a minute
+	if token.LastUsedAt == nil || now.Sub(*token.LastUsedAt) > time.Minute {
+		if err := DB.Model(&token).UpdateColumn("last_used_at", now).Error; err != nil {
+			log.Printf("Failed to record the use of token %s: %v", token.ID, err)
+		}
+	}
+	return &token.User, strings.Fields(token.Scopes), nil, nil
+}
+
+// GetTokenScopes returns the scopes of the personal access token of a
+// request, or nil if it was authenticated by a session
+func GetTokenScopes(r *http.Request) []string {
+	scopes, _ := r.Context().Value(TokenScopesContextKey).([]string)
+	return scopes
+}
+
+// isWriteMethod reports whether an HTTP method needs a write scope
+func isWriteMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, "PROPFIND":
+		return false
+	}
+	return true
+}
+
+// scopeAllows reports whether scopes allow a request with method on the
+// resource. A write scope includes the read scope; nil scopes allow all.
+func scopeAllows(scopes []string, resource, method string) bool {
+	if scopes == nil {
+		return true
+	}
+	if slices.Contains(scopes, resource+":write") {
+		return true
+	}
+	return !isWriteMethod(method) && slices.Contains(scopes, resource+":read")
+}
+
+// writeInsufficientScope rejects a request whose token lacks a scope
+func writeInsufficientScope(w http.ResponseWriter, r *http.Request, resource string) {
+	scope := resource + ":read"
+	if isWriteMethod(r.Method) {
+		scope = resource + ":write"
+	}
+	w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer error="insufficient_scope", scope=%q`, scope))
+	http.Error(w, fmt.Sprintf("Forbidden: token lacks scope %q", scope), http.StatusForbidden)
+}
+
+// RequireScope restricts a route to sessions and personal access tokens with
+// a scope on resource
+func RequireScope(resource string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !scopeAllows(GetTokenScopes(r), resource, r.Method) {
+			writeInsufficientScope(w, r, resource)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// RequireSession restricts a route to users logged in with a session of
+// their own, e.g. to prevent tokens from creating other tokens
+func RequireSession(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if GetTokenScopes(r) != nil {
+			http.Error(w, "Forbidden: not allowed with a personal access token", http.StatusForbidden)
+			return
+		}
+		if GetImpersonation(r) != nil {
+			http.Error(w, "Forbidden: not allowed while impersonating", http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// withTokenScopes stores the scopes of a personal access token in the
+// context of a request
+func withTokenScopes(ctx context.Context, scopes []string) context.Context {
+	if scopes == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, TokenScopesContextKey, scopes)
+}
+
+// tokenResponse converts a token to its API representation, without secret
+func tokenResponse(token *PersonalAccessToken) TokenResponse {
+	return TokenResponse{
+		ID:         token.ID.String(),
+		Name:       token.Name,
+		Prefix:     token.Prefix,
+		Scopes:     strings.Fields(token.Scopes),
+		ExpiresAt:  token.ExpiresAt,
+		LastUsedAt: token.LastUsedAt,
+		CreatedAt:  token.CreatedAt,
+	}
+}
+
+// listTokensHandler lists the personal access tokens of the current user
+func listTokensHandler(w http.ResponseWriter, r *http.Request) {
+	user, err := GetUserFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var tokens []PersonalAccessToken
+	if err := DB.Where("user_id = ?", user.ID).Order("created_at DESC").Find(&tokens).Error; err != nil {
+		log.Printf("Error listing tokens of %s: %v", user.Username, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	response := make([]TokenResponse, 0, len(tokens))
+	for i := range tokens {
+		response = append(response, tokenResponse(&tokens[i]))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+// createTokenHandler creates a personal access token. The token is only in
+// this response; the database keeps its hash.
+func createTokenHandler(w http.ResponseWriter, r *http.Request) {
+	user, err := GetUserFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var request CreateTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	request.Name = strings.TrimSpace(request.Name)
+	if request.Name == "" || len(request.Name) > 100 {
+		http.Error(w, "Name is required, up to 100 characters", http.StatusBadRequest)
+		return
+	}
+	if len(request.Scopes) == 0 {
+		http.Error(w, "At least one scope is required", http.StatusBadRequest)
+		return
+	}
+	for _, scope := range request.Scopes {
+		if !slices.Contains(tokenScopes, scope) {
+			http.Error(w, fmt.Sprintf("Unknown scope %q", scope), http.StatusBadRequest)
+			return
+		}
+		if strings.HasPrefix(scope, "admin:") && !isPlatformAdmin(user) {
+			http.Error(w, fmt.Sprintf("Forbidden: scope %q is for platform administrators", scope), http.StatusForbidden)
+			return
+		}
+	}
+	if request.ExpiresInDays == 0 {
+		request.ExpiresInDays = 30
+	}
+	if request.ExpiresInDays < 0 || request.ExpiresInDays > maxTokenLifetimeDays {
+		http.Error(w, fmt.Sprintf("Tokens expire within 1 to %d days", maxTokenLifetimeDays), http.StatusBadRequest)
+		return
+	}
+
+	secret, err := randomToken()
+	if err != nil {
+		log.Printf("Failed to generate token: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	secret = personalAccessTokenPrefix + secret
+
+	slices.Sort(request.Scopes)
+	token := PersonalAccessToken{
+		UserID:    user.ID,
+		Name:      request.Name,
+		TokenHash: hashToken(secret),
+		Prefix:    secret[:len(personalAccessTokenPrefix)+6],
+		Scopes:    strings.Join(slices.Compact(request.Scopes), " "),
+		ExpiresAt: time.Now().AddDate(0, 0, request.ExpiresInDays),
+		CreatedAt: time.Now(),
+	}
+	if err := DB.Create(&token).Error; err != nil {
+		log.Printf("Error creating token of %s: %v", user.Username, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("User %s created personal access token %s (%s)", user.Username, token.Prefix, token.Scopes)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(CreatedTokenResponse{TokenResponse: tokenResponse(&token), Token: secret}); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+// deleteTokenHandler revokes a personal access token of the current user
+func deleteTokenHandler(w http.ResponseWriter, r *http.Request) {
+	user, err := GetUserFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	tokenID, err := uuid.Parse(r.PathValue("tokenID"))
+	if err != nil {
+		http.Error(w, "Token not found", http.StatusNotFound)
+		return
+	}
+
+	result := DB.Where("id = ? AND user_id = ?", tokenID, user.ID).Delete(&PersonalAccessToken{})
+	if result.Error != nil {
+		log.Printf("Error deleting token %s: %v", tokenID, result.Error)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if result.RowsAffected == 0 {
+		http.Error(w, "Token not found", http.StatusNotFound)
+		return
+	}
+	log.Printf("User %s revoked personal access token %s", user.Username, tokenID)
+
+	w.WriteHeader(http.StatusNoContent)
+}
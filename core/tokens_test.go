@@ -0,0 +1,42 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestScopeAllows(t *testing.T) {
+	tests := []struct {
+		scopes   []string
+		resource string
+		method   string
+		want     bool
+	}{
+		// Sessions have no scopes and are not restricted
+		{nil, "admin", http.MethodDelete, true},
+
+		// Tokens without scopes are allowed nothing
+		{[]string{}, "courses", http.MethodGet, false},
+
+		{[]string{ScopeCoursesRead}, "courses", http.MethodGet, true},
+		{[]string{ScopeCoursesRead}, "courses", http.MethodHead, true},
+		{[]string{ScopeCoursesRead}, "courses", "PROPFIND", true},
+		{[]string{ScopeCoursesRead}, "courses", http.MethodPost, false},
+		{[]string{ScopeCoursesRead}, "courses", "MKCOL", false},
+		{[]string{ScopeCoursesRead}, "submissions", http.MethodGet, false},
+
+		// A write scope includes the read scope
+		{[]string{ScopeCoursesWrite}, "courses", http.MethodGet, true},
+		{[]string{ScopeCoursesWrite}, "courses", http.MethodPut, true},
+		{[]string{ScopeCoursesWrite}, "submissions", http.MethodPost, false},
+
+		{[]string{ScopeCoursesRead, ScopeSubmissionsWrite}, "submissions", http.MethodPost, true},
+		{[]string{ScopeCoursesRead, ScopeSubmissionsWrite}, "courses", http.MethodPatch, false},
+		{[]string{ScopeSubmissionsWrite}, "admin", http.MethodGet, false},
+	}
+	for _, tt := range tests {
+		if got := scopeAllows(tt.scopes, tt.resource, tt.method); got != tt.want {
+			t.Errorf("scopeAllows(%q, %q, %s) = %v, want %v", tt.scopes, tt.resource, tt.method, got, tt.want)
+		}
+	}
+}
@@ -1,14 +1,40 @@
 package main
 
+import "time"
+
 // CourseResponse represents the JSON response structure for a course
 type CourseResponse struct {
-	ID         string   `json:"id"`
-	Code       string   `json:"code"`
-	Name       string   `json:"name"`
-	Accessible bool     `json:"accessible"`
-	Admins     []string `json:"admins"`
-	Tutors     []string `json:"tutors"`
-	TaskCount  int      `json:"taskCount"`
+	ID                   string        `json:"id"`
+	Code                 string        `json:"code"`
+	Name                 string        `json:"name"`
+	Accessible           bool          `json:"accessible"`
+	Admins               []string      `json:"admins"`
+	Tutors               []string      `json:"tutors"`
+	TaskCount            int           `json:"taskCount"`
+	Tags                 []TagResponse `json:"tags"`
+	Enrolled             bool          `json:"enrolled"`
+	Registration         bool          `json:"registration"`         // Whether users can register
+	RegistrationPassword bool          `json:"registrationPassword"` // Whether registering needs a password
+	AllowUnregister      bool          `json:"allowUnregister"`
+	GroupsStudentChoice  bool          `json:"groupsStudentChoice"` // Whether students pick their group
+	Role                 string        `json:"role"`   // none, student, tutor or admin
+	Access               string        `json:"access"` // listed, preview or member
+}
+
+// EnrollmentResponse represents the enrollment of the user in a course
+type EnrollmentResponse struct {
+	CourseID   string     `json:"courseId"`
+	Enrolled   bool       `json:"enrolled"`
+	EnrolledAt *time.Time `json:"enrolledAt,omitempty"`
+}
+
+// TagResponse represents a course tag in the API response
+type TagResponse struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Visible     bool   `json:"visible"`
+	Type        string `json:"type"` // skill, category or organisational
 }
 
 // TaskResponse represents a task in the API response
@@ -17,6 +43,7 @@ type TaskResponse struct {
 	Name            string            `json:"name"`
 	Author          string            `json:"author"`
 	EnvironmentType string            `json:"environmentType"`
+	Tags            []string          `json:"tags"`
 	Problems        []ProblemResponse `json:"problems"`
 }
 
@@ -62,6 +89,8 @@ type TaskDetailResponse struct {
 	EnvironmentType string                  `json:"environmentType"`
 	Limits          *EnvironmentLimits      `json:"limits,omitempty"`
 	NetworkGrading  bool                    `json:"networkGrading"`
+	GroupSubmission bool                    `json:"groupSubmission"` // Submitted once for the whole group
+	Tags            []string                `json:"tags"`
 	Problems        []ProblemDetailResponse `json:"problems"`
 }
 
@@ -81,11 +110,89 @@ type SyllabusResponse struct {
 
 // SummaryEntry represents a syllabus entry
 type SummaryEntry struct {
+	Kind     string         `json:"kind"` // chapter, part or separator
 	Title    string         `json:"title"`
 	Path     string         `json:"path,omitempty"`
+	Number   string         `json:"number,omitempty"` // for numbered chapters
+	Draft    bool           `json:"draft,omitempty"`
 	Children []SummaryEntry `json:"children,omitempty"`
 }
 
+// ChapterResponse represents a syllabus chapter with its rendered content
+type ChapterResponse struct {
+	Path     string                 `json:"path"`
+	Title    string                 `json:"title"`
+	Markdown string                 `json:"markdown"`
+	HTML     string                 `json:"html"`
+	Tasks    []EmbeddedTaskResponse `json:"tasks"`    // Tasks embedded with {{#task}}
+	Snippets []SnippetResponse      `json:"snippets"` // Runnable code blocks, by data-snippet index
+}
+
+// EmbeddedTaskResponse represents a task embedded in a chapter, with its
+// state for the current user
+type EmbeddedTaskResponse struct {
+	*TaskResponse                      // nil while students may not see the task
+	ID             string              `json:"id"`
+	Status         string              `json:"status"` // open, upcoming or closed
+	Deadline       *time.Time          `json:"deadline,omitempty"`
+	LastSubmission *SubmissionResponse `json:"lastSubmission,omitempty"` // newest of the user or their group
+}
+
+// SnippetResponse represents a runnable code block of a chapter, to be sent
+// to /run
+type SnippetResponse struct {
+	Language string `json:"language"`
+	Code     string `json:"code"`
+}
+
+// SearchResponse represents the results of a course search
+type SearchResponse struct {
+	Query string              `json:"query"`
+	Hits  []SearchHitResponse `json:"hits"`
+}
+
+// SearchHitResponse represents a search result with a link to the API
+// resource it was found in
+type SearchHitResponse struct {
+	Kind        string  `json:"kind"` // chapter, task or problem
+	Title       string  `json:"title"`
+	TaskID      string  `json:"taskId,omitempty"`
+	ProblemID   string  `json:"problemId,omitempty"`
+	ChapterPath string  `json:"chapterPath,omitempty"`
+	Anchor      string  `json:"anchor,omitempty"`
+	Link        string  `json:"link"`
+	Snippet     string  `json:"snippet"`
+	Score       float64 `json:"score"`
+}
+
+// GroupResponse represents a group of students of a course
+type GroupResponse struct {
+	ID      string              `json:"id"`
+	Name    string              `json:"name"`
+	Size    int                 `json:"size"`
+	Members []GroupUserResponse `json:"members"`
+	Tutors  []GroupUserResponse `json:"tutors"`
+}
+
+// GroupUserResponse represents a member or tutor of a group
+type GroupUserResponse struct {
+	Username  string `json:"username"`
+	FirstName string `json:"firstName"`
+	LastName  string `json:"lastName"`
+}
+
+// SubmissionResponse represents a submission in a submission history
+type SubmissionResponse struct {
+	ID        string    `json:"id"`
+	TaskID    string    `json:"taskId"`
+	Submitter string    `json:"submitter"`
+	GroupID   string    `json:"groupId,omitempty"`
+	Score     float64   `json:"score"`
+	Correct   int       `json:"correct"`
+	Total     int       `json:"total"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
 // RunCodeRequest represents the request body for code execution
 type RunCodeRequest struct {
 	Code     string `json:"code"`
@@ -126,3 +233,108 @@ type MCQSubmissionResponse struct {
 type ProblemResult struct {
 	Correct bool `json:"correct"`
 }
+
+// TaskSource represents the full, editable content of a task, including the
+// correct answers. It is only sent to and accepted from course admins.
+type TaskSource struct {
+	ID                    string             `json:"id"`
+	Name                  string             `json:"name"`
+	Author                string             `json:"author"`
+	ContactURL            string             `json:"contactUrl"`
+	Context               string             `json:"context"`
+	EnvironmentID         string             `json:"environmentId"`
+	EnvironmentType       string             `json:"environmentType"`
+	Limits                *EnvironmentLimits `json:"limits,omitempty"`
+	RunCmd                string             `json:"runCmd,omitempty"`
+	File                  string             `json:"file"`
+	NetworkGrading        bool               `json:"networkGrading"`
+	InputRandom           int                `json:"inputRandom,omitempty"`
+	RegenerateInputRandom string             `json:"regenerateInputRandom,omitempty"`
+	Tags                  []string           `json:"tags"`
+	Problems              []ProblemSource    `json:"problems"`
+}
+
+// ProblemSource represents the editable content of a problem. Only the fields
+// of the problem's type are used.
+type ProblemSource struct {
+	ID       string         `json:"id"`
+	Type     string         `json:"type"`
+	Name     string         `json:"name"`
+	Header   string         `json:"header"`
+	Language string         `json:"language,omitempty"` // for code problems
+	Default  string         `json:"default,omitempty"`  // for code problems
+	Choices  []ChoiceSource `json:"choices,omitempty"`  // for multiple choice
+	Limit    int            `json:"limit,omitempty"`    // for multiple choice
+	Answer   string         `json:"answer,omitempty"`   // for match problems
+}
+
+// ChoiceSource represents a multiple choice option with its validity
+type ChoiceSource struct {
+	Text  string `json:"text"`
+	Valid bool   `json:"valid"`
+}
+
+// AdminUserResponse represents a user in the platform administration
+type AdminUserResponse struct {
+	UserResponse
+	Disabled   bool      `json:"disabled"`
+	Unverified bool      `json:"unverified"` // Self-registered, email address not verified yet
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+// AdminUserListResponse represents a page of the users of the platform
+type AdminUserListResponse struct {
+	Total int64               `json:"total"` // Number of users matching the search
+	Users []AdminUserResponse `json:"users"`
+}
+
+// AdminCourseResponse represents a course in the platform administration
+type AdminCourseResponse struct {
+	CourseResponse
+	Hidden      bool `json:"hidden"` // Whether the course is hidden from users outside of it
+	Enrollments int  `json:"enrollments"`
+}
+
+// ImportResponse represents the result of a user import, or its preview
+type ImportResponse struct {
+	DryRun    bool                `json:"dryRun"`
+	Created   int                 `json:"created"`
+	Updated   int                 `json:"updated"`
+	Unchanged int                 `json:"unchanged"`
+	Failed    int                 `json:"failed"`
+	Rows      []ImportRowResponse `json:"rows"`
+}
+
+// ImportRowResponse represents the result of importing a single user
+type ImportRowResponse struct {
+	Line     int      `json:"line,omitempty"` // Line in the CSV file
+	Username string   `json:"username"`
+	Status   string   `json:"status"`             // created, updated, unchanged or error
+	Enrolled []string `json:"enrolled,omitempty"` // Courses the user was newly enrolled in
+	Error    string   `json:"error,omitempty"`
+}
+
+// OIDCProviderResponse represents an OpenID Connect provider users can log in with
+type OIDCProviderResponse struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	LoginURL string `json:"loginUrl"` // Add ?redirect=<path> to return to a frontend page
+}
+
+// TokenResponse represents a personal access token, without its secret
+type TokenResponse struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"` // Start of the token, to recognize it
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  time.Time  `json:"expiresAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+	CreatedAt  time.Time  `json:"createdAt"`
+}
+
+// CreatedTokenResponse represents a personal access token just created, the
+// only time its secret is shown
+type CreatedTokenResponse struct {
+	TokenResponse
+	Token string `json:"token"`
+}
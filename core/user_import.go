@@ -0,0 +1,405 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// maxImportSize limits the size of an imported CSV file
+const maxImportSize = 5 << 20
+
+// Statuses of an imported row
+const (
+	importCreated   = "created"
+	importUpdated   = "updated"
+	importUnchanged = "unchanged"
+	importFailed    = "error"
+)
+
+// errDryRun rolls back the transaction of a dry-run import
+var errDryRun = errors.New("dry run")
+
+// ProvisionLDAPRequest represents the body of an LDAP group provisioning
+type ProvisionLDAPRequest struct {
+	Group   string   `json:"group"`
+	Courses []string `json:"courses"` // Courses to enroll the members in
+	DryRun  bool     `json:"dryRun"`
+}
+
+// importRow is a user to create or update, with the courses to enroll them in
+type importRow struct {
+	Line      int // Line in the CSV file, 0 for other sources
+	Username  string
+	Email     string
+	FirstName string
+	LastName  string
+	Password  string
+	Provider  string // local or ldap
+	Courses   []string
+	Err       error // Set when the row could not be parsed
+}
+
+// importColumns maps the accepted CSV headers to the fields of importRow.
+// Headers are matched ignoring case, spaces and underscores.
+var importColumns = map[string]string{
+	"username":  "username",
+	"email":     "email",
+	"mail":      "email",
+	"firstname": "firstName",
+	"lastname":  "lastName",
+	"password":  "password",
+	"provider":  "provider",
+	"courses":   "courses",
+}
+
+// parseUserCSV reads the users of a CSV file. The first record is a header
+// naming the columns; username and email are required, first_name,
+// last_name, password, provider and courses are optional. Courses are
+// separated by semicolons or spaces. Errors of a single row are reported in
+// that row; the error returned is for files that cannot be read at all.
+func parseUserCSV(r io.Reader) ([]importRow, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, errors.New("the file is empty")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid header: %w", err)
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		key := strings.NewReplacer(" ", "", "_", "", "-", "").Replace(strings.ToLower(strings.TrimSpace(name)))
+		if i == 0 {
+			key = strings.TrimPrefix(key, "\ufeff") // Spreadsheets often save a BOM
+		}
+		field, ok := importColumns[key]
+		if !ok {
+			return nil, fmt.Errorf("unknown column %q", name)
+		}
+		if _, dup := columns[field]; dup {
+			return nil, fmt.Errorf("duplicate column %q", name)
+		}
+		columns[field] = i
+	}
+	for _, field := range []string{"username", "email"} {
+		if _, ok := columns[field]; !ok {
+			return nil, fmt.Errorf("missing column %q", field)
+		}
+	}
+
+	var rows []importRow
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if !errors.As(err, &parseErr) {
+				return nil, err
+			}
+			rows = append(rows, importRow{Line: parseErr.Line, Err: parseErr.Err})
+			continue
+		}
+		line, _ := reader.FieldPos(0)
+
+		get := func(field string) string {
+			if i, ok := columns[field]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		row := importRow{
+			Line:      line,
+			Username:  get("username"),
+			Email:     get("email"),
+			FirstName: get("firstName"),
+			LastName:  get("lastName"),
+			Password:  get("password"),
+			Provider:  strings.ToLower(get("provider")),
+			Courses: strings.FieldsFunc(get("courses"), func(r rune) bool {
+				return r == ';' || r == ' '
+			}),
+		}
+		if row.Provider == "" {
+			row.Provider = "local"
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// validate checks the fields of a row that do not depend on the database
+func (row *importRow) validate() error {
+	if row.Err != nil {
+		return row.Err
+	}
+	if row.Username == "" {
+		return errors.New("username is required")
+	}
+	if row.Email == "" {
+		return errors.New("email is required")
+	}
+	if row.Provider != "local" && row.Provider != "ldap" {
+		return fmt.Errorf("unknown provider %q", row.Provider)
+	}
+	if row.Provider == "ldap" && row.Password != "" {
+		return errors.New("LDAP users cannot have a password")
+	}
+	for _, courseID := range row.Courses {
+		if _, ok := courseCatalog.Get(courseID); !ok {
+			return fmt.Errorf("unknown course %q", courseID)
+		}
+	}
+	return nil
+}
+
+// importUsers creates the users of the rows that do not exist yet, updates
+// the others and enrolls them in their courses. Importing the same rows twice
+// changes nothing the second time. Rows in error are skipped; with dryRun,
+// nothing is saved but the result is the same as without.
+func importUsers(rows []importRow, dryRun bool) (*ImportResponse, error) {
+	response := &ImportResponse{
+		DryRun: dryRun,
+		Rows:   make([]ImportRowResponse, len(rows)),
+	}
+
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		seen := make(map[string]int, len(rows))
+		for i := range rows {
+			row := &rows[i]
+			result := &response.Rows[i]
+			result.Line = row.Line
+			result.Username = row.Username
+
+			err := row.validate()
+			if first, dup := seen[row.Username]; err == nil && dup {
+				err = errors.New("duplicate user")
+				if first > 0 {
+					err = fmt.Errorf("duplicate of line %d", first)
+				}
+			}
+			if err == nil {
+				seen[row.Username] = row.Line
+				// A savepoint per row keeps the other rows when one fails
+				err = tx.Transaction(func(tx *gorm.DB) error {
+					return importUser(tx, row, result)
+				})
+			}
+			if err != nil {
+				result.Status = importFailed
+				result.Error = err.Error()
+				result.Enrolled = nil
+			}
+
+			switch result.Status {
+			case importCreated:
+				response.Created++
+			case importUpdated:
+				response.Updated++
+			case importUnchanged:
+				response.Unchanged++
+			default:
+				response.Failed++
+			}
+		}
+		if dryRun {
+			return errDryRun
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errDryRun) {
+		return nil, err
+	}
+	return response, nil
+}
+
+// importUser creates or updates the user of a row and enrolls them
+func importUser(tx *gorm.DB, row *importRow, result *ImportRowResponse) error {
+	var conflicts int64
+	err := tx.Model(&User{}).
+		Where("email = ? AND username <> ?", row.Email, row.Username).
+		Count(&conflicts).Error
+	if err != nil {
+		return err
+	}
+	if conflicts > 0 {
+		return fmt.Errorf("email %s is used by another user", row.Email)
+	}
+
+	var user User
+	err = tx.Where("username = ?", row.Username).First(&user).Error
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		user = User{
+			Username:     row.Username,
+			Email:        row.Email,
+			FirstName:    row.FirstName,
+			LastName:     row.LastName,
+			AuthProvider: row.Provider,
+			LDAPEnabled:  row.Provider == "ldap",
+		}
+		if row.Password != "" {
+			hash, err := bcrypt.GenerateFromPassword([]byte(row.Password), bcrypt.DefaultCost)
+			if err != nil {
+				return fmt.Errorf("failed to hash password: %w", err)
+			}
+			user.PasswordHash = string(hash)
+		}
+		if err := tx.Create(&user).Error; err != nil {
+			return fmt.Errorf("failed to create user: %w", err)
+		}
+		result.Status = importCreated
+
+	case err != nil:
+		return err
+
+	default:
+		// Existing passwords are kept, so that importing again does not
+		// reset the accounts
+		updates := map[string]interface{}{}
+		if user.Email != row.Email {
+			updates["email"] = row.Email
+		}
+		if row.FirstName != "" && user.FirstName != row.FirstName {
+			updates["first_name"] = row.FirstName
+		}
+		if row.LastName != "" && user.LastName != row.LastName {
+			updates["last_name"] = row.LastName
+		}
+		if row.Provider == "ldap" && (user.AuthProvider != "ldap" || !user.LDAPEnabled) {
+			updates["auth_provider"] = "ldap"
+			updates["ldap_enabled"] = true
+			updates["password_hash"] = ""
+		}
+		result.Status = importUnchanged
+		if len(updates) > 0 {
+			if err := tx.Model(&user).Updates(updates).Error; err != nil {
+				return fmt.Errorf("failed to update user: %w", err)
+			}
+			result.Status = importUpdated
+		}
+	}
+
+	for _, courseID := range row.Courses {
+		enrollment := Enrollment{UserID: user.ID, CourseID: courseID, Source: "import"}
+		created := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&enrollment)
+		if created.Error != nil {
+			return fmt.Errorf("failed to enroll in %s: %w", courseID, created.Error)
+		}
+		if created.RowsAffected > 0 {
+			result.Enrolled = append(result.Enrolled, courseID)
+		}
+	}
+	if result.Status == importUnchanged && len(result.Enrolled) > 0 {
+		result.Status = importUpdated
+	}
+	return nil
+}
+
+// writeImport writes the result of an import
+func writeImport(w http.ResponseWriter, admin *User, source string, response *ImportResponse) {
+	if !response.DryRun {
+		log.Printf("Platform administrator %s imported users from %s: %d created, %d updated, %d unchanged, %d failed",
+			admin.Username, source, response.Created, response.Updated, response.Unchanged, response.Failed)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+// adminImportUsersHandler imports the users of the CSV file in the request
+// body. With ?dryRun=true, the result is previewed without saving anything.
+func adminImportUsersHandler(w http.ResponseWriter, r *http.Request) {
+	admin, err := GetUserFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	dryRun := r.URL.Query().Get("dryRun") == "true"
+
+	rows, err := parseUserCSV(http.MaxBytesReader(w, r.Body, maxImportSize))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid CSV file: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	response, err := importUsers(rows, dryRun)
+	if err != nil {
+		log.Printf("Error importing users: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	writeImport(w, admin, "CSV", response)
+}
+
+// adminProvisionLDAPHandler creates the accounts of every member of an LDAP
+// group, so that they can be enrolled and put in groups before they first
+// log in
+func adminProvisionLDAPHandler(w http.ResponseWriter, r *http.Request) {
+	admin, err := GetUserFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var request ProvisionLDAPRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if request.Group == "" {
+		http.Error(w, "Group is required", http.StatusBadRequest)
+		return
+	}
+	for _, courseID := range request.Courses {
+		if _, ok := courseCatalog.Get(courseID); !ok {
+			http.Error(w, fmt.Sprintf("Unknown course %q", courseID), http.StatusBadRequest)
+			return
+		}
+	}
+
+	members, err := ldapService.GetGroupMembers(request.Group)
+	if err != nil {
+		log.Printf("Error reading LDAP group %s: %v", request.Group, err)
+		http.Error(w, fmt.Sprintf("Failed to read LDAP group: %v", err), http.StatusBadGateway)
+		return
+	}
+
+	rows := make([]importRow, len(members))
+	for i, member := range members {
+		rows[i] = importRow{
+			Username:  member.Username,
+			Email:     member.Email,
+			FirstName: member.FirstName,
+			LastName:  member.LastName,
+			Provider:  "ldap",
+			Courses:   request.Courses,
+		}
+	}
+
+	response, err := importUsers(rows, request.DryRun)
+	if err != nil {
+		log.Printf("Error provisioning LDAP group %s: %v", request.Group, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	writeImport(w, admin, "LDAP group "+request.Group, response)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseUserCSV(t *testing.T) {
+	tests := []struct {
+		name    string
+		csv     string
+		want    []importRow
+		wantErr string // Part of the error of the whole file, if any
+	}{
+		{
+			name: "required columns",
+			csv:  "username,email\nada,ada@example.com\n",
+			want: []importRow{{Line: 2, Username: "ada", Email: "ada@example.com", Provider: "local", Courses: []string{}}},
+		},
+		{
+			name: "all columns",
+			csv: "Username,Mail,First Name,last_name,password,provider,courses\n" +
+				"ada, ada@example.com ,Ada,Lovelace,secret123,LDAP,algo;python\n" +
+				"alan,alan@example.com,Alan,Turing,,,algo python ;\n",
+			want: []importRow{
+				{Line: 2, Username: "ada", Email: "ada@example.com", FirstName: "Ada", LastName: "Lovelace",
+					Password: "secret123", Provider: "ldap", Courses: []string{"algo", "python"}},
+				{Line: 3, Username: "alan", Email: "alan@example.com", FirstName: "Alan", LastName: "Turing",
+					Provider: "local", Courses: []string{"algo", "python"}},
+			},
+		},
+		{
+			name: "byte order mark and column order",
+			csv:  "\ufeffemail,username\r\nada@example.com,ada\r\n",
+			want: []importRow{{Line: 2, Username: "ada", Email: "ada@example.com", Provider: "local", Courses: []string{}}},
+		},
+		{
+			name: "short record",
+			csv:  "username,email,first_name\nada\n",
+			want: []importRow{{Line: 2, Username: "ada", Provider: "local", Courses: []string{}}},
+		},
+		{
+			name: "quoted field over several lines",
+			csv:  "username,email,last_name\nada,ada@example.com,\"Love\nlace\"\nalan,alan@example.com,Turing\n",
+			want: []importRow{
+				{Line: 2, Username: "ada", Email: "ada@example.com", LastName: "Love\nlace", Provider: "local", Courses: []string{}},
+				{Line: 4, Username: "alan", Email: "alan@example.com", LastName: "Turing", Provider: "local", Courses: []string{}},
+			},
+		},
+		{name: "header only", csv: "username,email\n"},
+		{name: "empty file", csv: "", wantErr: "empty"},
+		{name: "unknown column", csv: "username,email,age\n", wantErr: `unknown column "age"`},
+		{name: "duplicate column", csv: "username,email,mail\n", wantErr: `duplicate column "mail"`},
+		{name: "missing email", csv: "username,first_name\n", wantErr: `missing column "email"`},
+		{name: "missing username", csv: "email\n", wantErr: `missing column "username"`},
+	}
+	for _, tt := range tests {
+		got, err := parseUserCSV(strings.NewReader(tt.csv))
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%s: error = %v, want %q", tt.name, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: rows = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseUserCSVReportsRowErrors(t *testing.T) {
+	rows, err := parseUserCSV(strings.NewReader("username,email\nada,ada@exa\"mple.com\nalan,alan@example.com\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("got %d rows, want 2", len(rows))
+	}
+	if rows[0].Line != 2 || rows[0].Err == nil {
+		t.Errorf("first row = %+v, want an error on line 2", rows[0])
+	}
+	if rows[1].Err != nil || rows[1].Username != "alan" {
+		t.Errorf("second row = %+v, want alan without error", rows[1])
+	}
+}
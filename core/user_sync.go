@@ -22,6 +22,7 @@ func SyncUserFromLDAP(ldapUser *LDAPUser) (*User, error) {
 			PasswordHash: "", // Empty for LDAP users
 			AuthProvider: "ldap",
 			LDAPEnabled:  true,
+			IsAdmin:      isListedPlatformAdmin(ldapUser.Username), // The directory vouches for the name
 		}
 
 		if err := DB.Create(&user).Error; err != nil {
@@ -0,0 +1,530 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	iofs "io/fs"
+	"log"
+	"maps"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/webdav"
+
+	"ironsnake/core/courseparser"
+)
+
+// webdavPrefix is the URL prefix under which course directories are served
+const webdavPrefix = "/webdav/"
+
+// maxCourseFileSize limits the size of validated course files (task.yaml, ...)
+const maxCourseFileSize = 1 << 20
+
+// WebDAVService exposes course directories over WebDAV to course admins
+type WebDAVService struct {
+	catalog *courseparser.Catalog
+
+	mu    sync.Mutex
+	locks map[string]webdav.LockSystem // Course ID -> lock system
+}
+
+// NewWebDAVService creates a new WebDAV service instance
+func NewWebDAVService(catalog *courseparser.Catalog) *WebDAVService {
+	return &WebDAVService{
+		catalog: catalog,
+		locks:   make(map[string]webdav.LockSystem),
+	}
+}
+
+// lockSystem returns the lock system of a course, creating it on first use.
+// Locks must outlive a single request so they are kept per course.
+func (s *WebDAVService) lockSystem(courseID string) webdav.LockSystem {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ls, ok := s.locks[courseID]
+	if !ok {
+		ls = webdav.NewMemLS()
+		s.locks[courseID] = ls
+	}
+	return ls
+}
+
+// ServeHTTP handles WebDAV requests on /webdav/:courseID/...
+func (s *WebDAVService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	user, scopes, err := authenticateWebDAV(r)
+	var throttled *LoginThrottledError
+	if errors.As(err, &throttled) {
+		log.Printf("WebDAV authentication throttled: %v", err)
+		writeLoginThrottled(w, throttled)
+		return
+	}
+	if err != nil {
+		log.Printf("WebDAV authentication failed: %v", err)
+		w.Header().Set("WWW-Authenticate", `Basic realm="IronSnake WebDAV", charset="UTF-8"`)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// Extract course ID from URL path (format: /webdav/:courseID/...)
+	remaining := strings.TrimPrefix(r.URL.Path, webdavPrefix)
+	courseID, _, _ := strings.Cut(remaining, "/")
+	if courseID == "" {
+		http.Error(w, "Course ID is required", http.StatusNotFound)
+		return
+	}
+
+	course, ok := s.catalog.Get(courseID)
+	if !ok {
+		http.Error(w, "Course not found", http.StatusNotFound)
+		return
+	}
+
+	cc, err := newCourseContext(user, course)
+	if err != nil {
+		log.Printf("Error resolving the role of %s in course %s: %v", user.Username, courseID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !cc.Can(PermEditTask) {
+		writeForbidden(w, cc, PermEditTask)
+		return
+	}
+	if !scopeAllows(scopes, "courses", r.Method) {
+		writeInsufficientScope(w, r, "courses")
+		return
+	}
+
+	prefix := webdavPrefix + courseID
+	fs := courseFS{root: course.DirPath}
+
+	// The course is dropped from the catalog without its config.yaml, and
+	// could no longer be reached to put it back
+	if isCourseRootRemoval(r.Method, strings.TrimPrefix(r.URL.Path, prefix)) {
+		http.Error(w, "The course directory and its config.yaml cannot be deleted or moved", http.StatusForbidden)
+		return
+	}
+
+	handler := s.handler(courseID, fs)
+	if !isWebDAVWrite(r.Method) {
+		handler.ServeHTTP(w, r)
+		return
+	}
+
+	// Writes are serialized with the task editor, whose ETag check would
+	// miss a task.yaml replaced in between
+	lock := courseEditLock(courseID)
+	lock.Lock()
+	defer lock.Unlock()
+
+	// Reject invalid course files before they reach the disk
+	if err := s.validateWrite(r, prefix, fs); err != nil {
+		log.Printf("WebDAV write to course %s rejected: %v", courseID, err)
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	s.serveWrite(w, r, handler, course, fs)
+}
+
+// serveWrite applies a write and checks that the course still loads as a
+// whole, e.g. that config.yaml still defines the tags its tasks use.
+// Otherwise the files the write touched are restored and it is refused, so
+// that the API never serves a course that would not load after a restart.
+// The caller holds the course edit lock.
+func (s *WebDAVService) serveWrite(w http.ResponseWriter, r *http.Request, handler *webdav.Handler, course *courseparser.ParsedCourse, fs courseFS) {
+	var names []string
+	if r.Method != "COPY" {
+		names = append(names, strings.TrimPrefix(r.URL.Path, handler.Prefix))
+	}
+	if r.Method == "COPY" || r.Method == "MOVE" {
+		if dest, err := url.Parse(r.Header.Get("Destination")); err == nil && strings.HasPrefix(dest.Path, handler.Prefix+"/") {
+			names = append(names, strings.TrimPrefix(dest.Path, handler.Prefix))
+		}
+	}
+
+	backup, err := backupCourseFiles(fs, names)
+	if err != nil {
+		log.Printf("Failed to back up course %s before WebDAV %s: %v", course.CourseID, r.Method, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer backup.discard()
+
+	rec := newBufferedResponse()
+	handler.ServeHTTP(rec, r)
+
+	// Failed writes may have changed some files, e.g. COPY deletes the
+	// destination before copying, so they are undone entirely
+	if rec.status >= 400 {
+		if err := backup.restore(); err != nil {
+			log.Printf("Failed to restore course %s after WebDAV %s: %v", course.CourseID, r.Method, err)
+		}
+		rec.flush(w)
+		return
+	}
+
+	if _, err := courseparser.NewCourseLoader().LoadCourse(course.DirPath); err != nil {
+		if err := backup.restore(); err != nil {
+			log.Printf("Failed to restore course %s after WebDAV %s: %v", course.CourseID, r.Method, err)
+		}
+		log.Printf("WebDAV %s %s to course %s reverted: %v", r.Method, r.URL.Path, course.CourseID, err)
+		message := strings.ReplaceAll(err.Error(), course.DirPath+string(os.PathSeparator), "")
+		http.Error(w, "The course would no longer load, the change was reverted: "+message, http.StatusUnprocessableEntity)
+		return
+	}
+
+	// Pick up the changes so the API serves the new content
+	if err := s.catalog.Reload(course.CourseID); err != nil {
+		log.Printf("Failed to reload course %s after WebDAV %s: %v", course.CourseID, r.Method, err)
+	}
+	rec.flush(w)
+}
+
+// handler returns the WebDAV handler of a course
+func (s *WebDAVService) handler(courseID string, fs courseFS) *webdav.Handler {
+	return &webdav.Handler{
+		Prefix:     webdavPrefix + courseID,
+		FileSystem: fs,
+		LockSystem: s.lockSystem(courseID),
+		Logger: func(r *http.Request, err error) {
+			if err != nil {
+				log.Printf("WebDAV %s %s: %v", r.Method, r.URL.Path, err)
+			}
+		},
+	}
+}
+
+// validateWrite checks the content of course files written by PUT, COPY or MOVE
+func (s *WebDAVService) validateWrite(r *http.Request, prefix string, fs courseFS) error {
+	switch r.Method {
+	case http.MethodPut:
+		name := strings.TrimPrefix(r.URL.Path, prefix)
+		if !courseparser.IsCourseFile(name) {
+			return nil
+		}
+
+		data, err := io.ReadAll(io.LimitReader(r.Body, maxCourseFileSize+1))
+		if err != nil {
+			return fmt.Errorf("failed to read request body: %w", err)
+		}
+		if len(data) > maxCourseFileSize {
+			return fmt.Errorf("%s is larger than %d bytes", name, maxCourseFileSize)
+		}
+		r.Body = io.NopCloser(bytes.NewReader(data))
+
+		return courseparser.ValidateCourseFile(name, data)
+
+	case "COPY", "MOVE":
+		// Editors often save to a temporary file and rename it over the
+		// original, so the content being moved into place is validated too
+		dest, err := url.Parse(r.Header.Get("Destination"))
+		if err != nil {
+			return nil // the WebDAV handler reports malformed destinations
+		}
+		destName := strings.TrimPrefix(dest.Path, prefix)
+		if !courseparser.IsCourseFile(destName) {
+			return nil
+		}
+
+		srcPath, err := fs.resolve(strings.TrimPrefix(r.URL.Path, prefix))
+		if err != nil {
+			return nil
+		}
+		info, err := os.Stat(srcPath)
+		if err != nil || info.IsDir() {
+			return nil
+		}
+		if info.Size() > maxCourseFileSize {
+			return fmt.Errorf("%s is larger than %d bytes", destName, maxCourseFileSize)
+		}
+		data, err := os.ReadFile(srcPath)
+		if err != nil {
+			return nil
+		}
+
+		return courseparser.ValidateCourseFile(destName, data)
+	}
+
+	return nil
+}
+
+// isCourseRootRemoval reports whether a request deletes or moves the course
+// directory itself or its root config.yaml
+func isCourseRootRemoval(method, name string) bool {
+	if method != http.MethodDelete && method != "MOVE" {
+		return false
+	}
+	switch path.Clean("/" + name) {
+	case "/", "/config.yaml":
+		return true
+	}
+	return false
+}
+
+// isWebDAVWrite reports whether a WebDAV method modifies the course files
+func isWebDAVWrite(method string) bool {
+	switch method {
+	case http.MethodPut, http.MethodDelete, "MKCOL", "COPY", "MOVE":
+		return true
+	}
+	return false
+}
+
+// authenticateWebDAV authenticates a WebDAV request and returns the scopes
+// of its personal access token, if any. File managers send HTTP Basic
+// credentials, where the password may be a personal access token of the
+// user; the JWT cookie or bearer token is accepted as well.
+func authenticateWebDAV(r *http.Request) (*User, []string, error) {
+	if username, password, ok := r.BasicAuth(); ok {
+		if !isPersonalAccessToken(password) {
+			user, err := authenticateThrottled(username, password, clientIP(r))
+			return user, nil, err
+		}
+		user, scopes, _, err := authenticateBearer(password)
+		if err == nil && user.Username != username {
+			return nil, nil, fmt.Errorf("personal access token of %s used as %s", user.Username, username)
+		}
+		return user, scopes, err
+	}
+
+	tokenString, err := jwtService.ExtractToken(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	user, scopes, session, err := authenticateBearer(tokenString)
+	if err == nil && isImpersonation(session) {
+		return nil, nil, errImpersonationWebDAV
+	}
+	return user, scopes, err
+}
+
+// bufferedResponse holds a response until it is known to be the right one
+type bufferedResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func newBufferedResponse() *bufferedResponse {
+	return &bufferedResponse{header: make(http.Header), status: http.StatusOK}
+}
+
+func (b *bufferedResponse) Header() http.Header {
+	return b.header
+}
+
+func (b *bufferedResponse) Write(data []byte) (int, error) {
+	return b.body.Write(data)
+}
+
+func (b *bufferedResponse) WriteHeader(status int) {
+	b.status = status
+}
+
+// flush sends the response to w
+func (b *bufferedResponse) flush(w http.ResponseWriter) {
+	maps.Copy(w.Header(), b.header)
+	w.WriteHeader(b.status)
+	w.Write(b.body.Bytes())
+}
+
+// courseBackup keeps copies of course files so that a write can be undone
+type courseBackup struct {
+	dir     string // Temporary directory of the copies
+	entries []backupEntry
+}
+
+type backupEntry struct {
+	path string
+	copy string // Empty when path did not exist
+}
+
+// backupCourseFiles copies the files or directories of a course that a write
+// is about to change
+func backupCourseFiles(fs courseFS, names []string) (*courseBackup, error) {
+	dir, err := os.MkdirTemp("", "ironsnake-webdav-")
+	if err != nil {
+		return nil, err
+	}
+	backup := &courseBackup{dir: dir}
+
+	for i, name := range names {
+		p, err := fs.resolve(name)
+		if err != nil || p == fs.realRoot() {
+			continue // Refused by the file system anyway
+		}
+		entry := backupEntry{path: p}
+		if _, err := os.Lstat(p); err == nil {
+			entry.copy = filepath.Join(dir, strconv.Itoa(i))
+			if err := copyTree(p, entry.copy); err != nil {
+				backup.discard()
+				return nil, err
+			}
+		} else if !os.IsNotExist(err) {
+			backup.discard()
+			return nil, err
+		}
+		backup.entries = append(backup.entries, entry)
+	}
+	return backup, nil
+}
+
+// restore puts back the files as they were when backed up
+func (b *courseBackup) restore() error {
+	for _, entry := range b.entries {
+		if err := os.RemoveAll(entry.path); err != nil {
+			return err
+		}
+		if entry.copy == "" {
+			continue
+		}
+		if err := copyTree(entry.copy, entry.path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// discard deletes the copies
+func (b *courseBackup) discard() {
+	if err := os.RemoveAll(b.dir); err != nil {
+		log.Printf("Failed to remove WebDAV backup %s: %v", b.dir, err)
+	}
+}
+
+// copyTree copies a file or directory, keeping modes and symlinks
+func copyTree(src, dst string) error {
+	return filepath.WalkDir(src, func(p string, d iofs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		switch {
+		case d.IsDir():
+			return os.MkdirAll(target, info.Mode().Perm())
+		case info.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(p)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		}
+
+		in, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+		out, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(out, in); err != nil {
+			out.Close()
+			return err
+		}
+		return out.Close()
+	})
+}
+
+// statusRecorder captures the status code written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// courseFS is a webdav.FileSystem rooted at a course directory. Every name is
+// resolved with courseparser.SafeJoin so that neither ".." segments nor
+// symlinks can reach files outside of the course.
+type courseFS struct {
+	root string
+}
+
+func (fs courseFS) resolve(name string) (string, error) {
+	p, err := courseparser.SafeJoin(fs.root, name)
+	if err != nil {
+		return "", os.ErrPermission
+	}
+	return p, nil
+}
+
+func (fs courseFS) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+	p, err := fs.resolve(name)
+	if err != nil {
+		return err
+	}
+	return os.Mkdir(p, perm)
+}
+
+func (fs courseFS) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	p, err := fs.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	return os.OpenFile(p, flag, perm)
+}
+
+func (fs courseFS) RemoveAll(ctx context.Context, name string) error {
+	p, err := fs.resolve(name)
+	if err != nil {
+		return err
+	}
+	if p == fs.realRoot() {
+		// Prohibit removing the course directory itself
+		return os.ErrInvalid
+	}
+	return os.RemoveAll(p)
+}
+
+func (fs courseFS) Rename(ctx context.Context, oldName, newName string) error {
+	oldPath, err := fs.resolve(oldName)
+	if err != nil {
+		return err
+	}
+	newPath, err := fs.resolve(newName)
+	if err != nil {
+		return err
+	}
+	if root := fs.realRoot(); oldPath == root || newPath == root {
+		return os.ErrInvalid
+	}
+	return os.Rename(oldPath, newPath)
+}
+
+func (fs courseFS) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	p, err := fs.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	return os.Stat(p)
+}
+
+// realRoot returns the course directory with symlinks resolved, as returned by resolve
+func (fs courseFS) realRoot() string {
+	p, _ := fs.resolve("/")
+	return p
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"ironsnake/core/courseparser"
+)
+
+// writeTestCourse creates a course whose only task uses the tag "loops" of
+// its config.yaml, and returns the courses directory
+func writeTestCourse(t *testing.T) string {
+	t.Helper()
+
+	coursesDir := t.TempDir()
+	files := map[string]string{
+		"CS01/config.yaml": "name: Course\naccessible: true\n" +
+			"tags:\n  loops:\n    name: Loops\n    type: 0\n",
+		"CS01/access.yaml":              "dispenser_data:\n  config: {}\n",
+		"CS01/tasks/task01/task.yaml":   "name: Task\ncategories: [loops]\nproblems: {}\n",
+		"CS01/tasks/task01/helper.py":   "print('helper')\n",
+		"CS01/tasks/task01/data/in.txt": "1 2 3\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(coursesDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return coursesDir
+}
+
+func TestWebDAVWriteKeepsCourseLoadable(t *testing.T) {
+	const configWithoutTags = "name: Course\naccessible: true\n"
+
+	tests := []struct {
+		name        string
+		method      string
+		path        string
+		destination string
+		body        string
+		wantStatus  int
+		wantFiles   map[string]string // Content of course files after the request, "" if missing
+	}{
+		{
+			name:       "valid file",
+			method:     http.MethodPut,
+			path:       "/tasks/task01/helper.py",
+			body:       "print('new')\n",
+			wantStatus: http.StatusCreated,
+			wantFiles:  map[string]string{"tasks/task01/helper.py": "print('new')\n"},
+		},
+		{
+			name:       "tag still used by a task",
+			method:     http.MethodPut,
+			path:       "/config.yaml",
+			body:       configWithoutTags,
+			wantStatus: http.StatusUnprocessableEntity,
+			wantFiles:  map[string]string{"config.yaml": "name: Course\naccessible: true\ntags:\n  loops:\n    name: Loops\n    type: 0\n"},
+		},
+		{
+			name:       "task directory",
+			method:     http.MethodDelete,
+			path:       "/tasks/task01",
+			wantStatus: http.StatusNoContent,
+			wantFiles:  map[string]string{"tasks/task01/task.yaml": "", "tasks/task01/data/in.txt": ""},
+		},
+		{
+			name:        "access.yaml moved away",
+			method:      "MOVE",
+			path:        "/access.yaml",
+			destination: "/webdav/CS01/access.bak",
+			wantStatus:  http.StatusUnprocessableEntity,
+			wantFiles:   map[string]string{"access.yaml": "dispenser_data:\n  config: {}\n", "access.bak": ""},
+		},
+		{
+			name:        "directory copied over its parent task",
+			method:      "COPY",
+			path:        "/tasks/task01/data",
+			destination: "/webdav/CS01/tasks/task01",
+			wantStatus:  http.StatusForbidden, // The source is deleted with the destination
+			wantFiles: map[string]string{
+				"tasks/task01/task.yaml":   "name: Task\ncategories: [loops]\nproblems: {}\n",
+				"tasks/task01/data/in.txt": "1 2 3\n",
+				"tasks/task01/in.txt":      "",
+			},
+		},
+	}
+	for _, tt := range tests {
+		coursesDir := writeTestCourse(t)
+		catalog := courseparser.NewCatalog(coursesDir)
+		if err := catalog.Load(); err != nil {
+			t.Fatal(err)
+		}
+		course, _ := catalog.Get("CS01")
+		s := NewWebDAVService(catalog)
+		fs := courseFS{root: course.DirPath}
+
+		r := httptest.NewRequest(tt.method, webdavPrefix+"CS01"+tt.path, strings.NewReader(tt.body))
+		if tt.destination != "" {
+			r.Header.Set("Destination", tt.destination)
+		}
+		w := httptest.NewRecorder()
+		s.serveWrite(w, r, s.handler("CS01", fs), course, fs)
+
+		if w.Code != tt.wantStatus {
+			t.Errorf("%s: %s %s = %d %q, want %d", tt.name, tt.method, tt.path, w.Code, w.Body.String(), tt.wantStatus)
+		}
+		for name, want := range tt.wantFiles {
+			data, err := os.ReadFile(filepath.Join(course.DirPath, filepath.FromSlash(name)))
+			if want == "" {
+				if !os.IsNotExist(err) {
+					t.Errorf("%s: %s exists, want it missing", tt.name, name)
+				}
+				continue
+			}
+			if string(data) != want {
+				t.Errorf("%s: %s = %q, %v, want %q", tt.name, name, data, err, want)
+			}
+		}
+		if _, ok := catalog.Get("CS01"); !ok {
+			t.Errorf("%s: course dropped from the catalog", tt.name)
+		}
+	}
+}
+
+func TestIsCourseRootRemoval(t *testing.T) {
+	tests := []struct {
+		method string
+		name   string
+		want   bool
+	}{
+		{http.MethodDelete, "/", true},
+		{http.MethodDelete, "", true},
+		{http.MethodDelete, "/config.yaml", true},
+		{http.MethodDelete, "//config.yaml", true},
+		{http.MethodDelete, "/tasks/../config.yaml", true},
+		{"MOVE", "/config.yaml", true},
+		{"MOVE", "/", true},
+		{http.MethodPut, "/config.yaml", false},
+		{"COPY", "/config.yaml", false},
+		{http.MethodDelete, "/access.yaml", false},
+		{http.MethodDelete, "/tasks/task01/config.yaml", false},
+	}
+	for _, tt := range tests {
+		if got := isCourseRootRemoval(tt.method, tt.name); got != tt.want {
+			t.Errorf("isCourseRootRemoval(%s, %q) = %v, want %v", tt.method, tt.name, got, tt.want)
+		}
+	}
+}
@@ -15,6 +15,38 @@ export class ApiError extends Error {
 	}
 }
 
+let refreshing: Promise<boolean> | null = null;
+
+/**
+ * Renews the short-lived access token with the refresh token cookie.
+ * Concurrent callers share the same refresh, as refresh tokens are single use.
+ */
+function refreshSession(): Promise<boolean> {
+	refreshing ??= fetch(`${API_BASE_URL}/auth/refresh`, {
+		method: 'POST',
+		credentials: 'include'
+	})
+		.then((response) => response.ok)
+		.catch(() => false)
+		.finally(() => {
+			refreshing = null;
+		});
+	return refreshing;
+}
+
+/**
+ * Sends a request, refreshing the session and retrying once if the access
+ * token expired
+ */
+async function request(endpoint: string, init: RequestInit = {}): Promise<Response> {
+	const send = () => fetch(`${API_BASE_URL}${endpoint}`, { ...init, credentials: 'include' });
+	const response = await send();
+	if (response.status !== 401 || endpoint === '/auth/login' || endpoint === '/auth/refresh') {
+		return response;
+	}
+	return (await refreshSession()) ? send() : response;
+}
+
 async function handleResponse<T>(response: Response): Promise<T> {
 	if (!response.ok) {
 		throw new ApiError(
@@ -24,44 +56,42 @@ async function handleResponse<T>(response: Response): Promise<T> {
 		);
 	}
 
+	if (response.status === 204) {
+		return undefined as T;
+	}
 	return response.json();
 }
 
 export async function apiGet<T>(endpoint: string): Promise<T> {
-	const response = await fetch(`${API_BASE_URL}${endpoint}`, {
-		credentials: 'include'
-	});
+	const response = await request(endpoint);
 	return handleResponse<T>(response);
 }
 
 export async function apiPost<T, D = unknown>(endpoint: string, data: D): Promise<T> {
-	const response = await fetch(`${API_BASE_URL}${endpoint}`, {
+	const response = await request(endpoint, {
 		method: 'POST',
 		headers: {
 			'Content-Type': 'application/json'
 		},
-		body: JSON.stringify(data),
-		credentials: 'include'
+		body: JSON.stringify(data)
 	});
 	return handleResponse<T>(response);
 }
 
 export async function apiPut<T, D = unknown>(endpoint: string, data: D): Promise<T> {
-	const response = await fetch(`${API_BASE_URL}${endpoint}`, {
+	const response = await request(endpoint, {
 		method: 'PUT',
 		headers: {
 			'Content-Type': 'application/json'
 		},
-		body: JSON.stringify(data),
-		credentials: 'include'
+		body: JSON.stringify(data)
 	});
 	return handleResponse<T>(response);
 }
 
 export async function apiDelete<T>(endpoint: string): Promise<T> {
-	const response = await fetch(`${API_BASE_URL}${endpoint}`, {
-		method: 'DELETE',
-		credentials: 'include'
+	const response = await request(endpoint, {
+		method: 'DELETE'
 	});
 	return handleResponse<T>(response);
 }
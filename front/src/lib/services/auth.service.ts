@@ -1,5 +1,13 @@
-import { apiPost, apiGet } from './api-client';
-import type { User } from '$lib/types';
+import { apiPost, apiGet, apiDelete } from './api-client';
+import type {
+	User,
+	OIDCProvider,
+	SignUpData,
+	TokenScope,
+	PersonalAccessToken,
+	CreatedPersonalAccessToken,
+	ImpersonationLogEntry
+} from '$lib/types';
 
 interface LoginCredentials {
 	username: string;
@@ -9,6 +17,12 @@ interface LoginCredentials {
 interface LoginResponse {
 	user: User;
 	token: string;
+	refreshToken: string;
+	expiresIn: number;
+}
+
+interface MessageResponse {
+	message: string;
 }
 
 export const authService = {
@@ -24,6 +38,16 @@ export const authService = {
 		return response.user;
 	},
 
+	async getOIDCProviders(): Promise<OIDCProvider[]> {
+		return apiGet<OIDCProvider[]>('/auth/oidc/providers');
+	},
+
+	// Navigates to the provider; the backend sets the token cookie and
+	// returns to redirect once logged in
+	loginWithOIDC(provider: OIDCProvider, redirect = '/'): void {
+		location.href = `${provider.loginUrl}?redirect=${encodeURIComponent(redirect)}`;
+	},
+
 	async logout(): Promise<void> {
 		await apiPost<void, Record<string, never>>('/auth/logout', {});
 
@@ -32,6 +56,15 @@ export const authService = {
 		}, 100);
 	},
 
+	// Revokes the sessions of the user on every device
+	async logoutEverywhere(): Promise<void> {
+		await apiPost<void, Record<string, never>>('/auth/logout-all', {});
+
+		setTimeout(() => {
+			location.reload()
+		}, 100);
+	},
+
 	async getCurrentUser(): Promise<User | null> {
 		try {
 			return await apiGet<User>('/auth/me');
@@ -39,5 +72,77 @@ export const authService = {
 			// Not authenticated or token expired
 			return null;
 		}
+	},
+
+	// Creates an unverified account; the user receives a verification link by email
+	async signUp(data: SignUpData): Promise<string> {
+		const response = await apiPost<MessageResponse, SignUpData>('/auth/register', data);
+		return response.message;
+	},
+
+	async verifyEmail(token: string): Promise<string> {
+		const response = await apiPost<MessageResponse>('/auth/verify-email', { token });
+		return response.message;
+	},
+
+	async requestPasswordReset(email: string): Promise<string> {
+		const response = await apiPost<MessageResponse>('/auth/password/forgot', { email });
+		return response.message;
+	},
+
+	async resetPassword(token: string, password: string): Promise<string> {
+		const response = await apiPost<MessageResponse>('/auth/password/reset', { token, password });
+		return response.message;
+	},
+
+	// Other sessions are logged out, the current one is renewed
+	async changePassword(currentPassword: string, newPassword: string): Promise<User> {
+		const response = await apiPost<LoginResponse>('/auth/password', {
+			currentPassword,
+			newPassword
+		});
+		return response.user;
+	},
+
+	async listTokens(): Promise<PersonalAccessToken[]> {
+		return apiGet<PersonalAccessToken[]>('/auth/tokens');
+	},
+
+	async createToken(
+		name: string,
+		scopes: TokenScope[],
+		expiresInDays = 30
+	): Promise<CreatedPersonalAccessToken> {
+		return apiPost<CreatedPersonalAccessToken>('/auth/tokens', { name, scopes, expiresInDays });
+	},
+
+	async deleteToken(id: string): Promise<void> {
+		await apiDelete<void>(`/auth/tokens/${id}`);
+	},
+
+	// Sees a course as one of its students, read-only, until stopImpersonating
+	// or the impersonation expires
+	async impersonate(courseId: string, userId: string): Promise<User> {
+		const response = await apiPost<{ user: User; expiresIn: number }, Record<string, never>>(
+			`/courses/${courseId}/students/${userId}/impersonate`,
+			{}
+		);
+		setTimeout(() => {
+			location.reload()
+		}, 100);
+		return response.user;
+	},
+
+	// Returns to the session of the course admin
+	async stopImpersonating(): Promise<void> {
+		await apiDelete<void>('/auth/impersonation');
+
+		setTimeout(() => {
+			location.reload()
+		}, 100);
+	},
+
+	async listImpersonations(courseId: string, limit = 100): Promise<ImpersonationLogEntry[]> {
+		return apiGet<ImpersonationLogEntry[]>(`/courses/${courseId}/impersonations?limit=${limit}`);
 	}
 };
@@ -1,6 +1,7 @@
 import type {
 	Course,
 	CourseDetail,
+	Enrollment,
 	TaskDetail,
 	MCQSubmissionRequest,
 	MCQSubmissionResponse
@@ -25,6 +26,20 @@ export const courseService = {
 		return apiGet<CourseDetail>(`/courses/${id}`);
 	},
 
+	/**
+	 * Register to a course, with its registration password if it has one
+	 */
+	async register(id: string, password?: string): Promise<Enrollment> {
+		return apiPost<Enrollment, { password?: string }>(`/courses/${id}/register`, { password });
+	},
+
+	/**
+	 * Unregister from a course
+	 */
+	async unregister(id: string): Promise<Enrollment> {
+		return apiPost<Enrollment, Record<string, never>>(`/courses/${id}/unregister`, {});
+	},
+
 	/**
 	 * Get a specific task by course ID and task ID
 	 */
@@ -6,6 +6,28 @@ export interface Course {
 	admins: string[];
 	tutors: string[];
 	taskCount: number;
+	tags: Tag[];
+	enrolled: boolean;
+	registration: boolean;
+	registrationPassword: boolean;
+	allowUnregister: boolean;
+	groupsStudentChoice: boolean;
+	role: 'none' | 'student' | 'tutor' | 'admin';
+	access: 'listed' | 'preview' | 'member';
+}
+
+export interface Enrollment {
+	courseId: string;
+	enrolled: boolean;
+	enrolledAt?: string;
+}
+
+export interface Tag {
+	id: string;
+	name: string;
+	description: string;
+	visible: boolean;
+	type: 'skill' | 'category' | 'organisational';
 }
 
 export interface Problem {
@@ -20,12 +42,16 @@ export interface Task {
 	name: string;
 	author: string;
 	environmentType: string;
+	tags: string[];
 	problems: Problem[];
 }
 
 export interface SummaryEntry {
+	kind: 'chapter' | 'part' | 'separator';
 	title: string;
 	path?: string;
+	number?: string; // for numbered chapters
+	draft?: boolean;
 	children?: SummaryEntry[];
 }
 
@@ -35,6 +61,70 @@ export interface Syllabus {
 	summary: SummaryEntry[];
 }
 
+export interface Chapter {
+	path: string;
+	title: string;
+	markdown: string;
+	html: string;
+	tasks: EmbeddedTask[]; // tasks embedded with {{#task}}
+	snippets: Snippet[]; // runnable code blocks, by data-snippet index
+}
+
+// Details are left out while students may not see the task
+export interface EmbeddedTask extends Partial<Task> {
+	id: string;
+	status: 'open' | 'upcoming' | 'closed';
+	deadline?: string;
+	lastSubmission?: Submission; // newest of the user or their group
+}
+
+export interface Snippet {
+	language: string;
+	code: string;
+}
+
+export interface SearchHit {
+	kind: 'chapter' | 'task' | 'problem';
+	title: string;
+	taskId?: string;
+	problemId?: string;
+	chapterPath?: string;
+	anchor?: string;
+	link: string;
+	snippet: string;
+	score: number;
+}
+
+export interface SearchResponse {
+	query: string;
+	hits: SearchHit[];
+}
+
+export interface GroupUser {
+	username: string;
+	firstName: string;
+	lastName: string;
+}
+
+export interface Group {
+	id: string;
+	name: string;
+	size: number;
+	members: GroupUser[];
+	tutors: GroupUser[];
+}
+
+export interface Submission {
+	id: string;
+	taskId: string;
+	submitter: string;
+	groupId?: string;
+	score: number;
+	correct: number;
+	total: number;
+	createdAt: string;
+}
+
 export interface CourseDetail extends Course {
 	tasks: Task[];
 	syllabus?: Syllabus;
@@ -90,5 +180,7 @@ export interface TaskDetail {
 	environmentType: string;
 	limits?: EnvironmentLimits;
 	networkGrading: boolean;
+	groupSubmission: boolean;
+	tags: string[];
 	problems: ProblemDetail[];
 }
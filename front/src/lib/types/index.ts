@@ -2,6 +2,7 @@ export type {
 	Author,
 	Course,
 	CourseDetail,
+	Enrollment,
 	Task,
 	TaskDetail,
 	Problem,
@@ -15,4 +16,17 @@ export type {
 	MCQSubmissionResponse,
 	ProblemResult
 } from './course';
-export type { User } from './user';
+export type {
+	User,
+	Impersonation,
+	ImpersonationLogEntry,
+	OIDCProvider,
+	SignUpData,
+	TokenScope,
+	PersonalAccessToken,
+	CreatedPersonalAccessToken,
+	AdminUser,
+	AdminUserList,
+	ImportRow,
+	ImportResult
+} from './user';
@@ -4,5 +4,91 @@ export interface User {
 	email: string;
 	firstName: string;
 	lastName: string;
-	authProvider: 'ldap' | 'local';
+	authProvider: 'ldap' | 'local' | `oidc:${string}`;
+	isAdmin: boolean;
+	impersonation?: Impersonation; // Set while a course admin sees the platform as this user
+}
+
+// A read-only session of a student opened by a course admin, limited to one course
+export interface Impersonation {
+	impersonatorId: string;
+	impersonator: string;
+	courseId: string;
+	expiresAt: string;
+}
+
+export interface ImpersonationLogEntry {
+	sessionId: string;
+	impersonator: string;
+	student: string;
+	method: string;
+	path: string;
+	status: number;
+	createdAt: string;
+}
+
+export interface OIDCProvider {
+	id: string;
+	name: string;
+	loginUrl: string; // Add ?redirect=<path> to return to a page after login
+}
+
+export interface SignUpData {
+	username: string;
+	email: string;
+	password: string;
+	firstName: string;
+	lastName: string;
+}
+
+export type TokenScope =
+	| 'courses:read'
+	| 'courses:write'
+	| 'submissions:read'
+	| 'submissions:write'
+	| 'admin:read'
+	| 'admin:write';
+
+export interface PersonalAccessToken {
+	id: string;
+	name: string;
+	prefix: string;
+	scopes: TokenScope[];
+	expiresAt: string;
+	lastUsedAt: string | null;
+	createdAt: string;
+}
+
+// Only returned on creation, the token cannot be shown again
+export interface CreatedPersonalAccessToken extends PersonalAccessToken {
+	token: string;
+}
+
+export interface AdminUser extends User {
+	disabled: boolean;
+	unverified: boolean;
+	createdAt: string;
+}
+
+export interface AdminUserList {
+	total: number;
+	users: AdminUser[];
+}
+
+
+export interface ImportRow {
+	line?: number;
+	username: string;
+	status: 'created' | 'updated' | 'unchanged' | 'error';
+	enrolled?: string[];
+	error?: string;
+}
+
+export interface ImportResult {
+	dryRun: boolean;
+	created: number;
+	updated: number;
+	unchanged: number;
+	failed: number;
+	rows: ImportRow[];
 }